@@ -0,0 +1,87 @@
+// zdb-bench benchmarks ZDB next to tm-db's MemDB and goleveldb backends, and writes the
+// results as JSON. Without -zdb, ZDB is benchmarked against a local stand-in server.
+//
+//	zdb-bench -out results.json
+//	zdb-bench -zdb localhost:9900 -workloads '^(get|iavl)/' -benchtime 5s -out results.json
+package main
+
+import (
+	"flag"
+	"log"
+	"os"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/mariobassem/tendermint-zdb/pkg/db/dbbench"
+)
+
+func main() {
+	testing.Init()
+
+	var (
+		address   = flag.String("zdb", "", "address of a 0-db server to benchmark instead of the stand-in")
+		backends  = flag.String("backends", "memdb,goleveldb,zdb", "comma separated backends to benchmark")
+		workloads = flag.String("workloads", "", "regular expression selecting the workloads, every workload if empty")
+		keys      = flag.Int("keys", dbbench.DefaultKeys, "number of keys written before the read workloads")
+		valueSize = flag.Int("value-size", dbbench.DefaultValueSize, "size of the written values")
+		seed      = flag.Int64("seed", dbbench.DefaultSeed, "seed of the generated keys, values and access order")
+		benchtime = flag.String("benchtime", "1s", "duration of every workload, or number of operations as Nx")
+		out       = flag.String("out", "", "file to write the results to, stdout if empty")
+	)
+	flag.Parse()
+
+	if err := flag.Set("test.benchtime", *benchtime); err != nil {
+		log.Fatalf("invalid benchtime %q: %s", *benchtime, err)
+	}
+
+	var selected []dbbench.Backend
+	for _, name := range strings.Split(*backends, ",") {
+		switch name {
+		case "memdb":
+			selected = append(selected, dbbench.MemDB())
+		case "goleveldb":
+			selected = append(selected, dbbench.GoLevelDB())
+		case "zdb":
+			if *address == "" {
+				selected = append(selected, dbbench.ZDBStandIn())
+			} else {
+				selected = append(selected, dbbench.ZDB(*address))
+			}
+		default:
+			log.Fatalf("unknown backend %q", name)
+		}
+	}
+
+	filter, err := regexp.Compile(*workloads)
+	if err != nil {
+		log.Fatalf("invalid workloads expression: %s", err)
+	}
+
+	var run []dbbench.Workload
+	for _, w := range dbbench.Workloads() {
+		if filter.MatchString(w.Name) {
+			run = append(run, w)
+		}
+	}
+
+	report, err := dbbench.Run(selected, run, dbbench.Options{Keys: *keys, ValueSize: *valueSize, Seed: *seed})
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	w := os.Stdout
+	if *out != "" {
+		f, err := os.Create(*out)
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer f.Close()
+
+		w = f
+	}
+
+	if err := report.WriteJSON(w); err != nil {
+		log.Fatalf("failed to write results: %s", err)
+	}
+}
@@ -0,0 +1,135 @@
+// zdb-export copies a ZDB namespace into a local tm-db database, or into a portable archive.
+//
+//	zdb-export -zdb localhost:9900 -namespace application -backend goleveldb -dir ~/.app/data -name application
+//	zdb-export -zdb localhost:9900 -namespace application -archive application.zdbarch
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+
+	"github.com/mariobassem/tendermint-zdb/pkg/db"
+	"github.com/mariobassem/tendermint-zdb/pkg/migrate"
+	tmdb "github.com/tendermint/tm-db"
+)
+
+func main() {
+	var (
+		address   = flag.String("zdb", "localhost:9900", "address of the 0-db server")
+		namespace = flag.String("namespace", "", "namespace to export")
+		archive   = flag.String("archive", "", "archive file to write, instead of a tm-db database")
+		backend   = flag.String("backend", string(tmdb.GoLevelDBBackend), "target database backend")
+		dir       = flag.String("dir", "", "target data directory")
+		name      = flag.String("name", "", "target database name, e.g. application or blockstore")
+		batchSize = flag.Int("batch", migrate.DefaultBatchSize, "number of keys written per batch")
+		statePath = flag.String("state", "", "file to save the progress to, to resume an interrupted export")
+		verify    = flag.Bool("verify", true, "compare the key count and content digest once exported")
+		rate      = flag.Float64("rate", 0, "maximum number of zdb reads and scans per second, zero means no limit")
+	)
+	flag.Parse()
+
+	if *namespace == "" || (*archive == "" && (*dir == "" || *name == "")) {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer cancel()
+
+	limiter := db.NewRateLimiter(db.RateLimits{
+		Read: db.Limit{Rate: *rate},
+		Scan: db.Limit{Rate: *rate},
+	})
+
+	src, err := db.NewZDB(*address, db.WithRateLimit(limiter), db.WithPriority(db.PriorityLow))
+	if err != nil {
+		log.Fatalf("failed to connect to zdb: %s", err)
+	}
+	defer src.Close()
+
+	if err := src.Select(*namespace); err != nil {
+		log.Fatalf("failed to select namespace %s: %s", *namespace, err)
+	}
+
+	if *archive != "" {
+		err = exportArchive(ctx, &src, *archive, *verify)
+	} else {
+		err = exportDB(ctx, &src, tmdb.BackendType(*backend), *dir, *name, *batchSize, *statePath, *verify)
+	}
+
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+func exportArchive(ctx context.Context, src *db.ZDB, path string, verify bool) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	summary, err := migrate.Export(ctx, src, f)
+	if err != nil {
+		return fmt.Errorf("export interrupted after %d keys: %w", summary.Keys, err)
+	}
+
+	if err := f.Sync(); err != nil {
+		return err
+	}
+
+	log.Printf("exported %d keys to %s", summary.Keys, path)
+
+	if !verify {
+		return nil
+	}
+
+	if _, err := f.Seek(0, 0); err != nil {
+		return err
+	}
+
+	if err := migrate.VerifyArchive(ctx, f, src); err != nil {
+		return err
+	}
+
+	log.Printf("verified %d keys", summary.Keys)
+
+	return nil
+}
+
+func exportDB(ctx context.Context, src *db.ZDB, backend tmdb.BackendType, dir, name string, batchSize int, statePath string, verify bool) error {
+	dst, err := tmdb.NewDB(name, backend, dir)
+	if err != nil {
+		return fmt.Errorf("failed to open target database: %w", err)
+	}
+	defer dst.Close()
+
+	progress, err := migrate.Copy(ctx, src, dst, migrate.Options{
+		BatchSize: batchSize,
+		StatePath: statePath,
+		OnProgress: func(p migrate.Progress) {
+			log.Printf("exported %d keys, %d bytes in %s", p.Keys, p.Bytes, p.Elapsed)
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("export interrupted after %d keys: %w", progress.Keys, err)
+	}
+
+	log.Printf("exported %d keys, %d bytes", progress.Keys, progress.Bytes)
+
+	if !verify {
+		return nil
+	}
+
+	if err := migrate.Verify(ctx, src, dst); err != nil {
+		return err
+	}
+
+	log.Printf("verified %d keys", progress.Keys)
+
+	return nil
+}
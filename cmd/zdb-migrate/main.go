@@ -0,0 +1,92 @@
+// zdb-migrate copies a tm-db database (goleveldb, badgerdb, rocksdb, ...) into a ZDB namespace.
+//
+//	zdb-migrate -backend goleveldb -dir ~/.app/data -name application -zdb localhost:9900 -namespace application
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+
+	"github.com/mariobassem/tendermint-zdb/pkg/db"
+	"github.com/mariobassem/tendermint-zdb/pkg/migrate"
+	tmdb "github.com/tendermint/tm-db"
+)
+
+func main() {
+	var (
+		backend   = flag.String("backend", string(tmdb.GoLevelDBBackend), "source database backend")
+		dir       = flag.String("dir", "", "source data directory")
+		name      = flag.String("name", "", "source database name, e.g. application or blockstore")
+		address   = flag.String("zdb", "localhost:9900", "address of the 0-db server")
+		namespace = flag.String("namespace", "", "target namespace, created if missing")
+		batchSize = flag.Int("batch", migrate.DefaultBatchSize, "number of keys written per batch")
+		statePath = flag.String("state", "", "file to save the progress to, to resume an interrupted migration")
+		verify    = flag.Bool("verify", true, "compare the key count and content digest once copied")
+	)
+	flag.Parse()
+
+	if *dir == "" || *name == "" || *namespace == "" {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer cancel()
+
+	if err := run(ctx, tmdb.BackendType(*backend), *dir, *name, *address, *namespace, *batchSize, *statePath, *verify); err != nil {
+		log.Fatal(err)
+	}
+}
+
+func run(ctx context.Context, backend tmdb.BackendType, dir, name, address, namespace string, batchSize int, statePath string, verify bool) error {
+	src, err := tmdb.NewDB(name, backend, dir)
+	if err != nil {
+		return fmt.Errorf("failed to open source database: %w", err)
+	}
+	defer src.Close()
+
+	dst, err := db.NewZDB(address)
+	if err != nil {
+		return fmt.Errorf("failed to connect to zdb: %w", err)
+	}
+	defer dst.Close()
+
+	if err := dst.Select(namespace); err != nil {
+		if err := dst.NewNamespace(namespace); err != nil {
+			return fmt.Errorf("failed to create namespace %s: %w", namespace, err)
+		}
+
+		if err := dst.Select(namespace); err != nil {
+			return fmt.Errorf("failed to select namespace %s: %w", namespace, err)
+		}
+	}
+
+	progress, err := migrate.Copy(ctx, src, &dst, migrate.Options{
+		BatchSize: batchSize,
+		StatePath: statePath,
+		OnProgress: func(p migrate.Progress) {
+			log.Printf("copied %d keys, %d bytes in %s", p.Keys, p.Bytes, p.Elapsed)
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("migration interrupted after %d keys: %w", progress.Keys, err)
+	}
+
+	log.Printf("copied %d keys, %d bytes", progress.Keys, progress.Bytes)
+
+	if !verify {
+		return nil
+	}
+
+	if err := migrate.Verify(ctx, src, &dst); err != nil {
+		return err
+	}
+
+	log.Printf("verified %d keys", progress.Keys)
+
+	return nil
+}
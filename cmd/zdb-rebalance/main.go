@@ -0,0 +1,124 @@
+// zdb-rebalance moves keys to the shards added to a sharded database.
+//
+//	zdb-rebalance -shards a=zdb1:9900/app,b=zdb2:9900/app -add c=zdb3:9900/app
+//
+// Shards are given as name=address/namespace. The shard names, -replicas and -prefix-length
+// must match the ones used by the application.
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"strings"
+
+	"github.com/mariobassem/tendermint-zdb/pkg/db"
+	"github.com/mariobassem/tendermint-zdb/pkg/shard"
+)
+
+func main() {
+	var (
+		existing     = flag.String("shards", "", "comma separated shards before the addition, as name=address/namespace")
+		added        = flag.String("add", "", "comma separated added shards, as name=address/namespace")
+		replicas     = flag.Int("replicas", shard.DefaultReplicas, "number of ring points per shard")
+		prefixLength = flag.Int("prefix-length", 0, "number of leading key bytes hashed to pick a shard, zero hashes whole keys")
+		batchSize    = flag.Int("batch", shard.DefaultBatchSize, "number of keys moved per batch")
+	)
+	flag.Parse()
+
+	if *existing == "" || *added == "" {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer cancel()
+
+	if err := run(ctx, *existing, *added, *replicas, *prefixLength, *batchSize); err != nil {
+		log.Fatal(err)
+	}
+}
+
+func run(ctx context.Context, existing, added string, replicas, prefixLength, batchSize int) error {
+	previous, err := openShards(existing)
+	if err != nil {
+		return err
+	}
+
+	next, err := openShards(added)
+	if err != nil {
+		closeShards(previous)
+		return err
+	}
+
+	names := make([]string, 0, len(previous))
+	for _, s := range previous {
+		names = append(names, s.Name)
+	}
+
+	sharded, err := shard.New(append(previous, next...), shard.Options{
+		Replicas:     replicas,
+		PrefixLength: prefixLength,
+		Previous:     names,
+	})
+	if err != nil {
+		closeShards(append(previous, next...))
+		return err
+	}
+	defer sharded.Close()
+
+	moved, err := sharded.Rebalance(ctx, batchSize)
+	if err != nil {
+		return fmt.Errorf("rebalancing interrupted after moving %d keys: %w", moved, err)
+	}
+
+	log.Printf("moved %d keys", moved)
+
+	return nil
+}
+
+func openShards(specs string) ([]shard.Shard, error) {
+	shards := []shard.Shard{}
+	for _, spec := range strings.Split(specs, ",") {
+		name, target, ok := strings.Cut(spec, "=")
+		if !ok || name == "" {
+			closeShards(shards)
+			return nil, fmt.Errorf("invalid shard %q, expected name=address/namespace", spec)
+		}
+
+		address, namespace, _ := strings.Cut(target, "/")
+
+		z, err := db.NewZDB(address)
+		if err != nil {
+			closeShards(shards)
+			return nil, fmt.Errorf("failed to connect to shard %s: %w", name, err)
+		}
+
+		if namespace != "" {
+			if err := z.Select(namespace); err != nil {
+				z.Close()
+				closeShards(shards)
+				return nil, fmt.Errorf("failed to select namespace %s on shard %s: %w", namespace, name, err)
+			}
+		}
+
+		shards = append(shards, shard.Shard{Name: name, DB: &z})
+	}
+
+	return shards, nil
+}
+
+func closeShards(shards []shard.Shard) {
+	errs := []error{}
+	for _, s := range shards {
+		errs = append(errs, s.DB.Close())
+	}
+
+	if err := errors.Join(errs...); err != nil {
+		log.Printf("failed to close shards: %s", err)
+	}
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+)
+
+// encoding converts keys and values between their command line and binary representations.
+type encoding string
+
+const (
+	encodingUTF8   encoding = "utf8"
+	encodingHex    encoding = "hex"
+	encodingBase64 encoding = "base64"
+)
+
+func parseEncoding(s string) (encoding, error) {
+	switch e := encoding(s); e {
+	case encodingUTF8, encodingHex, encodingBase64:
+		return e, nil
+	case "utf-8":
+		return encodingUTF8, nil
+	default:
+		return "", fmt.Errorf("unknown encoding %q, expected utf8, hex or base64", s)
+	}
+}
+
+func (e encoding) decode(s string) (string, error) {
+	switch e {
+	case encodingHex:
+		b, err := hex.DecodeString(s)
+		return string(b), err
+	case encodingBase64:
+		b, err := base64.StdEncoding.DecodeString(s)
+		return string(b), err
+	default:
+		return s, nil
+	}
+}
+
+func (e encoding) encode(s string) string {
+	switch e {
+	case encodingHex:
+		return hex.EncodeToString([]byte(s))
+	case encodingBase64:
+		return base64.StdEncoding.EncodeToString([]byte(s))
+	default:
+		return s
+	}
+}
+
+// cursors are binary, they are always printed and parsed as hex.
+func decodeCursor(s string) (string, error) {
+	b, err := hex.DecodeString(s)
+	return string(b), err
+}
+
+func encodeCursor(s string) string {
+	return hex.EncodeToString([]byte(s))
+}
@@ -0,0 +1,392 @@
+// zdbctl manages 0-db namespaces and keys.
+//
+//	zdbctl [flags] ns list|create|delete|info|set
+//	zdbctl [flags] key get|set|del|exists|history|keytime|length
+//	zdbctl [flags] scan [-reverse] [-cursor hex] [-limit n]
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/mariobassem/tendermint-zdb/pkg/zdb"
+)
+
+const usage = `usage: zdbctl [flags] <command> [args]
+
+commands:
+  ns list
+  ns create <name>
+  ns delete <name>
+  ns info <name>
+  ns set <name> <property> <value>
+  key get <key>
+  key set <key> <value>
+  key del <key>
+  key exists <key>
+  key history <key>
+  key keytime <key>
+  key length <key>
+  scan [-reverse] [-cursor hex] [-limit n]
+
+flags:
+`
+
+type cli struct {
+	client   *zdb.Client
+	keyEnc   encoding
+	valueEnc encoding
+	jsonOut  bool
+	stdout   io.Writer
+}
+
+func main() {
+	ctx := context.Background()
+	if err := run(ctx, os.Args[1:], os.Stdout, os.Stderr); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+func run(ctx context.Context, args []string, stdout, stderr io.Writer) error {
+	flags := flag.NewFlagSet("zdbctl", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	flags.Usage = func() {
+		fmt.Fprint(stderr, usage)
+		flags.PrintDefaults()
+	}
+
+	var (
+		address   = flags.String("addr", "localhost:9900", "address of the 0-db server")
+		namespace = flags.String("ns", "", "namespace to select before running the command")
+		password  = flags.String("password", "", "password of the namespace")
+		keyEnc    = flags.String("key-encoding", "utf8", "encoding of keys: utf8, hex or base64")
+		valueEnc  = flags.String("value-encoding", "utf8", "encoding of values: utf8, hex or base64")
+		jsonOut   = flags.Bool("json", false, "print results as JSON")
+	)
+
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	if flags.NArg() == 0 {
+		flags.Usage()
+		return errors.New("missing command")
+	}
+
+	c := cli{
+		jsonOut: *jsonOut,
+		stdout:  stdout,
+	}
+
+	var err error
+	if c.keyEnc, err = parseEncoding(*keyEnc); err != nil {
+		return err
+	}
+
+	if c.valueEnc, err = parseEncoding(*valueEnc); err != nil {
+		return err
+	}
+
+	client := zdb.NewClient(*address)
+	defer client.Close()
+	c.client = &client
+
+	if *namespace != "" {
+		if *password != "" {
+			err = client.SelectSecure(ctx, *namespace, *password)
+		} else {
+			err = client.Select(ctx, *namespace)
+		}
+
+		if err != nil {
+			return fmt.Errorf("failed to select namespace %s: %w", *namespace, err)
+		}
+	}
+
+	cmd, rest := flags.Arg(0), flags.Args()[1:]
+	switch cmd {
+	case "ns":
+		return c.namespaceCommand(ctx, rest)
+	case "key":
+		return c.keyCommand(ctx, rest)
+	case "scan":
+		return c.scanCommand(ctx, rest)
+	default:
+		flags.Usage()
+		return fmt.Errorf("unknown command %q", cmd)
+	}
+}
+
+func (c *cli) namespaceCommand(ctx context.Context, args []string) error {
+	if len(args) == 0 {
+		return errors.New("missing ns command")
+	}
+
+	switch args[0] {
+	case "list":
+		if err := expectArgs(args, 0); err != nil {
+			return err
+		}
+
+		namespaces, err := c.client.ListNamespaces(ctx)
+		if err != nil {
+			return err
+		}
+
+		return c.print(namespaces, strings.Join(namespaces, "\n"))
+	case "create":
+		if err := expectArgs(args, 1); err != nil {
+			return err
+		}
+
+		return c.ok(c.client.NewNamespace(ctx, args[1]))
+	case "delete":
+		if err := expectArgs(args, 1); err != nil {
+			return err
+		}
+
+		return c.ok(c.client.DeleteNamespace(ctx, args[1]))
+	case "info":
+		if err := expectArgs(args, 1); err != nil {
+			return err
+		}
+
+		info, err := c.client.NamespaceInfo(ctx, args[1])
+		if err != nil {
+			return err
+		}
+
+		return c.print(parseInfo(info), strings.TrimSpace(info))
+	case "set":
+		if err := expectArgs(args, 3); err != nil {
+			return err
+		}
+
+		return c.ok(c.client.SetNamespace(ctx, args[1], args[2], args[3]))
+	default:
+		return fmt.Errorf("unknown ns command %q", args[0])
+	}
+}
+
+func (c *cli) keyCommand(ctx context.Context, args []string) error {
+	if len(args) < 2 {
+		return errors.New("missing key command or key")
+	}
+
+	key, err := c.keyEnc.decode(args[1])
+	if err != nil {
+		return fmt.Errorf("invalid key: %w", err)
+	}
+
+	switch args[0] {
+	case "get":
+		if err := expectArgs(args, 1); err != nil {
+			return err
+		}
+
+		value, err := c.client.Get(ctx, key)
+		if errors.Is(err, zdb.ErrNil) {
+			return fmt.Errorf("key %s not found", args[1])
+		}
+		if err != nil {
+			return err
+		}
+
+		return c.print(map[string]string{"key": args[1], "value": c.valueEnc.encode(value)}, c.valueEnc.encode(value))
+	case "set":
+		if err := expectArgs(args, 2); err != nil {
+			return err
+		}
+
+		value, err := c.valueEnc.decode(args[2])
+		if err != nil {
+			return fmt.Errorf("invalid value: %w", err)
+		}
+
+		return c.ok(c.client.Set(ctx, key, value))
+	case "del":
+		if err := expectArgs(args, 1); err != nil {
+			return err
+		}
+
+		return c.ok(c.client.Delete(ctx, key))
+	case "exists":
+		if err := expectArgs(args, 1); err != nil {
+			return err
+		}
+
+		exists, err := c.client.Exists(ctx, key)
+		if err != nil {
+			return err
+		}
+
+		return c.print(map[string]bool{"exists": exists}, fmt.Sprint(exists))
+	case "history":
+		if err := expectArgs(args, 1); err != nil {
+			return err
+		}
+
+		return c.history(ctx, key)
+	case "keytime":
+		if err := expectArgs(args, 1); err != nil {
+			return err
+		}
+
+		ts, err := c.client.KeyTime(ctx, key)
+		if err != nil {
+			return err
+		}
+
+		return c.print(map[string]int64{"timestamp": ts}, time.Unix(ts, 0).UTC().Format(time.RFC3339))
+	case "length":
+		if err := expectArgs(args, 1); err != nil {
+			return err
+		}
+
+		length, err := c.client.Length(ctx, key)
+		if errors.Is(err, zdb.ErrNil) {
+			return fmt.Errorf("key %s not found", args[1])
+		}
+		if err != nil {
+			return err
+		}
+
+		return c.print(map[string]uint64{"length": length}, fmt.Sprint(length))
+	default:
+		return fmt.Errorf("unknown key command %q", args[0])
+	}
+}
+
+type historyEntry struct {
+	Timestamp int64  `json:"timestamp"`
+	Value     string `json:"value"`
+}
+
+func (c *cli) history(ctx context.Context, key string) error {
+	entries := []historyEntry{}
+	lines := []string{}
+
+	entry, err := c.client.History(ctx, key)
+	for {
+		if err != nil {
+			return err
+		}
+
+		value := c.valueEnc.encode(entry.Value)
+		entries = append(entries, historyEntry{Timestamp: entry.Timestamp, Value: value})
+		lines = append(lines, fmt.Sprintf("%s %s", time.Unix(entry.Timestamp, 0).UTC().Format(time.RFC3339), value))
+
+		if entry.Previous == "" {
+			break
+		}
+
+		entry, err = c.client.HistoryWithData(ctx, key, entry.Previous)
+	}
+
+	return c.print(entries, strings.Join(lines, "\n"))
+}
+
+type scanEntry struct {
+	Key       string `json:"key"`
+	Size      uint64 `json:"size"`
+	Timestamp int64  `json:"timestamp"`
+}
+
+type scanResult struct {
+	Keys []scanEntry `json:"keys"`
+	// Next is the hex cursor to resume the scan from.
+	Next string `json:"next"`
+}
+
+func (c *cli) scanCommand(ctx context.Context, args []string) error {
+	flags := flag.NewFlagSet("scan", flag.ContinueOnError)
+	var (
+		reverse = flags.Bool("reverse", false, "scan from the last key to the first")
+		cursor  = flags.String("cursor", "", "hex cursor to start after, as printed by a previous scan")
+		limit   = flags.Int("limit", 0, "maximum number of keys to print, zero means no limit")
+	)
+
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	start, err := decodeCursor(*cursor)
+	if err != nil {
+		return fmt.Errorf("invalid cursor: %w", err)
+	}
+
+	result := scanResult{Keys: []scanEntry{}}
+	lines := []string{}
+
+	scanner := c.client.NewScanner(ctx, zdb.ScanOptions{Reverse: *reverse, Cursor: start, Limit: *limit})
+	for scanner.Next() {
+		k := scanner.Key()
+		key := c.keyEnc.encode(k.Key)
+		result.Keys = append(result.Keys, scanEntry{Key: key, Size: k.Size, Timestamp: k.Timestamp})
+		lines = append(lines, fmt.Sprintf("%s\t%d\t%s", key, k.Size, time.Unix(k.Timestamp, 0).UTC().Format(time.RFC3339)))
+	}
+
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+
+	result.Next = encodeCursor(scanner.Cursor())
+	if len(result.Keys) > 0 {
+		lines = append(lines, fmt.Sprintf("next cursor: %s", result.Next))
+	}
+
+	return c.print(result, strings.Join(lines, "\n"))
+}
+
+// print writes v as JSON, or text otherwise.
+func (c *cli) print(v interface{}, text string) error {
+	if c.jsonOut {
+		enc := json.NewEncoder(c.stdout)
+		return enc.Encode(v)
+	}
+
+	if text == "" {
+		return nil
+	}
+
+	_, err := fmt.Fprintln(c.stdout, text)
+	return err
+}
+
+func (c *cli) ok(err error) error {
+	if err != nil {
+		return err
+	}
+
+	return c.print(map[string]bool{"ok": true}, "OK")
+}
+
+func expectArgs(args []string, n int) error {
+	if len(args)-1 != n {
+		return fmt.Errorf("%s expects %d arguments, but %d were given", args[0], n, len(args)-1)
+	}
+
+	return nil
+}
+
+func parseInfo(info string) map[string]string {
+	parsed := map[string]string{}
+	for _, line := range strings.Split(info, "\n") {
+		key, value, found := strings.Cut(line, ":")
+		if !found {
+			continue
+		}
+
+		parsed[key] = strings.TrimSpace(value)
+	}
+
+	return parsed
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"github.com/mariobassem/tendermint-zdb/pkg/zdb/zdbtest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func runCommand(t *testing.T, addr string, args ...string) string {
+	t.Helper()
+
+	var stdout, stderr bytes.Buffer
+	err := run(context.Background(), append([]string{"-addr", addr}, args...), &stdout, &stderr)
+	require.NoError(t, err, stderr.String())
+
+	return stdout.String()
+}
+
+func TestKeyCommands(t *testing.T) {
+	server, err := zdbtest.NewServer()
+	require.NoError(t, err)
+	defer server.Close()
+
+	addr := server.Addr()
+
+	assert.Equal(t, "OK\n", runCommand(t, addr, "ns", "create", "test"))
+	assert.Equal(t, "OK\n", runCommand(t, addr, "-ns", "test", "-key-encoding", "hex", "key", "set", "6b31", "v1"))
+	assert.Equal(t, "OK\n", runCommand(t, addr, "-ns", "test", "-value-encoding", "base64", "key", "set", "k1", "djI="))
+
+	assert.Equal(t, "v2\n", runCommand(t, addr, "-ns", "test", "key", "get", "k1"))
+	assert.Equal(t, "7632\n", runCommand(t, addr, "-ns", "test", "-value-encoding", "hex", "key", "get", "k1"))
+	assert.Equal(t, "true\n", runCommand(t, addr, "-ns", "test", "key", "exists", "k1"))
+	assert.Equal(t, "{\"length\":2}\n", runCommand(t, addr, "-ns", "test", "-json", "key", "length", "k1"))
+
+	var history []historyEntry
+	out := runCommand(t, addr, "-ns", "test", "-json", "key", "history", "k1")
+	require.NoError(t, json.Unmarshal([]byte(out), &history))
+	require.Len(t, history, 2)
+	assert.Equal(t, "v2", history[0].Value)
+	assert.Equal(t, "v1", history[1].Value)
+
+	assert.Equal(t, "OK\n", runCommand(t, addr, "-ns", "test", "key", "del", "k1"))
+	assert.Equal(t, "false\n", runCommand(t, addr, "-ns", "test", "key", "exists", "k1"))
+
+	var namespaces []string
+	out = runCommand(t, addr, "-json", "ns", "list")
+	require.NoError(t, json.Unmarshal([]byte(out), &namespaces))
+	assert.Equal(t, []string{"default", "test"}, namespaces)
+}
+
+func TestScanCommand(t *testing.T) {
+	server, err := zdbtest.NewServer()
+	require.NoError(t, err)
+	defer server.Close()
+	server.PageSize = 3
+
+	addr := server.Addr()
+	for i := 0; i < 10; i++ {
+		runCommand(t, addr, "key", "set", fmt.Sprintf("k%d", i), "v")
+	}
+
+	scan := func(args ...string) scanResult {
+		var res scanResult
+		out := runCommand(t, addr, append([]string{"-json", "scan"}, args...)...)
+		require.NoError(t, json.Unmarshal([]byte(out), &res))
+		return res
+	}
+
+	first := scan("-limit", "4")
+	require.Len(t, first.Keys, 4)
+	assert.Equal(t, "k3", first.Keys[3].Key)
+
+	rest := scan("-cursor", first.Next)
+	require.Len(t, rest.Keys, 6)
+	assert.Equal(t, "k4", rest.Keys[0].Key)
+
+	reverse := scan("-reverse", "-limit", "2")
+	require.Len(t, reverse.Keys, 2)
+	assert.Equal(t, "k9", reverse.Keys[0].Key)
+	assert.Equal(t, "k8", reverse.Keys[1].Key)
+}
@@ -0,0 +1,299 @@
+package backup
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+)
+
+// A backup archive starts with archiveMagic and the format version, followed by the uvarint
+// length of the JSON encoded header and the header itself. Then come the data entries: every
+// entry starts with entryMarker, then the entry flags, the uvarint length of the key, the key,
+// the uvarint length of the payload, the payload and the varint timestamp. The archive ends with
+// endMarker, the uvarint length of the JSON encoded trailer, the trailer, and the sha256
+// checksum of everything before it.
+var archiveMagic = []byte("ZDBBACKUP")
+
+const (
+	archiveVersion = 1
+	entryMarker    = 1
+	endMarker      = 0
+)
+
+var ErrInvalidArchive = errors.New("invalid backup archive")
+
+// Entry is a data entry of a namespace, as read from its data files.
+type Entry struct {
+	Key       string
+	Payload   string
+	Flags     uint8
+	Timestamp int64
+}
+
+type archiveWriter struct {
+	w    *bufio.Writer
+	hash hash.Hash
+}
+
+// header holds the manifest fields known before the entries are read.
+type header struct {
+	Namespace string `json:"namespace"`
+	Type      string `json:"type"`
+	Sequence  uint64 `json:"sequence"`
+	Parent    string `json:"parent,omitempty"`
+	Created   int64  `json:"created"`
+}
+
+// trailer holds the manifest fields known once all entries were written.
+type trailer struct {
+	Files   map[uint32]uint32 `json:"files"`
+	Entries uint64            `json:"entries"`
+}
+
+func newArchiveWriter(w io.Writer, m Manifest) (*archiveWriter, error) {
+	h := sha256.New()
+	a := &archiveWriter{
+		w:    bufio.NewWriter(io.MultiWriter(w, h)),
+		hash: h,
+	}
+
+	hdr, err := json.Marshal(header{
+		Namespace: m.Namespace,
+		Type:      m.Type,
+		Sequence:  m.Sequence,
+		Parent:    m.Parent,
+		Created:   m.Created,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	buf := append([]byte{}, archiveMagic...)
+	buf = append(buf, archiveVersion)
+	buf = binary.AppendUvarint(buf, uint64(len(hdr)))
+	buf = append(buf, hdr...)
+
+	if _, err := a.w.Write(buf); err != nil {
+		return nil, err
+	}
+
+	return a, nil
+}
+
+func (a *archiveWriter) write(e Entry) error {
+	buf := make([]byte, 0, 2+3*binary.MaxVarintLen64+len(e.Key)+len(e.Payload))
+	buf = append(buf, entryMarker, e.Flags)
+	buf = binary.AppendUvarint(buf, uint64(len(e.Key)))
+	buf = append(buf, e.Key...)
+	buf = binary.AppendUvarint(buf, uint64(len(e.Payload)))
+	buf = append(buf, e.Payload...)
+	buf = binary.AppendVarint(buf, e.Timestamp)
+
+	_, err := a.w.Write(buf)
+	return err
+}
+
+// close writes the archive trailer and returns the archive checksum.
+func (a *archiveWriter) close(m Manifest) (string, error) {
+	t, err := json.Marshal(trailer{
+		Files:   m.Files,
+		Entries: m.Entries,
+	})
+	if err != nil {
+		return "", err
+	}
+
+	buf := []byte{endMarker}
+	buf = binary.AppendUvarint(buf, uint64(len(t)))
+	buf = append(buf, t...)
+
+	if _, err := a.w.Write(buf); err != nil {
+		return "", err
+	}
+
+	if err := a.w.Flush(); err != nil {
+		return "", err
+	}
+
+	sum := a.hash.Sum(nil)
+	if _, err := a.w.Write(sum); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(sum), a.w.Flush()
+}
+
+// archiveReader reads an archive, and checks its checksum once all entries are read.
+type archiveReader struct {
+	r        *bufio.Reader
+	hash     hash.Hash
+	manifest Manifest
+	done     bool
+}
+
+func newArchiveReader(r io.Reader) (*archiveReader, error) {
+	a := &archiveReader{
+		r:    bufio.NewReader(r),
+		hash: sha256.New(),
+	}
+
+	prefix := make([]byte, len(archiveMagic)+1)
+	if err := a.read(prefix); err != nil {
+		return nil, err
+	}
+
+	if !bytes.Equal(prefix[:len(archiveMagic)], archiveMagic) {
+		return nil, fmt.Errorf("%w: bad magic", ErrInvalidArchive)
+	}
+
+	if prefix[len(archiveMagic)] != archiveVersion {
+		return nil, fmt.Errorf("%w: unsupported version %d", ErrInvalidArchive, prefix[len(archiveMagic)])
+	}
+
+	data, err := a.readBytes()
+	if err != nil {
+		return nil, err
+	}
+
+	var hdr header
+	if err := json.Unmarshal(data, &hdr); err != nil {
+		return nil, fmt.Errorf("%w: invalid header: %s", ErrInvalidArchive, err)
+	}
+
+	a.manifest = Manifest{
+		Namespace: hdr.Namespace,
+		Type:      hdr.Type,
+		Sequence:  hdr.Sequence,
+		Parent:    hdr.Parent,
+		Created:   hdr.Created,
+	}
+
+	return a, nil
+}
+
+// next returns the next entry, or io.EOF once all entries were read and the checksum matches.
+func (a *archiveReader) next() (Entry, error) {
+	if a.done {
+		return Entry{}, io.EOF
+	}
+
+	marker := make([]byte, 1)
+	if err := a.read(marker); err != nil {
+		return Entry{}, err
+	}
+
+	if marker[0] == endMarker {
+		return Entry{}, a.readTrailer()
+	}
+
+	if marker[0] != entryMarker {
+		return Entry{}, fmt.Errorf("%w: unexpected entry marker %d", ErrInvalidArchive, marker[0])
+	}
+
+	flags := make([]byte, 1)
+	if err := a.read(flags); err != nil {
+		return Entry{}, err
+	}
+
+	key, err := a.readBytes()
+	if err != nil {
+		return Entry{}, err
+	}
+
+	payload, err := a.readBytes()
+	if err != nil {
+		return Entry{}, err
+	}
+
+	ts, err := binary.ReadVarint(hashingByteReader{a})
+	if err != nil {
+		return Entry{}, invalid(err)
+	}
+
+	return Entry{Key: string(key), Payload: string(payload), Flags: flags[0], Timestamp: ts}, nil
+}
+
+func (a *archiveReader) readTrailer() error {
+	data, err := a.readBytes()
+	if err != nil {
+		return err
+	}
+
+	var t trailer
+	if err := json.Unmarshal(data, &t); err != nil {
+		return fmt.Errorf("%w: invalid trailer: %s", ErrInvalidArchive, err)
+	}
+
+	want := a.hash.Sum(nil)
+
+	got := make([]byte, sha256.Size)
+	if _, err := io.ReadFull(a.r, got); err != nil {
+		return invalid(err)
+	}
+
+	if !bytes.Equal(want, got) {
+		return fmt.Errorf("%w: checksum mismatch", ErrInvalidArchive)
+	}
+
+	a.manifest.Files = t.Files
+	a.manifest.Entries = t.Entries
+	a.manifest.Checksum = hex.EncodeToString(got)
+	a.done = true
+
+	return io.EOF
+}
+
+func (a *archiveReader) read(buf []byte) error {
+	if _, err := io.ReadFull(a.r, buf); err != nil {
+		return invalid(err)
+	}
+
+	a.hash.Write(buf)
+
+	return nil
+}
+
+func (a *archiveReader) readBytes() ([]byte, error) {
+	size, err := binary.ReadUvarint(hashingByteReader{a})
+	if err != nil {
+		return nil, invalid(err)
+	}
+
+	buf := make([]byte, size)
+	if err := a.read(buf); err != nil {
+		return nil, err
+	}
+
+	return buf, nil
+}
+
+// hashingByteReader adds the bytes read by varint decoding to the archive checksum.
+type hashingByteReader struct {
+	a *archiveReader
+}
+
+func (h hashingByteReader) ReadByte() (byte, error) {
+	b, err := h.a.r.ReadByte()
+	if err != nil {
+		return 0, err
+	}
+
+	h.a.hash.Write([]byte{b})
+
+	return b, nil
+}
+
+func invalid(err error) error {
+	if errors.Is(err, io.EOF) {
+		err = io.ErrUnexpectedEOF
+	}
+
+	return fmt.Errorf("%w: %s", ErrInvalidArchive, err)
+}
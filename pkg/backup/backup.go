@@ -0,0 +1,317 @@
+// Package backup takes full and incremental backups of a 0-db namespace by reading its data
+// files with DATA RAW, and restores them.
+//
+// A full backup copies every entry of every data file. An incremental backup only reads the
+// data files reported by INDEX DIRTY since the previous backup, and the files written since,
+// starting where the previous backup stopped. Restoring replays the entries of a full backup
+// and its chain of incremental backups in order.
+package backup
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"strconv"
+	"time"
+
+	"github.com/mariobassem/tendermint-zdb/pkg/zdb"
+)
+
+const (
+	TypeFull        = "full"
+	TypeIncremental = "incremental"
+)
+
+var (
+	ErrBrokenChain = errors.New("backup does not follow the previous backup")
+	ErrCorrupted   = errors.New("data entry failed the integrity check")
+)
+
+// Manifest describes a backup archive.
+type Manifest struct {
+	Namespace string `json:"namespace"`
+	Type      string `json:"type"`
+	// Sequence is 0 for a full backup, and increases with every incremental backup.
+	Sequence uint64 `json:"sequence"`
+	// Parent is the checksum of the previous backup of an incremental backup.
+	Parent  string `json:"parent,omitempty"`
+	Created int64  `json:"created"`
+	// Files maps the data files read so far to the offset following their last backed up entry.
+	Files map[uint32]uint32 `json:"files"`
+	// Entries is the number of entries in the archive.
+	Entries uint64 `json:"entries"`
+	// Checksum is the sha256 checksum of the archive, it identifies the backup.
+	Checksum string `json:"checksum"`
+}
+
+// Full writes a full backup of the namespace, which must be selected on the client, to w.
+func Full(ctx context.Context, client *zdb.Client, namespace string, w io.Writer) (Manifest, error) {
+	if err := client.IndexDirtyReset(ctx); err != nil {
+		return Manifest{}, fmt.Errorf("failed to reset dirty index files: %w", err)
+	}
+
+	current, err := currentDataFile(ctx, client, namespace)
+	if err != nil {
+		return Manifest{}, err
+	}
+
+	files := make([]uint32, 0, current+1)
+	for f := uint32(0); f <= current; f++ {
+		files = append(files, f)
+	}
+
+	m := Manifest{
+		Namespace: namespace,
+		Type:      TypeFull,
+		Created:   time.Now().Unix(),
+		Files:     map[uint32]uint32{},
+	}
+
+	return write(ctx, client, m, files, w)
+}
+
+// Incremental writes the entries written to the namespace since the previous backup to w.
+// The previous backup is the last backup of the chain, full or incremental.
+func Incremental(ctx context.Context, client *zdb.Client, previous Manifest, w io.Writer) (Manifest, error) {
+	if previous.Checksum == "" {
+		return Manifest{}, errors.New("previous backup has no checksum, it must be read with ReadManifest")
+	}
+
+	dirty, err := client.IndexDirty(ctx)
+	if err != nil {
+		return Manifest{}, fmt.Errorf("failed to list dirty index files: %w", err)
+	}
+
+	if err := client.IndexDirtyReset(ctx); err != nil {
+		return Manifest{}, fmt.Errorf("failed to reset dirty index files: %w", err)
+	}
+
+	current, err := currentDataFile(ctx, client, previous.Namespace)
+	if err != nil {
+		return Manifest{}, err
+	}
+
+	// new entries are only appended to the current data file, which may have been reported
+	// dirty after the list was read, so it is always read along with the files created since
+	// the previous backup.
+	seen := map[uint32]bool{}
+	files := []uint32{}
+	for _, f := range dirty {
+		if !seen[f] {
+			seen[f] = true
+			files = append(files, f)
+		}
+	}
+
+	last := uint32(0)
+	for f := range previous.Files {
+		if f > last {
+			last = f
+		}
+	}
+
+	for f := last; f <= current; f++ {
+		if !seen[f] {
+			seen[f] = true
+			files = append(files, f)
+		}
+	}
+
+	m := Manifest{
+		Namespace: previous.Namespace,
+		Type:      TypeIncremental,
+		Sequence:  previous.Sequence + 1,
+		Parent:    previous.Checksum,
+		Created:   time.Now().Unix(),
+		Files:     map[uint32]uint32{},
+	}
+
+	for f, offset := range previous.Files {
+		m.Files[f] = offset
+	}
+
+	return write(ctx, client, m, files, w)
+}
+
+// write reads the data files from the offsets of the manifest, and writes their entries to an archive.
+func write(ctx context.Context, client *zdb.Client, m Manifest, files []uint32, w io.Writer) (Manifest, error) {
+	aw, err := newArchiveWriter(w, m)
+	if err != nil {
+		return Manifest{}, err
+	}
+
+	for _, f := range files {
+		offset, ok := m.Files[f]
+		if !ok {
+			offset = zdb.DataHeaderSize
+		}
+
+		for {
+			if err := ctx.Err(); err != nil {
+				return Manifest{}, err
+			}
+
+			raw, err := client.DataRaw(ctx, f, offset)
+			if errors.Is(err, zdb.ErrNoDataEntry) {
+				break
+			}
+			if err != nil {
+				return Manifest{}, fmt.Errorf("failed to read data file %d at offset %d: %w", f, offset, err)
+			}
+
+			if !raw.Deleted() && crc32.ChecksumIEEE([]byte(raw.Payload)) != raw.Integrity {
+				return Manifest{}, fmt.Errorf("%w: key %x in data file %d at offset %d", ErrCorrupted, raw.Key, f, offset)
+			}
+
+			err = aw.write(Entry{
+				Key:       raw.Key,
+				Payload:   raw.Payload,
+				Flags:     raw.Flags,
+				Timestamp: raw.Timestamp,
+			})
+			if err != nil {
+				return Manifest{}, err
+			}
+
+			m.Entries++
+			offset += raw.Size()
+		}
+
+		m.Files[f] = offset
+	}
+
+	m.Checksum, err = aw.close(m)
+	if err != nil {
+		return Manifest{}, err
+	}
+
+	return m, nil
+}
+
+func currentDataFile(ctx context.Context, client *zdb.Client, namespace string) (uint32, error) {
+	info, err := client.NamespaceStats(ctx, namespace)
+	if err != nil {
+		return 0, fmt.Errorf("failed to get namespace info: %w", err)
+	}
+
+	current, err := strconv.ParseUint(info["data_current_id"], 10, 32)
+	if err != nil {
+		return 0, fmt.Errorf("invalid current data file id %q: %w", info["data_current_id"], err)
+	}
+
+	return uint32(current), nil
+}
+
+// ReadManifest reads a whole archive, checks its checksum, and returns its manifest.
+func ReadManifest(r io.Reader) (Manifest, error) {
+	ar, err := newArchiveReader(r)
+	if err != nil {
+		return Manifest{}, err
+	}
+
+	var count uint64
+	for {
+		_, err := ar.next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return Manifest{}, err
+		}
+
+		count++
+	}
+
+	if count != ar.manifest.Entries {
+		return Manifest{}, fmt.Errorf("%w: manifest lists %d entries, but %d were read", ErrInvalidArchive, ar.manifest.Entries, count)
+	}
+
+	return ar.manifest, nil
+}
+
+// Restore replays a full backup followed by its chain of incremental backups into the namespace
+// selected on the client, which should be empty. Every archive is verified before anything is written.
+func Restore(ctx context.Context, client *zdb.Client, archives ...io.ReadSeeker) error {
+	if len(archives) == 0 {
+		return errors.New("no backup to restore")
+	}
+
+	var previous Manifest
+	for idx, archive := range archives {
+		m, err := ReadManifest(archive)
+		if err != nil {
+			return fmt.Errorf("backup %d: %w", idx, err)
+		}
+
+		if err := checkChain(idx, previous, m); err != nil {
+			return err
+		}
+
+		if _, err := archive.Seek(0, io.SeekStart); err != nil {
+			return err
+		}
+
+		previous = m
+	}
+
+	for idx, archive := range archives {
+		if err := replay(ctx, client, archive); err != nil {
+			return fmt.Errorf("failed to restore backup %d: %w", idx, err)
+		}
+	}
+
+	return nil
+}
+
+func checkChain(idx int, previous, m Manifest) error {
+	if idx == 0 {
+		if m.Type != TypeFull {
+			return fmt.Errorf("%w: the first backup must be a full backup", ErrBrokenChain)
+		}
+
+		return nil
+	}
+
+	if m.Type != TypeIncremental || m.Parent != previous.Checksum || m.Sequence != previous.Sequence+1 || m.Namespace != previous.Namespace {
+		return fmt.Errorf("%w: backup %d with sequence %d", ErrBrokenChain, idx, m.Sequence)
+	}
+
+	return nil
+}
+
+func replay(ctx context.Context, client *zdb.Client, r io.Reader) error {
+	ar, err := newArchiveReader(r)
+	if err != nil {
+		return err
+	}
+
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		e, err := ar.next()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		if e.Flags&zdb.DataEntryDeleted == 0 {
+			if err := client.Set(ctx, e.Key, e.Payload); err != nil {
+				return err
+			}
+
+			continue
+		}
+
+		// an incremental backup may replay a deletion already restored
+		err = client.Delete(ctx, e.Key)
+		if err != nil && !errors.Is(err, zdb.ErrKeyNotFound) {
+			return err
+		}
+	}
+}
@@ -0,0 +1,172 @@
+package backup
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"testing"
+
+	"github.com/mariobassem/tendermint-zdb/pkg/zdb"
+	"github.com/mariobassem/tendermint-zdb/pkg/zdb/zdbtest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestClient(t *testing.T) (*zdb.Client, *zdbtest.Server) {
+	t.Helper()
+
+	server, err := zdbtest.NewServer()
+	require.NoError(t, err)
+	t.Cleanup(func() { server.Close() })
+
+	client := zdb.NewClient(server.Addr())
+	t.Cleanup(func() { client.Close() })
+
+	return &client, server
+}
+
+func readers(archives ...*bytes.Buffer) []io.ReadSeeker {
+	ret := make([]io.ReadSeeker, 0, len(archives))
+	for _, a := range archives {
+		ret = append(ret, bytes.NewReader(a.Bytes()))
+	}
+
+	return ret
+}
+
+func TestBackupRestore(t *testing.T) {
+	client, _ := newTestClient(t)
+	ctx := context.Background()
+
+	for i := 0; i < 20; i++ {
+		require.NoError(t, client.Set(ctx, fmt.Sprintf("k%d", i), fmt.Sprintf("v%d", i)))
+	}
+
+	var full bytes.Buffer
+	fullManifest, err := Full(ctx, client, "default", &full)
+	require.NoError(t, err)
+	assert.Equal(t, TypeFull, fullManifest.Type)
+	assert.Equal(t, uint64(20), fullManifest.Entries)
+	assert.NotEmpty(t, fullManifest.Checksum)
+
+	read, err := ReadManifest(bytes.NewReader(full.Bytes()))
+	require.NoError(t, err)
+	assert.Equal(t, fullManifest, read)
+
+	for i := 20; i < 40; i++ {
+		require.NoError(t, client.Set(ctx, fmt.Sprintf("k%d", i), fmt.Sprintf("v%d", i)))
+	}
+	require.NoError(t, client.Set(ctx, "k0", "updated"))
+	require.NoError(t, client.Delete(ctx, "k1"))
+
+	var first bytes.Buffer
+	firstManifest, err := Incremental(ctx, client, fullManifest, &first)
+	require.NoError(t, err)
+	assert.Equal(t, uint64(1), firstManifest.Sequence)
+	assert.Equal(t, fullManifest.Checksum, firstManifest.Parent)
+	assert.Equal(t, uint64(22), firstManifest.Entries)
+
+	require.NoError(t, client.Delete(ctx, "k2"))
+
+	var second bytes.Buffer
+	secondManifest, err := Incremental(ctx, client, firstManifest, &second)
+	require.NoError(t, err)
+	assert.Equal(t, uint64(1), secondManifest.Entries)
+
+	restored, _ := newTestClient(t)
+	require.NoError(t, Restore(ctx, restored, readers(&full, &first, &second)...))
+
+	for i := 0; i < 40; i++ {
+		key := fmt.Sprintf("k%d", i)
+
+		want, err := client.Get(ctx, key)
+		got, gotErr := restored.Get(ctx, key)
+		assert.Equal(t, err, gotErr, key)
+		assert.Equal(t, want, got, key)
+	}
+}
+
+func TestRestoreBrokenChain(t *testing.T) {
+	client, _ := newTestClient(t)
+	ctx := context.Background()
+
+	require.NoError(t, client.Set(ctx, "key", "value"))
+
+	var full bytes.Buffer
+	fullManifest, err := Full(ctx, client, "default", &full)
+	require.NoError(t, err)
+
+	var first, second bytes.Buffer
+	firstManifest, err := Incremental(ctx, client, fullManifest, &first)
+	require.NoError(t, err)
+	_, err = Incremental(ctx, client, firstManifest, &second)
+	require.NoError(t, err)
+
+	restored, _ := newTestClient(t)
+
+	err = Restore(ctx, restored, readers(&full, &second)...)
+	assert.ErrorIs(t, err, ErrBrokenChain)
+
+	err = Restore(ctx, restored, readers(&first)...)
+	assert.ErrorIs(t, err, ErrBrokenChain)
+
+	exists, err := restored.Exists(ctx, "key")
+	require.NoError(t, err)
+	assert.False(t, exists)
+}
+
+func TestRestoreInvalidArchive(t *testing.T) {
+	client, _ := newTestClient(t)
+	ctx := context.Background()
+
+	require.NoError(t, client.Set(ctx, "key", "value"))
+
+	var full bytes.Buffer
+	_, err := Full(ctx, client, "default", &full)
+	require.NoError(t, err)
+
+	data := full.Bytes()
+	data[bytes.Index(data, []byte("value"))] ^= 0xff
+
+	restored, _ := newTestClient(t)
+	err = Restore(ctx, restored, bytes.NewReader(data))
+	assert.ErrorIs(t, err, ErrInvalidArchive)
+
+	_, err = ReadManifest(bytes.NewReader(data[:len(data)-10]))
+	assert.ErrorIs(t, err, ErrInvalidArchive)
+}
+
+func TestBackupCorruptedEntry(t *testing.T) {
+	client, server := newTestClient(t)
+	ctx := context.Background()
+
+	require.NoError(t, client.Set(ctx, "key", "value"))
+	require.NoError(t, server.Corrupt("default", "key"))
+
+	_, err := Full(ctx, client, "default", io.Discard)
+	assert.ErrorIs(t, err, ErrCorrupted)
+}
+
+func TestBackupAccessDenied(t *testing.T) {
+	client, server := newTestClient(t)
+	ctx := context.Background()
+
+	require.NoError(t, client.NewNamespace(ctx, "app"))
+	require.NoError(t, client.SetNamespace(ctx, "app", "password", "secret"))
+	require.NoError(t, client.SelectSecure(ctx, "app", "secret"))
+	require.NoError(t, client.Set(ctx, "key", "value"))
+
+	// a public namespace can be selected without its password, but not read raw
+	reader := zdb.NewClient(server.Addr())
+	defer reader.Close()
+	require.NoError(t, reader.Select(ctx, "app"))
+
+	_, err := reader.DataRaw(ctx, 0, zdb.DataHeaderSize)
+	assert.ErrorIs(t, err, zdb.ErrPermissionDenied)
+	assert.NotErrorIs(t, err, zdb.ErrNoDataEntry)
+
+	var archive bytes.Buffer
+	_, err = Full(ctx, &reader, "app", &archive)
+	assert.ErrorIs(t, err, zdb.ErrPermissionDenied)
+}
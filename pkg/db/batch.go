@@ -28,6 +28,23 @@ var (
 
 var _ tmdb.Batch = (*ZDBBatch)(nil)
 
+// BatchError is returned by Write when operations of the batch failed. The operations which
+// succeeded are dropped from the batch, so Write can be called again to retry the others.
+type BatchError struct {
+	// Failed is the number of operations left in the batch.
+	Failed int
+	// Err is the error of the first failed operation, or of the connection.
+	Err error
+}
+
+func (e *BatchError) Error() string {
+	return fmt.Sprintf("batch write failed for %d operations: %s", e.Failed, e.Err)
+}
+
+func (e *BatchError) Unwrap() error {
+	return e.Err
+}
+
 // Set sets a key/value pair.
 // CONTRACT: key, value readonly []byte
 func (z *ZDBBatch) Set(key, value []byte) error {
@@ -70,7 +87,8 @@ func (z *ZDBBatch) Delete(key []byte) error {
 	return nil
 }
 
-// Write implements Batch. since ZDB don't support batch operations, it iteratively tries to execute writes.
+// Write implements Batch. since ZDB don't support batch operations, writes are pipelined, and
+// the operations that succeeded are dropped from the batch, so a failed write can be retried.
 func (z *ZDBBatch) Write() error {
 	z.Lock()
 	defer z.Unlock()
@@ -79,19 +97,48 @@ func (z *ZDBBatch) Write() error {
 		return ErrBatchClosed
 	}
 
-	for len(z.setOps) > 0 {
-		op := z.setOps[0]
-		if err := z.zdb.Set(op.key, op.val); err != nil {
-			return fmt.Errorf("batch write failed; try again")
+	if err := z.zdb.writable(); err != nil {
+		return err
+	}
+
+	z.zdb.commitMu.RLock()
+	defer z.zdb.commitMu.RUnlock()
+
+	cmds := make([][]interface{}, 0, len(z.setOps))
+	for _, op := range z.setOps {
+		stored, err := storageKey(op.key)
+		if err != nil {
+			return err
+		}
+
+		if isLongKey(stored) {
+			if err := z.zdb.checkCollision(stored, op.key); err != nil {
+				return err
+			}
 		}
 
-		z.setOps = z.setOps[1:]
+		val, err := z.zdb.encodeEntry(stored, op.key, op.val)
+		if err != nil {
+			return err
+		}
+
+		cmds = append(cmds, []interface{}{"SET", stored, val})
+	}
+
+	errs, err := z.zdb.doPipelined(cmds)
+	if err != nil {
+		return &BatchError{Failed: len(z.setOps) + len(z.delKeys), Err: err}
+	}
+
+	z.setOps, err = failedOps(z.setOps, errs)
+	if len(z.setOps) > 0 {
+		return &BatchError{Failed: len(z.setOps) + len(z.delKeys), Err: err}
 	}
 
 	for len(z.delKeys) > 0 {
 		key := z.delKeys[0]
-		if err := z.zdb.Delete(key); err != nil {
-			return fmt.Errorf("batch write failed; try again")
+		if err := z.zdb.delete(key); err != nil {
+			return &BatchError{Failed: len(z.delKeys), Err: err}
 		}
 
 		z.delKeys = z.delKeys[1:]
@@ -100,6 +147,22 @@ func (z *ZDBBatch) Write() error {
 	return nil
 }
 
+// failedOps returns the operations whose command failed, and the first error.
+func failedOps(ops []Op, errs []error) ([]Op, error) {
+	var first error
+	failed := ops[:0]
+	for idx, op := range ops {
+		if errs[idx] != nil {
+			failed = append(failed, op)
+			if first == nil {
+				first = errs[idx]
+			}
+		}
+	}
+
+	return failed, first
+}
+
 // WriteSync writes the batch and flushes it to disk. Only Close() can be called after, other
 // methods will error.
 func (z *ZDBBatch) WriteSync() error {
@@ -0,0 +1,74 @@
+package db
+
+import (
+	"time"
+
+	"github.com/mariobassem/tendermint-zdb/pkg/internal/breaker"
+)
+
+// ErrCircuitOpen is returned without sending the command while the circuit breaker is open.
+var ErrCircuitOpen = breaker.ErrOpen
+
+const (
+	DefaultBreakerErrorRate   = breaker.DefaultErrorRate
+	DefaultBreakerMinRequests = breaker.DefaultMinRequests
+	DefaultBreakerWindow      = breaker.DefaultWindow
+	DefaultBreakerOpenTimeout = breaker.DefaultOpenTimeout
+)
+
+// BreakerState is the state of a circuit breaker.
+type BreakerState = breaker.State
+
+const (
+	// BreakerClosed lets every command through.
+	BreakerClosed = breaker.Closed
+	// BreakerOpen fails every command with ErrCircuitOpen.
+	BreakerOpen = breaker.Open
+	// BreakerHalfOpen lets a few probe commands through, to decide whether to close again.
+	BreakerHalfOpen = breaker.HalfOpen
+)
+
+// BreakerOptions configures a CircuitBreaker.
+type BreakerOptions = breaker.Options
+
+// CircuitBreaker fails commands fast while ZDB is unhealthy, instead of letting every caller
+// wait for it. It opens when too many commands fail or are slow, or as soon as ZDB reports
+// its disk is full or it is read-only. Clones share the breaker of the instance they were
+// cloned from. The same breaker can be given to a zdb.Client with zdb.WithCircuitBreaker.
+type CircuitBreaker = breaker.Breaker
+
+func NewCircuitBreaker(opts BreakerOptions) *CircuitBreaker {
+	return breaker.New(opts)
+}
+
+// WithCircuitBreaker sends the commands through the circuit breaker.
+func WithCircuitBreaker(b *CircuitBreaker) Option {
+	return func(z *ZDB) {
+		z.breaker = b
+	}
+}
+
+// do sends a command, once admitted by the rate limiter and the circuit breaker. Writes of a
+// read-only ZDB are refused.
+func (z *ZDB) do(class OpClass, cmd string, args ...interface{}) (interface{}, error) {
+	if class == OpWrite && z.readOnly {
+		return nil, ErrReadOnlyMode
+	}
+
+	if err := z.throttle(class, 1); err != nil {
+		return nil, err
+	}
+
+	if err := z.breaker.Allow(); err != nil {
+		return nil, err
+	}
+
+	start := time.Now()
+	res, err := z.con.Do(cmd, args...)
+	err = serverError(err)
+	elapsed := time.Since(start)
+	z.breaker.Record(err, elapsed)
+	z.logCommand(cmd, args, elapsed, err)
+
+	return res, err
+}
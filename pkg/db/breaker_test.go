@@ -0,0 +1,62 @@
+package db
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestZDBCircuitBreaker(t *testing.T) {
+	_, server := newTestZDB(t)
+
+	b := NewCircuitBreaker(BreakerOptions{OpenTimeout: time.Hour})
+	z, err := NewZDB(server.Addr(), WithCircuitBreaker(b))
+	require.NoError(t, err)
+	defer z.Close()
+
+	require.NoError(t, z.Set([]byte("key"), []byte("value")))
+
+	_, err = z.con.Do("NSSET", "default", "maxsize", 1)
+	require.NoError(t, err)
+
+	// a full disk opens the breaker at once
+	err = z.Set([]byte("other"), []byte("value"))
+	assert.ErrorContains(t, err, "No space left")
+	assert.Equal(t, BreakerOpen, b.State())
+
+	_, err = z.Get([]byte("key"))
+	assert.ErrorIs(t, err, ErrCircuitOpen)
+
+	clone, err := z.Clone()
+	require.NoError(t, err)
+	defer clone.Close()
+
+	_, err = clone.Has([]byte("key"))
+	assert.ErrorIs(t, err, ErrCircuitOpen)
+
+	stats := z.Stats()
+	assert.Equal(t, "open", stats["circuit_breaker"])
+}
+
+func TestZDBCircuitBreakerBatch(t *testing.T) {
+	z, _ := newTestZDB(t)
+
+	b := NewCircuitBreaker(BreakerOptions{})
+	z.breaker = b
+
+	_, err := z.con.Do("NSSET", "default", "maxsize", 1)
+	require.NoError(t, err)
+
+	batch := z.NewBatch()
+	defer batch.Close()
+	require.NoError(t, batch.Set([]byte("key"), []byte("value")))
+	assert.Error(t, batch.Write())
+	assert.Equal(t, BreakerOpen, b.State())
+
+	batch = z.NewBatch()
+	defer batch.Close()
+	require.NoError(t, batch.Set([]byte("key"), []byte("value")))
+	assert.ErrorIs(t, batch.Write(), ErrCircuitOpen)
+}
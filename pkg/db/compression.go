@@ -0,0 +1,170 @@
+package db
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+	"sync"
+	"sync/atomic"
+
+	"github.com/klauspost/compress/snappy"
+	"github.com/klauspost/compress/zstd"
+)
+
+// Compression identifies the algorithm used to compress a stored value.
+type Compression byte
+
+const (
+	CompressionNone Compression = iota
+	CompressionSnappy
+	CompressionZstd
+)
+
+// DefaultCompressionMinSize is the default size in bytes below which values are stored uncompressed.
+const DefaultCompressionMinSize = 64
+
+// headerPrefix starts every value header written by this package. Uncompressed values
+// starting with it are written with a header, so they are never mistaken for one.
+var headerPrefix = []byte{0xc7, 'z'}
+
+// valueMagic starts the header of values written with a compression header. The header
+// is the magic followed by one byte holding the Compression. Values without the magic
+// were written uncompressed, so compressed and uncompressed values can coexist.
+var valueMagic = []byte{0xc7, 'z', 'v'}
+
+var (
+	zstdOnce    sync.Once
+	zstdEncoder *zstd.Encoder
+	zstdDecoder *zstd.Decoder
+	zstdErr     error
+)
+
+// compressionStats counts the bytes written before and after compression.
+type compressionStats struct {
+	raw    atomic.Uint64
+	stored atomic.Uint64
+}
+
+func (c Compression) String() string {
+	switch c {
+	case CompressionNone:
+		return "none"
+	case CompressionSnappy:
+		return "snappy"
+	case CompressionZstd:
+		return "zstd"
+	default:
+		return fmt.Sprintf("compression(%d)", byte(c))
+	}
+}
+
+func initZstd() error {
+	zstdOnce.Do(func() {
+		zstdEncoder, zstdErr = zstd.NewWriter(nil)
+		if zstdErr != nil {
+			return
+		}
+
+		zstdDecoder, zstdErr = zstd.NewReader(nil)
+	})
+
+	return zstdErr
+}
+
+// compressValue compresses the value with the configured algorithm and prepends the value header.
+// Values smaller than the configured minimum size, or which do not shrink, are stored uncompressed.
+func (z *ZDB) compressValue(val []byte) ([]byte, error) {
+	ret, err := z.compress(val)
+	if err != nil {
+		return nil, err
+	}
+
+	z.compressionStats.raw.Add(uint64(len(val)))
+	z.compressionStats.stored.Add(uint64(len(ret)))
+
+	return ret, nil
+}
+
+func (z *ZDB) compress(val []byte) ([]byte, error) {
+	if z.compression == CompressionNone || len(val) < z.compressionMinSize {
+		return withHeader(CompressionNone, val), nil
+	}
+
+	var compressed []byte
+	switch z.compression {
+	case CompressionSnappy:
+		compressed = snappy.Encode(nil, val)
+	case CompressionZstd:
+		if err := initZstd(); err != nil {
+			return nil, err
+		}
+		compressed = zstdEncoder.EncodeAll(val, nil)
+	default:
+		return nil, fmt.Errorf("unknown compression %s", z.compression)
+	}
+
+	if len(compressed)+len(valueMagic)+1 >= len(val) {
+		return withHeader(CompressionNone, val), nil
+	}
+
+	ret := make([]byte, 0, len(valueMagic)+1+len(compressed))
+	ret = append(ret, valueMagic...)
+	ret = append(ret, byte(z.compression))
+	ret = append(ret, compressed...)
+
+	return ret, nil
+}
+
+// withHeader only adds a header to uncompressed values if they could be mistaken for a
+// value with a header.
+func withHeader(c Compression, val []byte) []byte {
+	if c == CompressionNone && !bytes.HasPrefix(val, headerPrefix) {
+		return val
+	}
+
+	ret := make([]byte, 0, len(valueMagic)+1+len(val))
+	ret = append(ret, valueMagic...)
+	ret = append(ret, byte(c))
+	ret = append(ret, val...)
+
+	return ret
+}
+
+// decompressValue reverses compressValue, whatever compression the value was written with.
+func decompressValue(raw []byte) ([]byte, error) {
+	if !bytes.HasPrefix(raw, valueMagic) {
+		return raw, nil
+	}
+
+	if len(raw) < len(valueMagic)+1 {
+		return nil, fmt.Errorf("invalid value header of %d bytes", len(raw))
+	}
+
+	c := Compression(raw[len(valueMagic)])
+	data := raw[len(valueMagic)+1:]
+
+	switch c {
+	case CompressionNone:
+		return data, nil
+	case CompressionSnappy:
+		return snappy.Decode(nil, data)
+	case CompressionZstd:
+		if err := initZstd(); err != nil {
+			return nil, err
+		}
+		return zstdDecoder.DecodeAll(data, nil)
+	default:
+		return nil, fmt.Errorf("unknown compression %s", c)
+	}
+}
+
+// compressionRatio returns the ratio of uncompressed to stored bytes written through this adapter.
+func (z *ZDB) compressionRatio() string {
+	raw := z.compressionStats.raw.Load()
+	stored := z.compressionStats.stored.Load()
+	if stored == 0 {
+		return "1.00"
+	}
+
+	return strconv.FormatFloat(float64(raw)/float64(stored), 'f', 2, 64)
+}
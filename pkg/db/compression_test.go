@@ -0,0 +1,70 @@
+package db
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCompression(t *testing.T) {
+	for _, c := range []Compression{CompressionSnappy, CompressionZstd} {
+		t.Run(c.String(), func(t *testing.T) {
+			z, _ := newTestZDB(t)
+			z.compression = c
+
+			small := []byte("v")
+			large := bytes.Repeat([]byte("value"), 100)
+
+			assert.NoError(t, z.Set([]byte("small"), small))
+			assert.NoError(t, z.Set([]byte("large"), large))
+
+			raw, err := z.get([]byte("large"))
+			require.NoError(t, err)
+			assert.Less(t, len(raw), len(large))
+			assert.Equal(t, byte(c), raw[len(valueMagic)])
+
+			raw, err = z.get([]byte("small"))
+			require.NoError(t, err)
+			assert.Equal(t, small, raw)
+
+			got, err := z.Get([]byte("large"))
+			assert.NoError(t, err)
+			assert.Equal(t, large, got)
+
+			got, err = z.Get([]byte("small"))
+			assert.NoError(t, err)
+			assert.Equal(t, small, got)
+
+			stats := z.Stats()
+			assert.Equal(t, c.String(), stats["compression"])
+			assert.NotEqual(t, "1.00", stats["compression_ratio"])
+		})
+	}
+}
+
+func TestCompressionMixedValues(t *testing.T) {
+	z, _ := newTestZDB(t)
+
+	// a plain value that looks like it has a value header
+	tricky := append(append([]byte{}, valueMagic...), byte(CompressionZstd), 'x')
+	plain := bytes.Repeat([]byte("plain"), 100)
+
+	assert.NoError(t, z.Set([]byte("tricky"), tricky))
+	assert.NoError(t, z.Set([]byte("plain"), plain))
+
+	z.compression = CompressionZstd
+	compressed := bytes.Repeat([]byte("zstd"), 100)
+	assert.NoError(t, z.Set(bytes.Repeat([]byte("k"), 300), compressed))
+
+	for key, want := range map[string][]byte{
+		"tricky":                               tricky,
+		"plain":                                plain,
+		string(bytes.Repeat([]byte("k"), 300)): compressed,
+	} {
+		got, err := z.Get([]byte(key))
+		assert.NoError(t, err)
+		assert.Equal(t, want, got)
+	}
+}
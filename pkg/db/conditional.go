@@ -0,0 +1,305 @@
+package db
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// ErrConflict is returned by ConditionalBatch.Write when a key read through the batch changed
+// before it was written. Nothing was written, the batch can be built again and retried.
+var ErrConflict = errors.New("conflict, a read key changed")
+
+// ConditionalBatch is a batch of writes applied only if the keys read through it did not
+// change. Reads record the version of the keys, which is their cursor in ZDB, and writes are
+// buffered until Write.
+//
+// It is not a transaction: ZDB has no conditional or multi-key writes. Every write through
+// the ZDB and its clones, plain or batched, is ordered with the check of the versions and the
+// writes of a conditional batch, so a change by any of them is either detected or lands
+// after the batch. Writes by other connections or processes are not ordered, and one landing
+// between the check and the writes is overwritten. Writes failing half-way are reported with
+// a *PartialWriteError.
+type ConditionalBatch struct {
+	zdb    *ZDB
+	reads  map[string]conditionalRead
+	writes map[string]int
+	ops    []conditionalOp
+	closed bool
+
+	// beforeApply is called once the versions are checked, before the writes are sent.
+	beforeApply func()
+
+	sync.Mutex
+}
+
+// PartialWriteError is returned by ConditionalBatch.Write when writes failed after the
+// versions were checked. The other writes of the batch are applied.
+type PartialWriteError struct {
+	// Keys are the keys whose write failed. If the connection failed, they are all the keys
+	// of the batch, and each may or may not be written.
+	Keys [][]byte
+	// Err is the error of the first failed write, or of the connection.
+	Err error
+}
+
+func (e *PartialWriteError) Error() string {
+	return fmt.Sprintf("conditional batch partially applied, %d writes failed: %s", len(e.Keys), e.Err)
+}
+
+func (e *PartialWriteError) Unwrap() error {
+	return e.Err
+}
+
+type conditionalRead struct {
+	// version is the cursor of the key when it was first read, nil if it did not exist.
+	version []byte
+	value   []byte
+}
+
+type conditionalOp struct {
+	key    []byte
+	value  []byte
+	delete bool
+}
+
+// NewConditionalBatch creates a conditional batch using the connection of the ZDB. The caller
+// must call Write or Close.
+func (z *ZDB) NewConditionalBatch() *ConditionalBatch {
+	return &ConditionalBatch{
+		zdb:    z,
+		reads:  make(map[string]conditionalRead),
+		writes: make(map[string]int),
+	}
+}
+
+// Get returns the value of the key set in the batch, or else the value in ZDB, nil if it does
+// not exist. Reading a key again returns the value first read.
+// CONTRACT: key readonly []byte
+func (b *ConditionalBatch) Get(key []byte) ([]byte, error) {
+	b.Lock()
+	defer b.Unlock()
+
+	if b.closed {
+		return nil, ErrBatchClosed
+	}
+
+	if idx, ok := b.writes[string(key)]; ok {
+		return b.ops[idx].value, nil
+	}
+
+	if r, ok := b.reads[string(key)]; ok {
+		return r.value, nil
+	}
+
+	stored, err := storageKey(key)
+	if err != nil {
+		return nil, err
+	}
+
+	// the version is read before the value: if the key changes in between, the value may be
+	// newer than the version, and Write fails with a conflict
+	version, err := b.zdb.version(stored)
+	if err != nil {
+		return nil, err
+	}
+
+	value, err := b.zdb.Get(key)
+	if err != nil {
+		return nil, err
+	}
+
+	b.reads[string(key)] = conditionalRead{version: version, value: value}
+
+	return value, nil
+}
+
+// Has checks if a key exists, as seen by the batch.
+// CONTRACT: key readonly []byte
+func (b *ConditionalBatch) Has(key []byte) (bool, error) {
+	value, err := b.Get(key)
+
+	return value != nil, err
+}
+
+// Set buffers a write of the key.
+// CONTRACT: key, value readonly []byte
+func (b *ConditionalBatch) Set(key, value []byte) error {
+	if value == nil {
+		return errors.New("value cannot be nil")
+	}
+
+	return b.write(conditionalOp{key: key, value: value})
+}
+
+// Delete buffers a delete of the key.
+// CONTRACT: key readonly []byte
+func (b *ConditionalBatch) Delete(key []byte) error {
+	return b.write(conditionalOp{key: key, delete: true})
+}
+
+func (b *ConditionalBatch) write(op conditionalOp) error {
+	b.Lock()
+	defer b.Unlock()
+
+	if b.closed {
+		return ErrBatchClosed
+	}
+
+	if op.key == nil {
+		return errors.New("key cannot be nil")
+	}
+
+	if _, err := storageKey(op.key); err != nil {
+		return err
+	}
+
+	if idx, ok := b.writes[string(op.key)]; ok {
+		b.ops[idx] = op
+		return nil
+	}
+
+	b.writes[string(op.key)] = len(b.ops)
+	b.ops = append(b.ops, op)
+
+	return nil
+}
+
+// Write checks that none of the read keys changed, then applies the writes. It fails with
+// ErrConflict if a read key changed, nothing is written then, and with a *PartialWriteError
+// if some of the writes failed. The batch is closed after Write, even if it failed.
+func (b *ConditionalBatch) Write() error {
+	b.Lock()
+	defer b.Unlock()
+
+	if b.closed {
+		return ErrBatchClosed
+	}
+	b.closed = true
+
+	if len(b.ops) > 0 {
+		if err := b.zdb.writable(); err != nil {
+			return err
+		}
+	}
+
+	b.zdb.commitMu.Lock()
+	defer b.zdb.commitMu.Unlock()
+
+	if err := b.validate(); err != nil {
+		return err
+	}
+
+	if b.beforeApply != nil {
+		b.beforeApply()
+	}
+
+	return b.apply()
+}
+
+// Close drops the batch. It is idempotent.
+func (b *ConditionalBatch) Close() error {
+	b.Lock()
+	defer b.Unlock()
+
+	b.closed = true
+	return nil
+}
+
+// validate fails with ErrConflict if the version of a read key changed.
+func (b *ConditionalBatch) validate() error {
+	for key, r := range b.reads {
+		stored, err := storageKey([]byte(key))
+		if err != nil {
+			return err
+		}
+
+		version, err := b.zdb.version(stored)
+		if err != nil {
+			return err
+		}
+
+		if !bytes.Equal(version, r.version) {
+			return ErrConflict
+		}
+	}
+
+	return nil
+}
+
+// apply pipelines the writes of the batch.
+func (b *ConditionalBatch) apply() error {
+	cmds := make([][]interface{}, 0, len(b.ops))
+	keys := make([][]byte, 0, len(b.ops))
+	for _, op := range b.ops {
+		stored, err := storageKey(op.key)
+		if err != nil {
+			return err
+		}
+
+		if isLongKey(stored) {
+			err := b.zdb.checkCollision(stored, op.key)
+			if op.delete && errors.Is(err, ErrKeyCollision) {
+				continue
+			}
+			if err != nil {
+				return err
+			}
+		}
+
+		keys = append(keys, op.key)
+
+		if op.delete {
+			cmds = append(cmds, []interface{}{"DEL", stored})
+			continue
+		}
+
+		val, err := b.zdb.encodeEntry(stored, op.key, op.value)
+		if err != nil {
+			return err
+		}
+
+		cmds = append(cmds, []interface{}{"SET", stored, val})
+	}
+
+	if len(cmds) == 0 {
+		return nil
+	}
+
+	errs, err := b.zdb.doPipelined(cmds)
+	if err != nil {
+		return &PartialWriteError{Keys: keys, Err: err}
+	}
+
+	var failed [][]byte
+	for i, e := range errs {
+		// deleting a key which does not exist is not an error
+		if e == nil || errors.Is(e, ErrKeyNotFound) {
+			continue
+		}
+
+		if failed == nil {
+			err = e
+		}
+		failed = append(failed, keys[i])
+	}
+
+	if failed != nil {
+		return &PartialWriteError{Keys: failed, Err: err}
+	}
+
+	return nil
+}
+
+// version returns the cursor of the stored key, which changes on every write of the key, or
+// nil if it does not exist. ZDB ignores writes of the value a key already holds, so they
+// don't change its version.
+func (z *ZDB) version(stored []byte) ([]byte, error) {
+	cursor, err := z.keyCursor(stored)
+	if errors.Is(err, ErrKeyNotFound) {
+		return nil, nil
+	}
+
+	return cursor, err
+}
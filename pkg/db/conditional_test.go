@@ -0,0 +1,261 @@
+package db
+
+import (
+	"errors"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConditionalBatch(t *testing.T) {
+	z, _ := newTestZDB(t)
+
+	require.NoError(t, z.Set([]byte("a"), []byte("1")))
+	require.NoError(t, z.Set([]byte("b"), []byte("2")))
+
+	batch := z.NewConditionalBatch()
+	value, err := batch.Get([]byte("a"))
+	require.NoError(t, err)
+	assert.Equal(t, []byte("1"), value)
+
+	require.NoError(t, batch.Set([]byte("c"), value))
+	require.NoError(t, batch.Delete([]byte("b")))
+	require.NoError(t, batch.Delete([]byte("missing")))
+
+	// the batch reads its own writes, ZDB is unchanged until Write
+	value, err = batch.Get([]byte("c"))
+	require.NoError(t, err)
+	assert.Equal(t, []byte("1"), value)
+
+	has, err := batch.Has([]byte("b"))
+	require.NoError(t, err)
+	assert.False(t, has)
+
+	has, err = z.Has([]byte("b"))
+	require.NoError(t, err)
+	assert.True(t, has)
+
+	require.NoError(t, batch.Write())
+
+	value, err = z.Get([]byte("c"))
+	require.NoError(t, err)
+	assert.Equal(t, []byte("1"), value)
+
+	has, err = z.Has([]byte("b"))
+	require.NoError(t, err)
+	assert.False(t, has)
+
+	assert.ErrorIs(t, batch.Write(), ErrBatchClosed)
+	assert.ErrorIs(t, batch.Set([]byte("d"), []byte("4")), ErrBatchClosed)
+}
+
+func TestConditionalBatchConflict(t *testing.T) {
+	z, _ := newTestZDB(t)
+
+	other, err := z.Clone()
+	require.NoError(t, err)
+	defer other.Close()
+
+	require.NoError(t, z.Set([]byte("a"), []byte("1")))
+
+	batch := z.NewConditionalBatch()
+	_, err = batch.Get([]byte("a"))
+	require.NoError(t, err)
+	_, err = batch.Get([]byte("missing"))
+	require.NoError(t, err)
+	require.NoError(t, batch.Set([]byte("b"), []byte("2")))
+
+	// ZDB ignores writes of the value a key already holds, they don't conflict
+	require.NoError(t, other.Set([]byte("a"), []byte("1")))
+	require.NoError(t, other.Set([]byte("a"), []byte("2")))
+	assert.ErrorIs(t, batch.Write(), ErrConflict)
+
+	has, err := z.Has([]byte("b"))
+	require.NoError(t, err)
+	assert.False(t, has, "a conflicting batch must not write")
+
+	// creating a key read as missing conflicts as well
+	batch = z.NewConditionalBatch()
+	_, err = batch.Get([]byte("missing"))
+	require.NoError(t, err)
+	require.NoError(t, batch.Set([]byte("b"), []byte("2")))
+
+	require.NoError(t, other.Set([]byte("missing"), []byte("3")))
+	assert.ErrorIs(t, batch.Write(), ErrConflict)
+
+	// keys only written by the batch don't conflict
+	batch = z.NewConditionalBatch()
+	require.NoError(t, batch.Set([]byte("a"), []byte("4")))
+	require.NoError(t, other.Set([]byte("a"), []byte("5")))
+	require.NoError(t, batch.Write())
+
+	value, err := z.Get([]byte("a"))
+	require.NoError(t, err)
+	assert.Equal(t, []byte("4"), value)
+}
+
+func TestConditionalBatchLongKeys(t *testing.T) {
+	z, _ := newTestZDB(t)
+
+	key := make([]byte, MaxKeySize+1)
+	require.NoError(t, z.Set(key, []byte("1")))
+
+	batch := z.NewConditionalBatch()
+	value, err := batch.Get(key)
+	require.NoError(t, err)
+	assert.Equal(t, []byte("1"), value)
+	require.NoError(t, batch.Set(key, []byte("2")))
+	require.NoError(t, batch.Write())
+
+	value, err = z.Get(key)
+	require.NoError(t, err)
+	assert.Equal(t, []byte("2"), value)
+}
+
+func TestConditionalBatchConcurrentIncrements(t *testing.T) {
+	z, _ := newTestZDB(t)
+
+	const (
+		workers    = 4
+		increments = 20
+	)
+
+	var wg sync.WaitGroup
+	errs := make(chan error, workers)
+	for i := 0; i < workers; i++ {
+		c, err := z.Clone()
+		require.NoError(t, err)
+		defer c.Close()
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < increments; j++ {
+				if err := increment(c, []byte("counter")); err != nil {
+					errs <- err
+					return
+				}
+			}
+		}()
+	}
+
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		require.NoError(t, err)
+	}
+
+	value, err := z.Get([]byte("counter"))
+	require.NoError(t, err)
+	assert.Equal(t, strconv.Itoa(workers*increments), string(value))
+}
+
+// increment adds one to the counter, retrying on conflicts.
+func increment(z *ZDB, key []byte) error {
+	for {
+		batch := z.NewConditionalBatch()
+		value, err := batch.Get(key)
+		if err != nil {
+			return err
+		}
+
+		n := 0
+		if value != nil {
+			if n, err = strconv.Atoi(string(value)); err != nil {
+				return err
+			}
+		}
+
+		if err := batch.Set(key, []byte(strconv.Itoa(n+1))); err != nil {
+			return err
+		}
+
+		err = batch.Write()
+		if errors.Is(err, ErrConflict) {
+			continue
+		}
+
+		return err
+	}
+}
+
+func TestConditionalBatchReadOnly(t *testing.T) {
+	z, server := newTestZDB(t)
+	require.NoError(t, z.Set([]byte("a"), []byte("1")))
+
+	r, err := OpenReadOnly(server.Addr(), "")
+	require.NoError(t, err)
+	defer r.Close()
+
+	// batches which only read can be written, to check the reads were consistent
+	batch := r.NewConditionalBatch()
+	_, err = batch.Get([]byte("a"))
+	require.NoError(t, err)
+	require.NoError(t, batch.Write())
+
+	batch = r.NewConditionalBatch()
+	require.NoError(t, batch.Set([]byte("a"), []byte("2")))
+	assert.ErrorIs(t, batch.Write(), ErrReadOnlyMode)
+}
+
+func TestConditionalBatchPlainWrite(t *testing.T) {
+	z, _ := newTestZDB(t)
+
+	other, err := z.Clone()
+	require.NoError(t, err)
+	defer other.Close()
+
+	require.NoError(t, z.Set([]byte("a"), []byte("1")))
+
+	batch := z.NewConditionalBatch()
+	_, err = batch.Get([]byte("a"))
+	require.NoError(t, err)
+	require.NoError(t, batch.Set([]byte("a"), []byte("2")))
+
+	// a plain Set racing with the batch waits for its writes, it is not overwritten
+	done := make(chan error, 1)
+	batch.beforeApply = func() {
+		go func() {
+			done <- other.Set([]byte("a"), []byte("3"))
+		}()
+
+		select {
+		case err := <-done:
+			t.Errorf("plain write was not ordered after the batch")
+			done <- err
+		case <-time.After(50 * time.Millisecond):
+		}
+	}
+	require.NoError(t, batch.Write())
+	require.NoError(t, <-done)
+
+	value, err := z.Get([]byte("a"))
+	require.NoError(t, err)
+	assert.Equal(t, []byte("3"), value)
+}
+
+func TestConditionalBatchPartialWrite(t *testing.T) {
+	z, _ := newTestZDB(t)
+
+	_, err := z.con.Do("NSSET", "default", "maxsize", 64)
+	require.NoError(t, err)
+
+	batch := z.NewConditionalBatch()
+	require.NoError(t, batch.Set([]byte("small"), []byte("1")))
+	require.NoError(t, batch.Set([]byte("large"), make([]byte, 128)))
+
+	err = batch.Write()
+	assert.ErrorIs(t, err, ErrNamespaceFull)
+
+	var partial *PartialWriteError
+	require.ErrorAs(t, err, &partial)
+	assert.Equal(t, [][]byte{[]byte("large")}, partial.Keys)
+
+	value, err := z.Get([]byte("small"))
+	require.NoError(t, err)
+	assert.Equal(t, []byte("1"), value)
+}
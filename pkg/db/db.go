@@ -4,20 +4,54 @@ import (
 	"bytes"
 	"errors"
 	"fmt"
-	"log"
-	"strings"
+	"log/slog"
+	"sync"
+	"time"
 
 	"github.com/gomodule/redigo/redis"
+	"github.com/mariobassem/tendermint-zdb/pkg/internal/reply"
 	tmdb "github.com/tendermint/tm-db"
 )
 
 var _ tmdb.DB = (*ZDB)(nil)
 
-var ErrCursorNoMoreData = errors.New("No more data")
-var ErrKeyNotFound = errors.New("Key not found")
-
 type ZDB struct {
-	con redis.Conn
+	con       redis.Conn
+	address   string
+	namespace string
+	opts      []Option
+
+	compression        Compression
+	compressionMinSize int
+	compressionStats   *compressionStats
+
+	keyring *Keyring
+
+	limiter         *RateLimiter
+	priority        Priority
+	throttleTimeout time.Duration
+	breaker         *CircuitBreaker
+
+	logger  *slog.Logger
+	logKeys bool
+
+	readOnly bool
+
+	// commitMu orders the writes with conditional batches: plain writes hold it for reading,
+	// conditional batches for writing while they check and apply. It is shared by clones.
+	commitMu *sync.RWMutex
+}
+
+// Option configures a ZDB.
+type Option func(*ZDB)
+
+// WithCompression compresses values of at least minSize bytes with the given algorithm.
+// Values are readable whatever compression they were written with.
+func WithCompression(c Compression, minSize int) Option {
+	return func(z *ZDB) {
+		z.compression = c
+		z.compressionMinSize = minSize
+	}
 }
 
 type ScanResponse struct {
@@ -31,21 +65,198 @@ type KeyInfo struct {
 	Timestamp int64
 }
 
-func NewZDB(address string) (ZDB, error) {
+func NewZDB(address string, opts ...Option) (ZDB, error) {
 	con, err := redis.Dial("tcp", address)
 	if err != nil {
 		return ZDB{}, err
 	}
 
-	return ZDB{
-		con: con,
-	}, nil
+	z := ZDB{
+		con:                con,
+		address:            address,
+		opts:               opts,
+		compressionMinSize: DefaultCompressionMinSize,
+		compressionStats:   &compressionStats{},
+		commitMu:           &sync.RWMutex{},
+	}
+
+	for _, opt := range opts {
+		opt(&z)
+	}
+
+	return z, nil
+}
+
+// Clone opens a new connection to the same namespace with the same options. Background
+// jobs use their own connection, since a connection can't be used concurrently.
+func (z *ZDB) Clone() (*ZDB, error) {
+	c, err := NewZDB(z.address, z.opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	c.compressionStats = z.compressionStats
+	c.commitMu = z.commitMu
+
+	if z.namespace != "" {
+		if err := c.Select(z.namespace); err != nil {
+			c.Close()
+			return nil, err
+		}
+	}
+
+	return &c, nil
 }
 
 // Get fetches the value of the given key, or nil if it does not exist.
 // CONTRACT: key, value readonly []byte
 func (z *ZDB) Get(key []byte) ([]byte, error) {
-	res, err := redis.Bytes(z.con.Do("GET", key))
+	stored, err := storageKey(key)
+	if err != nil {
+		return nil, err
+	}
+
+	k, val, err := z.readEntry(stored)
+	if err != nil || k == nil {
+		return nil, err
+	}
+
+	if !bytes.Equal(k, key) {
+		return nil, nil
+	}
+
+	return val, nil
+}
+
+// Entry returns the key and value held by a key returned by a scan, or nil if it does not
+// exist anymore. Scans return keys as stored in ZDB, where keys longer than MaxKeySize are
+// stored under a hash.
+func (z *ZDB) Entry(stored []byte) (key []byte, value []byte, err error) {
+	return z.readEntry(stored)
+}
+
+// EntryKey returns the key held by a key returned by a scan, without reading its value unless
+// it is a key longer than MaxKeySize, stored under a hash. It returns nil if a long key does not
+// exist anymore.
+func (z *ZDB) EntryKey(stored []byte) ([]byte, error) {
+	if !isLongKey(stored) {
+		return stored, nil
+	}
+
+	key, _, err := z.readEntry(stored)
+
+	return key, err
+}
+
+// readEntry fetches a stored key and returns the key and value it holds, or nil if it
+// does not exist.
+func (z *ZDB) readEntry(stored []byte) (key []byte, val []byte, err error) {
+	raw, err := z.get(stored)
+	if err != nil || raw == nil {
+		return nil, nil, err
+	}
+
+	raw, err = z.decryptValue(stored, raw)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	raw, err = decompressValue(raw)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to decompress value of %x: %w", stored, err)
+	}
+
+	return decodeEntry(stored, raw)
+}
+
+// writeEntry stores the key and value under the stored key.
+func (z *ZDB) writeEntry(stored, key, val []byte) error {
+	val, err := z.encodeEntry(stored, key, val)
+	if err != nil {
+		return err
+	}
+
+	_, err = z.do(OpWrite, "SET", stored, val)
+	return err
+}
+
+// encodeEntry returns the value stored in ZDB for the key and value.
+func (z *ZDB) encodeEntry(stored, key, val []byte) ([]byte, error) {
+	if isLongKey(stored) {
+		val = encodeLongEntry(key, val)
+	}
+
+	val, err := z.compressValue(val)
+	if err != nil {
+		return nil, err
+	}
+
+	return z.encryptValue(stored, val)
+}
+
+// doPipelined sends all commands before reading their replies, saving a round trip per
+// command. It returns the error reply of every command, or an error if the connection failed.
+func (z *ZDB) doPipelined(cmds [][]interface{}) ([]error, error) {
+	if err := z.writable(); err != nil {
+		return nil, err
+	}
+
+	if err := z.throttle(OpWrite, len(cmds)); err != nil {
+		return nil, err
+	}
+
+	if err := z.breaker.Allow(); err != nil {
+		return nil, err
+	}
+
+	start := time.Now()
+	errs, err := z.sendPipelined(cmds)
+	z.logPipeline(len(cmds), time.Since(start), errs, err)
+	if err == nil {
+		// the first error reply tells whether ZDB refuses writes
+		for _, e := range errs {
+			if e != nil {
+				err = e
+				break
+			}
+		}
+	}
+	z.breaker.Record(err, time.Since(start))
+
+	if isServerError(err) {
+		return errs, nil
+	}
+
+	return errs, err
+}
+
+func (z *ZDB) sendPipelined(cmds [][]interface{}) ([]error, error) {
+	for _, cmd := range cmds {
+		if err := z.con.Send(cmd[0].(string), cmd[1:]...); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := z.con.Flush(); err != nil {
+		return nil, err
+	}
+
+	errs := make([]error, len(cmds))
+	for idx := range cmds {
+		_, err := z.con.Receive()
+		err = serverError(err)
+		if err != nil && !isServerError(err) {
+			return nil, err
+		}
+
+		errs[idx] = err
+	}
+
+	return errs, nil
+}
+
+func (z *ZDB) get(stored []byte) ([]byte, error) {
+	res, err := redis.Bytes(z.do(OpRead, "GET", stored))
 	if err != nil && errors.Is(err, redis.ErrNil) {
 		return nil, nil
 	}
@@ -59,14 +270,45 @@ func (z *ZDB) Get(key []byte) ([]byte, error) {
 // Has checks if a key exists.
 // CONTRACT: key, value readonly []byte
 func (z *ZDB) Has(key []byte) (bool, error) {
-	return redis.Bool(z.con.Do("EXISTS", key))
+	return z.Exists(key)
 }
 
 // Set sets the value for the given key, replacing it if it already exists.
 // CONTRACT: key, value readonly []byte
 func (z *ZDB) Set(key, val []byte) error {
-	_, err := z.con.Do("SET", key, val)
-	return err
+	if err := z.writable(); err != nil {
+		return err
+	}
+
+	z.commitMu.RLock()
+	defer z.commitMu.RUnlock()
+
+	stored, err := storageKey(key)
+	if err != nil {
+		return err
+	}
+
+	if isLongKey(stored) {
+		if err := z.checkCollision(stored, key); err != nil {
+			return err
+		}
+	}
+
+	return z.writeEntry(stored, key, val)
+}
+
+// checkCollision fails if the stored key already holds an entry for a different key.
+func (z *ZDB) checkCollision(stored, key []byte) error {
+	k, _, err := z.readEntry(stored)
+	if err != nil || k == nil {
+		return err
+	}
+
+	if !bytes.Equal(k, key) {
+		return ErrKeyCollision
+	}
+
+	return nil
 }
 
 // SetSync sets the value for the given key, and flushes it to storage before returning.
@@ -77,7 +319,34 @@ func (z *ZDB) SetSync(key, val []byte) error {
 // Delete deletes the key, or does nothing if the key does not exist.
 // CONTRACT: key readonly []byte
 func (z *ZDB) Delete(key []byte) error {
-	_, err := z.con.Do("DEL", key)
+	if err := z.writable(); err != nil {
+		return err
+	}
+
+	z.commitMu.RLock()
+	defer z.commitMu.RUnlock()
+
+	return z.delete(key)
+}
+
+// delete deletes the key, the caller holds commitMu.
+func (z *ZDB) delete(key []byte) error {
+	stored, err := storageKey(key)
+	if err != nil {
+		return err
+	}
+
+	if isLongKey(stored) {
+		err := z.checkCollision(stored, key)
+		if errors.Is(err, ErrKeyCollision) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	_, err = z.do(OpWrite, "DEL", stored)
 	return err
 }
 
@@ -93,57 +362,7 @@ func (z *ZDB) DeleteSync(key []byte) error {
 // CONTRACT: No writes may happen within a domain while an iterator exists over it.
 // CONTRACT: start, end readonly []byte
 func (z *ZDB) Iterator(start, end []byte) (tmdb.Iterator, error) {
-	log.Printf("iterator start: %v, end: %v", start, end)
-
-	startCursor, err := z.KeyCursor(start)
-	if err != nil && err.Error() == ErrKeyNotFound.Error() {
-		return &zdbIterator{
-			zdb:     z,
-			start:   start,
-			end:     end,
-			forward: true,
-			valid:   false,
-		}, nil
-	}
-	if err != nil {
-		return nil, fmt.Errorf("failed to get key cursor for %v: %w", start, err)
-	}
-
-	scanResponse, err := z.getScanResponse(startCursor)
-	if err != nil {
-		return nil, fmt.Errorf("failed to get scan result: %w", err)
-	}
-
-	keys := make([][]byte, 0, len(scanResponse.Keys)+1)
-
-	keys = append(keys, start)
-	for _, k := range scanResponse.Keys {
-		if bytes.Equal(k.Key, end) {
-			break
-		}
-
-		keys = append(keys, k.Key)
-	}
-
-	iterator := zdbIterator{
-		zdb:         z,
-		start:       start,
-		end:         end,
-		nextCursor:  scanResponse.Next,
-		scannedKeys: keys,
-		forward:     true,
-		valid:       true,
-	}
-
-	return &iterator, nil
-}
-
-func (z *ZDB) getScanResponse(start []byte) (ScanResponse, error) {
-	if start == nil {
-		return z.Scan()
-	}
-
-	return z.ScanCursor(start)
+	return z.newIterator(start, end, true)
 }
 
 // ReverseIterator returns an iterator over a domain of keys, in descending order. The caller
@@ -153,55 +372,89 @@ func (z *ZDB) getScanResponse(start []byte) (ScanResponse, error) {
 // CONTRACT: No writes may happen within a domain while an iterator exists over it.
 // CONTRACT: start, end readonly []byte
 func (z *ZDB) ReverseIterator(start, end []byte) (tmdb.Iterator, error) {
-	startCursor, err := z.KeyCursor(start)
-	if err != nil && err.Error() == ErrKeyNotFound.Error() {
-		return &zdbIterator{
-			zdb:     z,
-			forward: false,
-			valid:   false,
-			start:   start,
-			end:     end,
-		}, nil
+	return z.newIterator(start, end, false)
+}
+
+func (z *ZDB) newIterator(start, end []byte, forward bool) (*zdbIterator, error) {
+	z.logIterator(start, end, forward)
+
+	iterator := &zdbIterator{
+		zdb:     z,
+		start:   start,
+		end:     end,
+		forward: forward,
 	}
-	if err != nil {
-		return nil, fmt.Errorf("failed to get key cursor for %v: %w", start, err)
+
+	var err error
+	if end != nil {
+		iterator.storedEnd, err = storageKey(end)
+		if err != nil {
+			return nil, err
+		}
 	}
 
-	scanResponse, err := z.getRScanResponse(startCursor)
+	var scanResponse ScanResponse
+	keys := make([][]byte, 0)
+
+	var startCursor []byte
+	if start != nil {
+		storedStart, err := storageKey(start)
+		if err != nil {
+			return nil, err
+		}
+
+		startCursor, err = z.keyCursor(storedStart)
+		if errors.Is(err, ErrKeyNotFound) {
+			return iterator, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to get key cursor for %v: %w", start, err)
+		}
+
+		keys = append(keys, storedStart)
+	}
+
+	scanResponse, err = z.scan(startCursor, forward)
+
+	if errors.Is(err, ErrCursorNoMoreData) {
+		iterator.scannedKeys = keys
+		iterator.exhausted = true
+		iterator.valid = len(keys) > 0
+		return iterator, nil
+	}
 	if err != nil {
 		return nil, fmt.Errorf("failed to get scan result: %w", err)
 	}
 
-	keys := make([][]byte, 0, len(scanResponse.Keys)+1)
-
-	keys = append(keys, start)
 	for _, k := range scanResponse.Keys {
-		if bytes.Equal(k.Key, end) {
+		if bytes.Equal(k.Key, iterator.storedEnd) {
+			iterator.exhausted = true
 			break
 		}
 
 		keys = append(keys, k.Key)
 	}
 
-	iterator := zdbIterator{
-		zdb:         z,
-		start:       start,
-		end:         end,
-		nextCursor:  scanResponse.Next,
-		scannedKeys: keys,
-		forward:     false,
-		valid:       true,
-	}
+	iterator.nextCursor = scanResponse.Next
+	iterator.scannedKeys = keys
+	iterator.valid = len(keys) > 0
 
-	return &iterator, nil
+	return iterator, nil
 }
 
-func (z *ZDB) getRScanResponse(start []byte) (ScanResponse, error) {
-	if start == nil {
+// scan returns the keys after the cursor in the given direction, a nil cursor
+// starts from the first key, or the last key when scanning in reverse.
+func (z *ZDB) scan(cursor []byte, forward bool) (ScanResponse, error) {
+	switch {
+	case forward && cursor == nil:
+		return z.Scan()
+	case forward:
+		return z.ScanCursor(cursor)
+	case cursor == nil:
 		return z.ReverseScan()
+	default:
+		return z.ReverseScanCursor(cursor)
 	}
-
-	return z.ReverseScanCursor(start)
 }
 
 // Close closes the database connection.
@@ -227,40 +480,25 @@ func (z *ZDB) Print() error {
 // Stats returns a map of property values for all keys and the size of the cache.
 func (z *ZDB) Stats() map[string]string {
 	res, err := redis.String(z.con.Do("INFO"))
+	err = serverError(err)
 	if err != nil {
-		log.Printf("failed to get db info: %s", err.Error())
+		z.log().Error("failed to get zdb info", "namespace", z.logNamespace(), "error", err)
 		return nil
 	}
 
-	stats, err := parseInfoResponse(res)
-	if err != nil {
-		log.Printf("failed to get db info: %s", err.Error())
-		return nil
+	stats := reply.Info(res)
+	stats["compression"] = z.compression.String()
+	stats["compression_ratio"] = z.compressionRatio()
+	z.rateLimitStats(stats)
+	if z.breaker != nil {
+		stats["circuit_breaker"] = z.breaker.State().String()
 	}
 
 	return stats
 }
 
-func parseInfoResponse(res string) (map[string]string, error) {
-	slice := strings.Split(res, "\n")
-	parsed := make(map[string]string, len(slice))
-	for _, s := range slice {
-		key, value, found := strings.Cut(s, ":")
-		if !found {
-			continue
-		}
-
-		parsed[key] = strings.Trim(value, " \r\n")
-	}
-
-	return parsed, nil
-}
-
 func (z *ZDB) Scan() (ScanResponse, error) {
-	res, err := redis.Values(z.con.Do("SCAN"))
-	if err != nil && err.Error() == ErrCursorNoMoreData.Error() {
-		return ScanResponse{}, ErrCursorNoMoreData
-	}
+	res, err := redis.Values(z.do(OpScan, "SCAN"))
 	if err != nil {
 		return ScanResponse{}, err
 	}
@@ -269,10 +507,7 @@ func (z *ZDB) Scan() (ScanResponse, error) {
 }
 
 func (z *ZDB) ScanCursor(cursor []byte) (ScanResponse, error) {
-	res, err := redis.Values(z.con.Do("SCAN", cursor))
-	if err != nil && err.Error() == ErrCursorNoMoreData.Error() {
-		return ScanResponse{}, ErrCursorNoMoreData
-	}
+	res, err := redis.Values(z.do(OpScan, "SCAN", cursor))
 	if err != nil {
 		return ScanResponse{}, err
 	}
@@ -281,10 +516,7 @@ func (z *ZDB) ScanCursor(cursor []byte) (ScanResponse, error) {
 }
 
 func (z *ZDB) ReverseScan() (ScanResponse, error) {
-	res, err := redis.Values(z.con.Do("RSCAN"))
-	if err != nil && err.Error() == ErrCursorNoMoreData.Error() {
-		return ScanResponse{}, ErrCursorNoMoreData
-	}
+	res, err := redis.Values(z.do(OpScan, "RSCAN"))
 	if err != nil {
 		return ScanResponse{}, err
 	}
@@ -293,10 +525,7 @@ func (z *ZDB) ReverseScan() (ScanResponse, error) {
 }
 
 func (z *ZDB) ReverseScanCursor(cursor []byte) (ScanResponse, error) {
-	res, err := redis.Values(z.con.Do("RSCAN", cursor))
-	if err != nil && err.Error() == ErrCursorNoMoreData.Error() {
-		return ScanResponse{}, ErrCursorNoMoreData
-	}
+	res, err := redis.Values(z.do(OpScan, "RSCAN", cursor))
 	if err != nil {
 		return ScanResponse{}, err
 	}
@@ -305,64 +534,33 @@ func (z *ZDB) ReverseScanCursor(cursor []byte) (ScanResponse, error) {
 }
 
 func parseScanResponse(res []interface{}) (ScanResponse, error) {
-	if len(res) != 2 {
-		return ScanResponse{}, fmt.Errorf("invalid response, scan operations should return two elements, but %d were returned", len(res))
-	}
-
-	nextCursor, ok := res[0].(string)
-	if !ok {
-		return ScanResponse{}, fmt.Errorf("invalid response, expected next key to be string, but a %t was returned", res[0])
-	}
-
-	keys, ok := res[1].([]interface{})
-	if !ok {
-		return ScanResponse{}, fmt.Errorf("invalid response, expected keys to be a slice, but a %t was returned", res[1])
+	scan, err := reply.Scan(res)
+	if err != nil {
+		return ScanResponse{}, err
 	}
 
-	ret := make([]KeyInfo, 0, len(keys))
-
-	for _, k := range keys {
-		x, ok := k.([]interface{})
-		if !ok {
-			return ScanResponse{}, fmt.Errorf("invalid response, expected key information to be a slice, but a %t was returned", k)
-		}
-
-		if len(x) != 3 {
-			return ScanResponse{}, fmt.Errorf("invalid response, expected key information to be a slice with 3 elements, but %d elements were returned", len(x))
-		}
-
-		key, ok := x[0].(string)
-		if !ok {
-			return ScanResponse{}, fmt.Errorf("invalid response, expected key to be a string, but a %t was returned", x[0])
-		}
-
-		size, ok := x[1].(int64)
-		if !ok {
-			return ScanResponse{}, fmt.Errorf("invalid response, expected key size to be a int64, but a %t was returned", x[1])
-		}
-
-		ts, ok := x[2].(int64)
-		if !ok {
-			return ScanResponse{}, fmt.Errorf("invalid response, expected key creation timestamp to be an int64, but a %t was returned", x[2])
-		}
-
-		info := KeyInfo{
-			Key:       []byte(key),
-			Size:      uint64(size),
-			Timestamp: ts,
-		}
-
-		ret = append(ret, info)
+	keys := make([]KeyInfo, 0, len(scan.Keys))
+	for _, k := range scan.Keys {
+		keys = append(keys, KeyInfo(k))
 	}
 
 	return ScanResponse{
-		Next: []byte(nextCursor),
-		Keys: ret,
+		Next: scan.Next,
+		Keys: keys,
 	}, nil
 }
 
 func (z *ZDB) KeyCursor(key []byte) ([]byte, error) {
-	return redis.Bytes(z.con.Do("KEYCUR", key))
+	stored, err := storageKey(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return z.keyCursor(stored)
+}
+
+func (z *ZDB) keyCursor(stored []byte) ([]byte, error) {
+	return redis.Bytes(z.do(OpRead, "KEYCUR", stored))
 }
 
 func (z *ZDB) Ping() error {
@@ -375,20 +573,51 @@ func (z *ZDB) Ping() error {
 }
 
 func (z *ZDB) Exists(key []byte) (bool, error) {
-	return redis.Bool(z.con.Do("EXISTS", key))
+	stored, err := storageKey(key)
+	if err != nil {
+		return false, err
+	}
+
+	if !isLongKey(stored) {
+		return z.exists(stored)
+	}
+
+	val, err := z.Get(key)
+	if err != nil {
+		return false, err
+	}
+
+	return val != nil, nil
+}
+
+func (z *ZDB) exists(stored []byte) (bool, error) {
+	return redis.Bool(z.do(OpRead, "EXISTS", stored))
 }
 
 func (z *ZDB) NewNamespace(ns string) error {
+	if err := z.writable(); err != nil {
+		return err
+	}
+
 	_, err := z.con.Do("NSNEW", ns)
-	return err
+	return serverError(err)
 }
 
 func (z *ZDB) Select(ns string) error {
 	_, err := z.con.Do("SELECT", ns)
-	return err
+	if err != nil {
+		return serverError(err)
+	}
+
+	z.namespace = ns
+	return nil
 }
 
 func (z *ZDB) DeleteNamespace(ns string) error {
+	if err := z.writable(); err != nil {
+		return err
+	}
+
 	_, err := z.con.Do("DELETE", ns)
-	return err
+	return serverError(err)
 }
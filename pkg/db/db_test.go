@@ -0,0 +1,121 @@
+package db
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/mariobassem/tendermint-zdb/pkg/zdb/zdbtest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestZDB(t *testing.T) (*ZDB, *zdbtest.Server) {
+	t.Helper()
+
+	server, err := zdbtest.NewServer()
+	require.NoError(t, err)
+	t.Cleanup(func() { server.Close() })
+
+	z, err := NewZDB(server.Addr())
+	require.NoError(t, err)
+	t.Cleanup(func() { z.Close() })
+
+	return &z, server
+}
+
+func TestLongKeys(t *testing.T) {
+	z, _ := newTestZDB(t)
+
+	key := bytes.Repeat([]byte("k"), 300)
+	want := []byte("v1")
+
+	err := z.Set(key, want)
+	assert.NoError(t, err)
+
+	got, err := z.Get(key)
+	assert.NoError(t, err)
+	assert.Equal(t, want, got)
+
+	has, err := z.Has(key)
+	assert.NoError(t, err)
+	assert.True(t, has)
+
+	other := bytes.Repeat([]byte("k"), 301)
+	got, err = z.Get(other)
+	assert.NoError(t, err)
+	assert.Nil(t, got)
+
+	err = z.Delete(key)
+	assert.NoError(t, err)
+
+	has, err = z.Has(key)
+	assert.NoError(t, err)
+	assert.False(t, has)
+}
+
+func TestLongKeyCollision(t *testing.T) {
+	z, _ := newTestZDB(t)
+
+	key := bytes.Repeat([]byte("k"), 300)
+	stored, err := storageKey(key)
+	assert.NoError(t, err)
+
+	// simulate another key hashing to the same stored key
+	other := bytes.Repeat([]byte("x"), 300)
+	_, err = z.con.Do("SET", stored, encodeLongEntry(other, []byte("v")))
+	assert.NoError(t, err)
+
+	err = z.Set(key, []byte("v"))
+	assert.ErrorIs(t, err, ErrKeyCollision)
+
+	got, err := z.Get(key)
+	assert.NoError(t, err)
+	assert.Nil(t, got)
+}
+
+func TestReservedKey(t *testing.T) {
+	z, _ := newTestZDB(t)
+
+	err := z.Set(append(longKeyPrefix, 'k'), []byte("v"))
+	assert.ErrorIs(t, err, ErrReservedKey)
+}
+
+func TestLongKeysBatchAndIterator(t *testing.T) {
+	z, _ := newTestZDB(t)
+
+	keys := [][]byte{
+		[]byte("short"),
+		bytes.Repeat([]byte("a"), 256),
+		[]byte("middle"),
+		bytes.Repeat([]byte("b"), 1024),
+	}
+
+	batch := z.NewBatch()
+	for idx, k := range keys {
+		assert.NoError(t, batch.Set(k, []byte{byte(idx)}))
+	}
+	assert.NoError(t, batch.Write())
+	assert.NoError(t, batch.Close())
+
+	it, err := z.Iterator(nil, nil)
+	assert.NoError(t, err)
+
+	idx := 0
+	for ; it.Valid(); it.Next() {
+		assert.Equal(t, keys[idx], it.Key())
+		assert.Equal(t, []byte{byte(idx)}, it.Value())
+		idx++
+	}
+	assert.NoError(t, it.Error())
+	assert.Equal(t, len(keys), idx)
+	assert.NoError(t, it.Close())
+
+	it, err = z.ReverseIterator(keys[3], keys[0])
+	assert.NoError(t, err)
+
+	got := make([][]byte, 0)
+	for ; it.Valid(); it.Next() {
+		got = append(got, it.Key())
+	}
+	assert.Equal(t, [][]byte{keys[3], keys[2], keys[1]}, got)
+}
@@ -0,0 +1,30 @@
+package dbbench
+
+import (
+	"flag"
+	"testing"
+)
+
+var benchZDB = flag.String("zdb", "", "address of a 0-db server to benchmark, besides the stand-in")
+
+func backends() []Backend {
+	backends := []Backend{MemDB(), GoLevelDB(), ZDBStandIn()}
+	if *benchZDB != "" {
+		backends = append(backends, ZDB(*benchZDB))
+	}
+
+	return backends
+}
+
+// BenchmarkBackends runs every workload on every backend:
+//
+//	go test ./pkg/db/dbbench -run - -bench . -zdb localhost:9900
+func BenchmarkBackends(b *testing.B) {
+	for _, w := range Workloads() {
+		for _, backend := range backends() {
+			b.Run(w.Name+"/"+backend.Name, func(b *testing.B) {
+				Bench(b, backend, w, Options{})
+			})
+		}
+	}
+}
@@ -0,0 +1,239 @@
+package dbbench
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"runtime"
+	"testing"
+
+	"github.com/mariobassem/tendermint-zdb/pkg/db"
+	"github.com/mariobassem/tendermint-zdb/pkg/zdb/zdbtest"
+	tmdb "github.com/tendermint/tm-db"
+)
+
+// Backend opens a new, empty database for every workload.
+type Backend struct {
+	Name string
+	// Open returns the database, and a function releasing it.
+	Open func() (tmdb.DB, func(), error)
+}
+
+// MemDB is tm-db's in-memory backend.
+func MemDB() Backend {
+	return Backend{
+		Name: "memdb",
+		Open: func() (tmdb.DB, func(), error) {
+			return tmdb.NewMemDB(), func() {}, nil
+		},
+	}
+}
+
+// GoLevelDB is tm-db's goleveldb backend, its databases are created in temporary directories.
+func GoLevelDB() Backend {
+	return Backend{
+		Name: "goleveldb",
+		Open: func() (tmdb.DB, func(), error) {
+			dir, err := os.MkdirTemp("", "dbbench")
+			if err != nil {
+				return nil, nil, err
+			}
+
+			ldb, err := tmdb.NewGoLevelDB("bench", dir)
+			if err != nil {
+				os.RemoveAll(dir)
+				return nil, nil, err
+			}
+
+			return ldb, func() {
+				ldb.Close()
+				os.RemoveAll(dir)
+			}, nil
+		},
+	}
+}
+
+// ZDBStandIn is a ZDB connected to a local zdbtest server, it measures the client and the
+// protocol without the disk of a real server.
+func ZDBStandIn(opts ...db.Option) Backend {
+	return Backend{
+		Name: "zdb-standin",
+		Open: func() (tmdb.DB, func(), error) {
+			server, err := zdbtest.NewServer()
+			if err != nil {
+				return nil, nil, err
+			}
+
+			z, err := db.NewZDB(server.Addr(), opts...)
+			if err != nil {
+				server.Close()
+				return nil, nil, err
+			}
+
+			return &z, func() {
+				z.Close()
+				server.Close()
+			}, nil
+		},
+	}
+}
+
+// ZDB is a ZDB connected to a 0-db server, every workload runs in a new namespace which is
+// deleted afterwards.
+func ZDB(address string, opts ...db.Option) Backend {
+	count := 0
+
+	return Backend{
+		Name: "zdb",
+		Open: func() (tmdb.DB, func(), error) {
+			count++
+			namespace := fmt.Sprintf("dbbench-%d-%d", os.Getpid(), count)
+
+			z, err := db.NewZDB(address, opts...)
+			if err != nil {
+				return nil, nil, err
+			}
+
+			if err := z.NewNamespace(namespace); err != nil {
+				z.Close()
+				return nil, nil, fmt.Errorf("failed to create namespace %s: %w", namespace, err)
+			}
+
+			if err := z.Select(namespace); err != nil {
+				z.Close()
+				return nil, nil, fmt.Errorf("failed to select namespace %s: %w", namespace, err)
+			}
+
+			return &z, func() {
+				z.Select("default")
+				z.DeleteNamespace(namespace)
+				z.Close()
+			}, nil
+		},
+	}
+}
+
+// Result is the measure of a workload on a backend.
+type Result struct {
+	Backend  string `json:"backend"`
+	Workload string `json:"workload"`
+	// N is the number of operations measured.
+	N           int     `json:"n"`
+	NsPerOp     int64   `json:"ns_per_op"`
+	MBPerSec    float64 `json:"mb_per_sec,omitempty"`
+	AllocsPerOp int64   `json:"allocs_per_op"`
+	BytesPerOp  int64   `json:"bytes_per_op"`
+}
+
+// Report holds the results of every workload on every backend, with what is needed to run
+// them again.
+type Report struct {
+	GoVersion string   `json:"go_version"`
+	GOOS      string   `json:"goos"`
+	GOARCH    string   `json:"goarch"`
+	CPUs      int      `json:"cpus"`
+	Keys      int      `json:"keys"`
+	ValueSize int      `json:"value_size"`
+	Seed      int64    `json:"seed"`
+	Results   []Result `json:"results"`
+}
+
+// Open opens a database of the backend, and fills it for the workload.
+func Open(backend Backend, w Workload, opts Options) (tmdb.DB, func(), error) {
+	opts = opts.withDefaults()
+
+	database, closeDB, err := backend.Open()
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to open %s: %w", backend.Name, err)
+	}
+
+	if w.Prefill != nil {
+		if err := w.Prefill(database, opts); err != nil {
+			closeDB()
+			return nil, nil, fmt.Errorf("failed to fill %s for %s: %w", backend.Name, w.Name, err)
+		}
+	}
+
+	return database, closeDB, nil
+}
+
+// Bench runs a workload as a go test benchmark.
+func Bench(b *testing.B, backend Backend, w Workload, opts Options) {
+	opts = opts.withDefaults()
+
+	database, closeDB, err := Open(backend, w, opts)
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer closeDB()
+
+	b.ReportAllocs()
+	w.Run(b, database, opts)
+}
+
+// Run measures every workload on every backend with testing.Benchmark, in order. The
+// duration of every measure is set by the test.benchtime flag, one second by default.
+func Run(backends []Backend, workloads []Workload, opts Options) (Report, error) {
+	opts = opts.withDefaults()
+
+	report := Report{
+		GoVersion: runtime.Version(),
+		GOOS:      runtime.GOOS,
+		GOARCH:    runtime.GOARCH,
+		CPUs:      runtime.NumCPU(),
+		Keys:      opts.Keys,
+		ValueSize: opts.ValueSize,
+		Seed:      opts.Seed,
+		Results:   []Result{},
+	}
+
+	for _, backend := range backends {
+		for _, w := range workloads {
+			database, closeDB, err := Open(backend, w, opts)
+			if err != nil {
+				return report, err
+			}
+
+			var failed bool
+			res := testing.Benchmark(func(b *testing.B) {
+				b.ReportAllocs()
+				w.Run(b, database, opts)
+				failed = b.Failed()
+			})
+			closeDB()
+
+			if failed || res.N == 0 {
+				return report, fmt.Errorf("workload %s failed on %s", w.Name, backend.Name)
+			}
+
+			report.Results = append(report.Results, Result{
+				Backend:     backend.Name,
+				Workload:    w.Name,
+				N:           res.N,
+				NsPerOp:     res.NsPerOp(),
+				MBPerSec:    mbPerSec(res),
+				AllocsPerOp: res.AllocsPerOp(),
+				BytesPerOp:  res.AllocedBytesPerOp(),
+			})
+		}
+	}
+
+	return report, nil
+}
+
+func mbPerSec(res testing.BenchmarkResult) float64 {
+	if res.Bytes <= 0 || res.T <= 0 {
+		return 0
+	}
+
+	return float64(res.Bytes) * float64(res.N) / 1e6 / res.T.Seconds()
+}
+
+// WriteJSON writes the report as indented JSON.
+func (r Report) WriteJSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+
+	return enc.Encode(r)
+}
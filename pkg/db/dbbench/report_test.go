@@ -0,0 +1,60 @@
+package dbbench
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRun(t *testing.T) {
+	benchtime := flag.Lookup("test.benchtime")
+	prev := benchtime.Value.String()
+	require.NoError(t, flag.Set("test.benchtime", "3x"))
+	defer flag.Set("test.benchtime", prev)
+
+	opts := Options{Keys: 200, ValueSize: 16, Seed: 7}
+	report, err := Run([]Backend{MemDB(), ZDBStandIn()}, Workloads(), opts)
+	require.NoError(t, err)
+
+	assert.Equal(t, 200, report.Keys)
+	assert.Equal(t, int64(7), report.Seed)
+	require.Len(t, report.Results, 2*len(Workloads()))
+
+	for i, w := range Workloads() {
+		assert.Equal(t, "memdb", report.Results[i].Backend)
+		assert.Equal(t, w.Name, report.Results[i].Workload)
+		assert.Equal(t, 3, report.Results[i].N)
+		assert.Equal(t, "zdb-standin", report.Results[len(Workloads())+i].Backend)
+	}
+
+	var buf bytes.Buffer
+	require.NoError(t, report.WriteJSON(&buf))
+
+	var decoded Report
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &decoded))
+	assert.Equal(t, report, decoded)
+}
+
+func TestWorkloadsAreReproducible(t *testing.T) {
+	opts := Options{Keys: 100, ValueSize: 8}.withDefaults()
+
+	first, closeFirst, err := Open(MemDB(), Workload{Prefill: prefillSequential}, opts)
+	require.NoError(t, err)
+	defer closeFirst()
+
+	second, closeSecond, err := Open(ZDBStandIn(), Workload{Prefill: prefillSequential}, opts)
+	require.NoError(t, err)
+	defer closeSecond()
+
+	for i := 0; i < opts.Keys; i++ {
+		want, err := first.Get(sequentialKey(i))
+		require.NoError(t, err)
+		got, err := second.Get(sequentialKey(i))
+		require.NoError(t, err)
+		assert.Equal(t, want, got)
+	}
+}
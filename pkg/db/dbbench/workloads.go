@@ -0,0 +1,398 @@
+// Package dbbench benchmarks tm-db backends with the access patterns of a Tendermint node, so
+// ZDB can be compared with the MemDB and goleveldb backends.
+//
+// The same workloads back the go test benchmarks of this package and the zdb-bench command,
+// which writes the results as JSON. Keys and values come from a seeded generator, every run
+// with the same options writes and reads the same data.
+package dbbench
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"math/rand"
+	"testing"
+
+	"github.com/mariobassem/tendermint-zdb/pkg/db"
+	tmdb "github.com/tendermint/tm-db"
+)
+
+const (
+	DefaultKeys      = 10000
+	DefaultValueSize = 100
+	DefaultSeed      = 1
+
+	// prefillBatchSize is the number of keys written per batch when filling a database.
+	prefillBatchSize = 1000
+	// iavlDepth is the number of nodes an IAVL tree of DefaultKeys keys reads and writes on
+	// the path from its root to a leaf.
+	iavlDepth = 14
+	// iavlKeepVersions is the number of versions kept by the IAVL commit workload, older ones
+	// are pruned.
+	iavlKeepVersions = 10
+)
+
+// Options configures the workloads.
+type Options struct {
+	// Keys is the number of keys a database is filled with before the read workloads.
+	Keys int
+	// ValueSize is the size of the written values.
+	ValueSize int
+	// Seed seeds the generator of the keys, values and access order.
+	Seed int64
+}
+
+func (o Options) withDefaults() Options {
+	if o.Keys <= 0 {
+		o.Keys = DefaultKeys
+	}
+
+	if o.ValueSize <= 0 {
+		o.ValueSize = DefaultValueSize
+	}
+
+	if o.Seed == 0 {
+		o.Seed = DefaultSeed
+	}
+
+	return o
+}
+
+// Workload is an access pattern benchmarked on every backend.
+type Workload struct {
+	Name string
+	// Prefill fills the database before the benchmark, it may be nil.
+	Prefill func(database tmdb.DB, opts Options) error
+	// Run runs b.N operations of the workload.
+	Run func(b *testing.B, database tmdb.DB, opts Options)
+}
+
+// Workloads returns every workload, in the order they are reported.
+func Workloads() []Workload {
+	workloads := []Workload{
+		{Name: "set/sequential", Run: runSequentialSet},
+		{Name: "set/random", Run: runRandomSet},
+		{Name: "get/sequential", Prefill: prefillSequential, Run: runSequentialGet},
+		{Name: "get/random", Prefill: prefillSequential, Run: runRandomGet},
+	}
+
+	for _, size := range []int{1, 10, 100, 1000} {
+		workloads = append(workloads, Workload{
+			Name: fmt.Sprintf("batch/%d", size),
+			Run:  batchRunner(size),
+		})
+	}
+
+	for _, n := range []int{10, 100} {
+		workloads = append(workloads,
+			Workload{
+				Name:    fmt.Sprintf("iterate/forward/%d", n),
+				Prefill: prefillSequential,
+				Run:     iterateRunner(n, false),
+			},
+			Workload{
+				Name:    fmt.Sprintf("iterate/reverse/%d", n),
+				Prefill: prefillSequential,
+				Run:     iterateRunner(n, true),
+			},
+		)
+	}
+
+	return append(workloads,
+		Workload{Name: "iavl/commit", Run: runIAVLCommit},
+		Workload{Name: "iavl/lookup", Prefill: prefillIAVL, Run: runIAVLLookup},
+	)
+}
+
+// sequentialKey returns the i-th key of the sequential key space, they sort in the order they
+// are numbered.
+func sequentialKey(i int) []byte {
+	key := make([]byte, 9)
+	key[0] = 'k'
+	binary.BigEndian.PutUint64(key[1:], uint64(i))
+
+	return key
+}
+
+func randomBytes(r *rand.Rand, n int) []byte {
+	b := make([]byte, n)
+	r.Read(b)
+
+	return b
+}
+
+func prefillSequential(database tmdb.DB, opts Options) error {
+	r := rand.New(rand.NewSource(opts.Seed))
+
+	return writeBatches(database, opts.Keys, func(i int) ([]byte, []byte) {
+		return sequentialKey(i), randomBytes(r, opts.ValueSize)
+	})
+}
+
+// writeBatches writes n keys in batches of prefillBatchSize.
+func writeBatches(database tmdb.DB, n int, kv func(i int) ([]byte, []byte)) error {
+	for start := 0; start < n; start += prefillBatchSize {
+		batch := database.NewBatch()
+		for i := start; i < n && i < start+prefillBatchSize; i++ {
+			key, value := kv(i)
+			if err := batch.Set(key, value); err != nil {
+				batch.Close()
+				return err
+			}
+		}
+
+		err := batch.Write()
+		batch.Close()
+		if err != nil {
+			return fmt.Errorf("failed to write keys %d to %d: %w", start, start+prefillBatchSize, err)
+		}
+	}
+
+	return nil
+}
+
+func runSequentialSet(b *testing.B, database tmdb.DB, opts Options) {
+	r := rand.New(rand.NewSource(opts.Seed))
+	value := randomBytes(r, opts.ValueSize)
+
+	b.SetBytes(int64(opts.ValueSize))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := database.Set(sequentialKey(i), value); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func runRandomSet(b *testing.B, database tmdb.DB, opts Options) {
+	r := rand.New(rand.NewSource(opts.Seed))
+	value := randomBytes(r, opts.ValueSize)
+
+	b.SetBytes(int64(opts.ValueSize))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := database.Set(randomBytes(r, 32), value); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func runSequentialGet(b *testing.B, database tmdb.DB, opts Options) {
+	b.SetBytes(int64(opts.ValueSize))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		get(b, database, sequentialKey(i%opts.Keys))
+	}
+}
+
+func runRandomGet(b *testing.B, database tmdb.DB, opts Options) {
+	r := rand.New(rand.NewSource(opts.Seed))
+
+	b.SetBytes(int64(opts.ValueSize))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		get(b, database, sequentialKey(r.Intn(opts.Keys)))
+	}
+}
+
+func get(b *testing.B, database tmdb.DB, key []byte) []byte {
+	value, err := database.Get(key)
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	if value == nil {
+		b.Fatalf("key %x not found", key)
+	}
+
+	return value
+}
+
+// batchRunner commits a batch of size random keys per operation.
+func batchRunner(size int) func(b *testing.B, database tmdb.DB, opts Options) {
+	return func(b *testing.B, database tmdb.DB, opts Options) {
+		r := rand.New(rand.NewSource(opts.Seed))
+		value := randomBytes(r, opts.ValueSize)
+
+		b.SetBytes(int64(size * opts.ValueSize))
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			batch := database.NewBatch()
+			for j := 0; j < size; j++ {
+				if err := batch.Set(randomBytes(r, 32), value); err != nil {
+					b.Fatal(err)
+				}
+			}
+
+			if err := batch.Write(); err != nil {
+				b.Fatal(err)
+			}
+			batch.Close()
+		}
+	}
+}
+
+// iterateRunner reads n keys and values from a random position per operation.
+func iterateRunner(n int, reverse bool) func(b *testing.B, database tmdb.DB, opts Options) {
+	return func(b *testing.B, database tmdb.DB, opts Options) {
+		r := rand.New(rand.NewSource(opts.Seed))
+		n := min(n, opts.Keys-1)
+
+		b.SetBytes(int64(n * opts.ValueSize))
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			// the range starts after the first key, so it has a key before it for ZDB
+			first := 1 + r.Intn(opts.Keys-n)
+
+			it, err := iterateRange(database, first, first+n, reverse)
+			if err != nil {
+				b.Fatal(err)
+			}
+
+			count := 0
+			for ; it.Valid(); it.Next() {
+				_ = it.Key()
+				_ = it.Value()
+				count++
+			}
+
+			if err := it.Error(); err != nil {
+				b.Fatal(err)
+			}
+			it.Close()
+
+			if count != n {
+				b.Fatalf("iterated over %d keys, expected %d", count, n)
+			}
+		}
+	}
+}
+
+// iterateRange returns an iterator over the sequential keys first to end, excluded.
+func iterateRange(database tmdb.DB, first, end int, reverse bool) (tmdb.Iterator, error) {
+	if !reverse {
+		return database.Iterator(sequentialKey(first), sequentialKey(end))
+	}
+
+	// the reverse iterator of ZDB starts at start, and stops at end
+	if _, ok := database.(*db.ZDB); ok {
+		return database.ReverseIterator(sequentialKey(end-1), sequentialKey(first-1))
+	}
+
+	return database.ReverseIterator(sequentialKey(first), sequentialKey(end))
+}
+
+// iavlNodeKey returns the key of the i-th node written by a version, nodes are stored under
+// their hash like in IAVL.
+func iavlNodeKey(version int64, i int) []byte {
+	var b [16]byte
+	binary.BigEndian.PutUint64(b[:8], uint64(version))
+	binary.BigEndian.PutUint64(b[8:], uint64(i))
+	hash := sha256.Sum256(b[:])
+
+	return append([]byte{'n'}, hash[:]...)
+}
+
+func iavlRootKey(version int64) []byte {
+	key := make([]byte, 9)
+	key[0] = 'r'
+	binary.BigEndian.PutUint64(key[1:], uint64(version))
+
+	return key
+}
+
+// iavlVersion returns the batch committing a version: the nodes on the path to the updated
+// leaf and the root, and the removal of a pruned version.
+func iavlVersion(database tmdb.DB, version int64, value []byte, prune bool) (tmdb.Batch, error) {
+	batch := database.NewBatch()
+	for i := 0; i < iavlDepth; i++ {
+		if err := batch.Set(iavlNodeKey(version, i), value); err != nil {
+			batch.Close()
+			return nil, err
+		}
+	}
+
+	if err := batch.Set(iavlRootKey(version), iavlNodeKey(version, 0)); err != nil {
+		batch.Close()
+		return nil, err
+	}
+
+	pruned := version - iavlKeepVersions
+	if !prune || pruned < 1 {
+		return batch, nil
+	}
+
+	for i := 0; i < iavlDepth; i++ {
+		if err := batch.Delete(iavlNodeKey(pruned, i)); err != nil {
+			batch.Close()
+			return nil, err
+		}
+	}
+
+	if err := batch.Delete(iavlRootKey(pruned)); err != nil {
+		batch.Close()
+		return nil, err
+	}
+
+	return batch, nil
+}
+
+// iavlVersions is the number of versions written by prefillIAVL.
+func iavlVersions(opts Options) int64 {
+	return int64(opts.Keys/(iavlDepth+1)) + 1
+}
+
+func prefillIAVL(database tmdb.DB, opts Options) error {
+	r := rand.New(rand.NewSource(opts.Seed))
+
+	for version := int64(1); version <= iavlVersions(opts); version++ {
+		batch, err := iavlVersion(database, version, randomBytes(r, opts.ValueSize), false)
+		if err != nil {
+			return err
+		}
+
+		err = batch.Write()
+		batch.Close()
+		if err != nil {
+			return fmt.Errorf("failed to write version %d: %w", version, err)
+		}
+	}
+
+	return nil
+}
+
+// runIAVLCommit commits a version per operation, pruning the versions older than
+// iavlKeepVersions.
+func runIAVLCommit(b *testing.B, database tmdb.DB, opts Options) {
+	r := rand.New(rand.NewSource(opts.Seed))
+	value := randomBytes(r, opts.ValueSize)
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		batch, err := iavlVersion(database, int64(i+1), value, true)
+		if err != nil {
+			b.Fatal(err)
+		}
+
+		if err := batch.Write(); err != nil {
+			b.Fatal(err)
+		}
+		batch.Close()
+	}
+}
+
+// runIAVLLookup reads the root of a random version, then the nodes down to a leaf.
+func runIAVLLookup(b *testing.B, database tmdb.DB, opts Options) {
+	r := rand.New(rand.NewSource(opts.Seed))
+	versions := iavlVersions(opts)
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		version := r.Int63n(versions) + 1
+		get(b, database, iavlRootKey(version))
+
+		for j := 0; j < iavlDepth; j++ {
+			get(b, database, iavlNodeKey(version, j))
+		}
+	}
+}
@@ -0,0 +1,321 @@
+package db
+
+import (
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// encryptionMagic starts encrypted values. It is followed by the 4 bytes big endian
+// key id, the nonce, and the AES-GCM sealed value. The stored key is used as additional
+// data, so a value moved to another key fails the integrity check.
+var encryptionMagic = []byte{0xc7, 'z', 'e'}
+
+// maxReencryptAttempts is the number of times Reencrypt reads a key again when it changed
+// before being written back.
+const maxReencryptAttempts = 3
+
+// beforeReencryptWrite is called by Reencrypt before checking the version of a key again,
+// tests use it to write the key concurrently.
+var beforeReencryptWrite func(stored []byte)
+
+var (
+	ErrIntegrity    = errors.New("value failed the integrity check")
+	ErrUnknownKeyID = errors.New("unknown encryption key id")
+)
+
+// Keyring holds the AES keys used to encrypt values. New values are encrypted with the
+// active key, older keys are kept to decrypt values written before a rotation.
+type Keyring struct {
+	// AllowPlaintext allows reading values that were written without encryption.
+	// Otherwise reading them fails with ErrIntegrity.
+	AllowPlaintext bool
+
+	mu     sync.RWMutex
+	keys   map[uint32]cipher.AEAD
+	active uint32
+}
+
+// NewKeyring returns a keyring with the given AES-128, AES-192 or AES-256 key as active key.
+func NewKeyring(id uint32, key []byte) (*Keyring, error) {
+	k := &Keyring{
+		keys: map[uint32]cipher.AEAD{},
+	}
+
+	if err := k.Rotate(id, key); err != nil {
+		return nil, err
+	}
+
+	return k, nil
+}
+
+// Add adds a key used to decrypt values, without making it the active key.
+func (k *Keyring) Add(id uint32, key []byte) error {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return err
+	}
+
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return err
+	}
+
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	if _, ok := k.keys[id]; ok {
+		return fmt.Errorf("key id %d already exists", id)
+	}
+
+	k.keys[id] = aead
+
+	return nil
+}
+
+// Rotate adds a key and makes it the active key. Use ZDB.Reencrypt to re-encrypt
+// existing values with it.
+func (k *Keyring) Rotate(id uint32, key []byte) error {
+	if err := k.Add(id, key); err != nil {
+		return err
+	}
+
+	k.mu.Lock()
+	k.active = id
+	k.mu.Unlock()
+
+	return nil
+}
+
+// ActiveID returns the id of the key used to encrypt new values.
+func (k *Keyring) ActiveID() uint32 {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+
+	return k.active
+}
+
+func (k *Keyring) encrypt(stored, val []byte) ([]byte, error) {
+	k.mu.RLock()
+	id := k.active
+	aead := k.keys[id]
+	k.mu.RUnlock()
+
+	headerSize := len(encryptionMagic) + 4 + aead.NonceSize()
+	ret := make([]byte, headerSize, headerSize+len(val)+aead.Overhead())
+	copy(ret, encryptionMagic)
+	binary.BigEndian.PutUint32(ret[len(encryptionMagic):], id)
+
+	nonce := ret[len(encryptionMagic)+4:]
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+
+	return aead.Seal(ret, nonce, val, stored), nil
+}
+
+func (k *Keyring) decrypt(stored, raw []byte) ([]byte, error) {
+	if !isEncrypted(raw) {
+		if k.AllowPlaintext {
+			return raw, nil
+		}
+
+		return nil, fmt.Errorf("value of %x is not encrypted: %w", stored, ErrIntegrity)
+	}
+
+	id := keyID(raw)
+
+	k.mu.RLock()
+	aead, ok := k.keys[id]
+	k.mu.RUnlock()
+
+	if !ok {
+		return nil, fmt.Errorf("value of %x is encrypted with key %d: %w", stored, id, ErrUnknownKeyID)
+	}
+
+	headerSize := len(encryptionMagic) + 4 + aead.NonceSize()
+	if len(raw) < headerSize+aead.Overhead() {
+		return nil, fmt.Errorf("value of %x is truncated: %w", stored, ErrIntegrity)
+	}
+
+	nonce := raw[len(encryptionMagic)+4 : headerSize]
+	val, err := aead.Open(nil, nonce, raw[headerSize:], stored)
+	if err != nil {
+		return nil, fmt.Errorf("value of %x was tampered with: %w", stored, ErrIntegrity)
+	}
+
+	return val, nil
+}
+
+func isEncrypted(raw []byte) bool {
+	return bytes.HasPrefix(raw, encryptionMagic) && len(raw) >= len(encryptionMagic)+4
+}
+
+func keyID(raw []byte) uint32 {
+	return binary.BigEndian.Uint32(raw[len(encryptionMagic):])
+}
+
+// WithEncryption encrypts values with the active key of the keyring.
+func WithEncryption(k *Keyring) Option {
+	return func(z *ZDB) {
+		z.keyring = k
+	}
+}
+
+func (z *ZDB) encryptValue(stored, val []byte) ([]byte, error) {
+	if z.keyring == nil {
+		return val, nil
+	}
+
+	return z.keyring.encrypt(stored, val)
+}
+
+func (z *ZDB) decryptValue(stored, raw []byte) ([]byte, error) {
+	if z.keyring != nil {
+		return z.keyring.decrypt(stored, raw)
+	}
+
+	if bytes.HasPrefix(raw, encryptionMagic) {
+		return nil, fmt.Errorf("value of %x is encrypted, but no keyring is configured", stored)
+	}
+
+	return raw, nil
+}
+
+// Reencrypt scans the namespace and re-encrypts every value that is not encrypted with the
+// active key of the keyring, values written without encryption are only encrypted if the
+// keyring allows plaintext. It uses its own connection, so it can run in the background
+// while the database is in use. It returns the number of re-encrypted values.
+//
+// The version of a key is checked again before its value is written back: a key written in
+// the meantime is read again, and skipped after maxReencryptAttempts, its writer already
+// encrypts it with the active key. ZDB has no conditional writes, so a write landing in the
+// round trip between the check and the write back is still overwritten.
+func (z *ZDB) Reencrypt(ctx context.Context) (int, error) {
+	if z.keyring == nil {
+		return 0, errors.New("no keyring is configured")
+	}
+
+	if err := z.writable(); err != nil {
+		return 0, err
+	}
+
+	c, err := z.Clone()
+	if err != nil {
+		return 0, err
+	}
+	defer c.Close()
+
+	active := z.keyring.ActiveID()
+	count := 0
+
+	var cursor []byte
+	for {
+		if err := ctx.Err(); err != nil {
+			return count, err
+		}
+
+		res, err := c.scan(cursor, true)
+		if errors.Is(err, ErrCursorNoMoreData) {
+			return count, nil
+		}
+		if err != nil {
+			return count, err
+		}
+
+		for _, k := range res.Keys {
+			ok, err := c.reencryptKey(k.Key, active)
+			if err != nil {
+				return count, err
+			}
+
+			if ok {
+				count++
+			}
+		}
+
+		cursor = res.Next
+	}
+}
+
+// reencryptKey re-encrypts the value of a stored key with the active key, if the key did not
+// change while it was rewritten. It reports whether the value was written back.
+func (z *ZDB) reencryptKey(stored []byte, active uint32) (bool, error) {
+	for attempt := 0; attempt < maxReencryptAttempts; attempt++ {
+		version, err := z.version(stored)
+		if err != nil {
+			return false, err
+		}
+
+		raw, err := z.get(stored)
+		if err != nil {
+			return false, err
+		}
+
+		if raw == nil || (isEncrypted(raw) && keyID(raw) == active) {
+			return false, nil
+		}
+
+		val, err := z.decryptValue(stored, raw)
+		if err != nil {
+			return false, err
+		}
+
+		val, err = z.encryptValue(stored, val)
+		if err != nil {
+			return false, err
+		}
+
+		if beforeReencryptWrite != nil {
+			beforeReencryptWrite(stored)
+		}
+
+		written, err := z.writeIfVersion(stored, version, val)
+		if err != nil || written {
+			return written, err
+		}
+	}
+
+	return false, nil
+}
+
+// writeIfVersion writes the stored key if its version did not change, holding commitMu so
+// a conditional batch cannot write it in between.
+func (z *ZDB) writeIfVersion(stored, version, val []byte) (bool, error) {
+	z.commitMu.RLock()
+	defer z.commitMu.RUnlock()
+
+	current, err := z.version(stored)
+	if err != nil {
+		return false, err
+	}
+
+	if !bytes.Equal(current, version) {
+		return false, nil
+	}
+
+	if _, err := z.do(OpWrite, "SET", stored, val); err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+// StartReencrypt runs Reencrypt in the background. The returned channel receives its
+// result once done.
+func (z *ZDB) StartReencrypt(ctx context.Context) <-chan error {
+	done := make(chan error, 1)
+
+	go func() {
+		_, err := z.Reencrypt(ctx)
+		done <- err
+	}()
+
+	return done
+}
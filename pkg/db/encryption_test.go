@@ -0,0 +1,133 @@
+package db
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEncryption(t *testing.T) {
+	z, _ := newTestZDB(t)
+
+	keyring, err := NewKeyring(1, bytes.Repeat([]byte{1}, 32))
+	require.NoError(t, err)
+	z.keyring = keyring
+
+	key := []byte("k1")
+	want := []byte("secret value")
+	assert.NoError(t, z.Set(key, want))
+
+	raw, err := z.get(key)
+	require.NoError(t, err)
+	assert.False(t, bytes.Contains(raw, want))
+	assert.Equal(t, uint32(1), keyID(raw))
+
+	got, err := z.Get(key)
+	assert.NoError(t, err)
+	assert.Equal(t, want, got)
+
+	// flip one bit of the ciphertext
+	raw[len(raw)-1] ^= 1
+	_, err = z.con.Do("SET", key, raw)
+	require.NoError(t, err)
+
+	_, err = z.Get(key)
+	assert.ErrorIs(t, err, ErrIntegrity)
+
+	// a value moved to another key must not decrypt either
+	assert.NoError(t, z.Set(key, want))
+	raw, err = z.get(key)
+	require.NoError(t, err)
+	_, err = z.con.Do("SET", "k2", raw)
+	require.NoError(t, err)
+
+	_, err = z.Get([]byte("k2"))
+	assert.ErrorIs(t, err, ErrIntegrity)
+}
+
+func TestReencrypt(t *testing.T) {
+	z, _ := newTestZDB(t)
+
+	assert.NoError(t, z.Set([]byte("plain"), []byte("v0")))
+
+	keyring, err := NewKeyring(1, bytes.Repeat([]byte{1}, 32))
+	require.NoError(t, err)
+	keyring.AllowPlaintext = true
+	z.keyring = keyring
+	z.opts = append(z.opts, WithEncryption(keyring))
+
+	assert.NoError(t, z.Set([]byte("k1"), []byte("v1")))
+	assert.NoError(t, z.Set(bytes.Repeat([]byte("k"), 300), []byte("v2")))
+
+	require.NoError(t, keyring.Rotate(2, bytes.Repeat([]byte{2}, 32)))
+
+	count, err := z.Reencrypt(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, 3, count)
+
+	for _, key := range [][]byte{[]byte("plain"), []byte("k1")} {
+		raw, err := z.get(key)
+		require.NoError(t, err)
+		assert.Equal(t, uint32(2), keyID(raw))
+	}
+
+	got, err := z.Get(bytes.Repeat([]byte("k"), 300))
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("v2"), got)
+
+	count, err = z.Reencrypt(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, 0, count)
+}
+
+func TestReencryptConcurrentWrite(t *testing.T) {
+	z, _ := newTestZDB(t)
+
+	keyring, err := NewKeyring(1, bytes.Repeat([]byte{1}, 32))
+	require.NoError(t, err)
+	z.keyring = keyring
+	z.opts = append(z.opts, WithEncryption(keyring))
+
+	assert.NoError(t, z.Set([]byte("k1"), []byte("v1")))
+	assert.NoError(t, z.Set([]byte("k2"), []byte("v2")))
+	assert.NoError(t, z.Set([]byte("k3"), []byte("v3")))
+
+	require.NoError(t, keyring.Rotate(2, bytes.Repeat([]byte{2}, 32)))
+
+	// k1 is written once while it is re-encrypted, k2 on every attempt
+	writes := 0
+	beforeReencryptWrite = func(stored []byte) {
+		if string(stored) == "k1" && writes == 0 {
+			writes++
+			require.NoError(t, z.Set([]byte("k1"), []byte("new")))
+		}
+		if string(stored) == "k2" {
+			require.NoError(t, z.Set([]byte("k2"), []byte(fmt.Sprintf("v%d", writes+10))))
+			writes++
+		}
+	}
+	t.Cleanup(func() { beforeReencryptWrite = nil })
+
+	count, err := z.Reencrypt(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, 1, count)
+
+	// the concurrent writes are kept, and encrypted with the active key by their writer
+	got, err := z.Get([]byte("k1"))
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("new"), got)
+
+	got, err = z.Get([]byte("k2"))
+	assert.NoError(t, err)
+	assert.Equal(t, []byte(fmt.Sprintf("v%d", writes+9)), got)
+
+	for _, key := range [][]byte{[]byte("k1"), []byte("k2"), []byte("k3")} {
+		raw, err := z.get(key)
+		require.NoError(t, err)
+		assert.Equal(t, uint32(2), keyID(raw))
+	}
+}
@@ -0,0 +1,52 @@
+package db
+
+import (
+	"errors"
+
+	"github.com/gomodule/redigo/redis"
+	"github.com/mariobassem/tendermint-zdb/pkg/internal/zdberr"
+)
+
+// Error replies of ZDB are returned as a *ServerError, which matches one of these errors with
+// errors.Is.
+var (
+	ErrCursorNoMoreData  = zdberr.ErrCursorNoMoreData
+	ErrKeyNotFound       = zdberr.ErrKeyNotFound
+	ErrNamespaceNotFound = zdberr.ErrNamespaceNotFound
+	ErrNamespaceExists   = zdberr.ErrNamespaceExists
+	ErrNamespaceInUse    = zdberr.ErrNamespaceInUse
+	ErrPermissionDenied  = zdberr.ErrPermissionDenied
+	ErrReadOnly          = zdberr.ErrReadOnly
+	ErrNamespaceFull     = zdberr.ErrNamespaceFull
+	ErrInvalidKey        = zdberr.ErrInvalidKey
+	ErrInvalidCursor     = zdberr.ErrInvalidCursor
+	ErrInvalidArgument   = zdberr.ErrInvalidArgument
+	ErrUnsupported       = zdberr.ErrUnsupported
+	ErrTimeout           = zdberr.ErrTimeout
+)
+
+// ServerError is an error reply of ZDB. It wraps the error of its kind, and the redis.Error
+// returned by redigo.
+type ServerError = zdberr.ServerError
+
+// serverError returns an error reply as a *ServerError, and other errors unchanged.
+func serverError(err error) error {
+	var redisErr redis.Error
+	if !errors.As(err, &redisErr) {
+		return err
+	}
+
+	var serverErr *ServerError
+	if errors.As(err, &serverErr) {
+		return err
+	}
+
+	return zdberr.New(string(redisErr), err)
+}
+
+// isServerError reports whether the error is an error reply, the connection is still usable.
+func isServerError(err error) bool {
+	var serverErr *ServerError
+
+	return errors.As(err, &serverErr)
+}
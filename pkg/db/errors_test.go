@@ -0,0 +1,67 @@
+package db
+
+import (
+	"testing"
+
+	"github.com/gomodule/redigo/redis"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestServerErrors(t *testing.T) {
+	z, _ := newTestZDB(t)
+
+	_, err := z.Scan()
+	assert.ErrorIs(t, err, ErrCursorNoMoreData)
+
+	var redisErr redis.Error
+	require.ErrorAs(t, err, &redisErr)
+	assert.Equal(t, "No more data", string(redisErr))
+
+	_, err = z.KeyCursor([]byte("missing"))
+	assert.ErrorIs(t, err, ErrKeyNotFound)
+
+	assert.ErrorIs(t, z.Select("missing"), ErrNamespaceNotFound)
+	require.NoError(t, z.NewNamespace("app"))
+	assert.ErrorIs(t, z.NewNamespace("app"), ErrNamespaceExists)
+
+	_, err = z.con.Do("NSSET", "default", "maxsize", 1)
+	require.NoError(t, err)
+
+	err = z.Set([]byte("key"), []byte("value"))
+	assert.ErrorIs(t, err, ErrNamespaceFull)
+
+	var serverErr *ServerError
+	require.ErrorAs(t, err, &serverErr)
+	assert.Equal(t, "No space left on this namespace", serverErr.Message)
+	assert.Equal(t, ErrNamespaceFull, serverErr.Kind)
+}
+
+func TestBatchError(t *testing.T) {
+	z, _ := newTestZDB(t)
+
+	_, err := z.con.Do("NSSET", "default", "worm", 1)
+	require.NoError(t, err)
+	require.NoError(t, z.Set([]byte("a"), []byte("1")))
+
+	batch := z.NewBatch()
+	defer batch.Close()
+	require.NoError(t, batch.Set([]byte("a"), []byte("2")))
+	require.NoError(t, batch.Set([]byte("b"), []byte("2")))
+
+	err = batch.Write()
+	assert.ErrorIs(t, err, ErrReadOnly)
+
+	var batchErr *BatchError
+	require.ErrorAs(t, err, &batchErr)
+	assert.Equal(t, 1, batchErr.Failed)
+
+	// the keys written are dropped from the batch, the others are retried
+	_, err = z.con.Do("NSSET", "default", "worm", 0)
+	require.NoError(t, err)
+	require.NoError(t, batch.Write())
+
+	value, err := z.Get([]byte("a"))
+	require.NoError(t, err)
+	assert.Equal(t, []byte("2"), value)
+}
@@ -12,8 +12,10 @@ type zdbIterator struct {
 	forward     bool
 	start       []byte
 	end         []byte
+	storedEnd   []byte
 	nextCursor  []byte
 	scannedKeys [][]byte
+	exhausted   bool
 	valid       bool
 	err         error
 }
@@ -39,7 +41,7 @@ func (z *zdbIterator) Valid() bool {
 		return false
 	}
 
-	exists, err := z.zdb.Exists(z.scannedKeys[0])
+	exists, err := z.zdb.exists(z.scannedKeys[0])
 	if err != nil {
 		z.invalidate(err)
 		return false
@@ -61,7 +63,16 @@ func (z *zdbIterator) Next() {
 		return
 	}
 
-	scanResponse, err := z.zdb.ScanCursor(z.nextCursor)
+	if z.exhausted {
+		z.invalidate(nil)
+		return
+	}
+
+	scanResponse, err := z.zdb.scan(z.nextCursor, z.forward)
+	if errors.Is(err, ErrCursorNoMoreData) {
+		z.invalidate(nil)
+		return
+	}
 	if err != nil {
 		z.invalidate(err)
 		return
@@ -71,7 +82,8 @@ func (z *zdbIterator) Next() {
 	keys := make([][]byte, 0, len(scanResponse.Keys))
 
 	for _, k := range scanResponse.Keys {
-		if bytes.Equal(k.Key, z.end) {
+		if bytes.Equal(k.Key, z.storedEnd) {
+			z.exhausted = true
 			break
 		}
 
@@ -79,7 +91,7 @@ func (z *zdbIterator) Next() {
 	}
 
 	if len(keys) == 0 {
-		z.invalidate(errors.New("end of data"))
+		z.invalidate(nil)
 		return
 	}
 
@@ -93,7 +105,14 @@ func (z *zdbIterator) Key() (key []byte) {
 		panic(z.err)
 	}
 
-	return []byte(z.scannedKeys[0])
+	stored := z.scannedKeys[0]
+	if !isLongKey(stored) {
+		return stored
+	}
+
+	key, _ = z.entry()
+
+	return key
 }
 
 // Value returns the value at the current position. Panics if the iterator is invalid.
@@ -103,13 +122,20 @@ func (z *zdbIterator) Value() (value []byte) {
 		panic(z.err)
 	}
 
-	val, err := z.zdb.Get(z.scannedKeys[0])
+	_, value = z.entry()
+
+	return value
+}
+
+// entry fetches and decodes the entry at the current position. Panics on failure.
+func (z *zdbIterator) entry() (key []byte, value []byte) {
+	key, value, err := z.zdb.readEntry(z.scannedKeys[0])
 	if err != nil {
 		z.invalidate(err)
 		panic(z.err)
 	}
 
-	return []byte(val)
+	return key, value
 }
 
 // Error returns the last error encountered by the iterator, if any.
@@ -0,0 +1,80 @@
+package db
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+// MaxKeySize is the largest key 0-db accepts in user mode. Longer keys are stored
+// under a hashed key, see storageKey.
+const MaxKeySize = 255
+
+// longKeyPrefix marks keys that hold an entry for a key longer than MaxKeySize.
+// The stored value of such a key is the original key followed by the value.
+var longKeyPrefix = []byte{0xff, 'l', 'k', ':'}
+
+var (
+	ErrReservedKey  = errors.New("keys starting with the long key prefix are reserved")
+	ErrKeyCollision = errors.New("long key hash collides with a different key")
+)
+
+// storageKey returns the key under which the given key is stored in ZDB.
+// Keys up to MaxKeySize bytes are stored as is, longer keys are stored under the
+// long key prefix followed by the sha256 hash of the key.
+func storageKey(key []byte) ([]byte, error) {
+	if bytes.HasPrefix(key, longKeyPrefix) {
+		return nil, ErrReservedKey
+	}
+
+	if len(key) <= MaxKeySize {
+		return key, nil
+	}
+
+	sum := sha256.Sum256(key)
+	stored := make([]byte, 0, len(longKeyPrefix)+len(sum))
+	stored = append(stored, longKeyPrefix...)
+	stored = append(stored, sum[:]...)
+
+	return stored, nil
+}
+
+// isLongKey reports whether a stored key holds an entry for a long key.
+func isLongKey(stored []byte) bool {
+	return bytes.HasPrefix(stored, longKeyPrefix)
+}
+
+// encodeLongEntry prefixes the value with the length-prefixed original key.
+func encodeLongEntry(key, val []byte) []byte {
+	buf := make([]byte, binary.MaxVarintLen64, binary.MaxVarintLen64+len(key)+len(val))
+	n := binary.PutUvarint(buf, uint64(len(key)))
+	buf = buf[:n]
+	buf = append(buf, key...)
+	buf = append(buf, val...)
+
+	return buf
+}
+
+// decodeLongEntry splits a long key entry into the original key and value.
+func decodeLongEntry(raw []byte) (key []byte, val []byte, err error) {
+	size, n := binary.Uvarint(raw)
+	if n <= 0 || uint64(len(raw)-n) < size {
+		return nil, nil, fmt.Errorf("invalid long key entry of %d bytes", len(raw))
+	}
+
+	key = raw[n : n+int(size)]
+	val = raw[n+int(size):]
+
+	return key, val, nil
+}
+
+// decodeEntry returns the key and value held by a stored key and its raw value.
+func decodeEntry(stored, raw []byte) (key []byte, val []byte, err error) {
+	if !isLongKey(stored) {
+		return stored, raw, nil
+	}
+
+	return decodeLongEntry(raw)
+}
@@ -0,0 +1,150 @@
+package db
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/mariobassem/tendermint-zdb/pkg/internal/logkey"
+)
+
+// keyCommands are the commands whose first argument is a key.
+var keyCommands = map[string]bool{
+	"SET":    true,
+	"GET":    true,
+	"DEL":    true,
+	"EXISTS": true,
+	"KEYCUR": true,
+}
+
+// WithLogger logs the commands sent to ZDB at debug level, and the connection failures at warn
+// level. Keys are logged as a hash and values are never logged, unless WithKeyLogging is
+// given. Nothing is logged by default.
+func WithLogger(l *slog.Logger) Option {
+	return func(z *ZDB) {
+		z.logger = l
+	}
+}
+
+// WithKeyLogging logs keys as hex instead of a hash, to debug a database without private keys.
+func WithKeyLogging() Option {
+	return func(z *ZDB) {
+		z.logKeys = true
+	}
+}
+
+func (z *ZDB) log() *slog.Logger {
+	if z.logger == nil {
+		return logkey.Discard
+	}
+
+	return z.logger
+}
+
+func (z *ZDB) logNamespace() string {
+	if z.namespace == "" {
+		return "default"
+	}
+
+	return z.namespace
+}
+
+func (z *ZDB) keyAttr(key []byte) slog.Attr {
+	return logkey.Attr(key, z.logKeys)
+}
+
+// logCommand logs a command sent by do. Error replies, such as a missing key, are part of the
+// normal flow and only failures of the connection are logged as warnings.
+func (z *ZDB) logCommand(cmd string, args []interface{}, latency time.Duration, err error) {
+	level := slog.LevelDebug
+	if err != nil && !isServerError(err) {
+		level = slog.LevelWarn
+	}
+
+	logger := z.log()
+	if !logger.Enabled(context.Background(), level) {
+		return
+	}
+
+	attrs := []slog.Attr{
+		slog.String("namespace", z.logNamespace()),
+		slog.String("command", cmd),
+		slog.Duration("latency", latency),
+	}
+
+	if key, ok := firstKey(cmd, args); ok {
+		attrs = append(attrs, z.keyAttr(key))
+	}
+
+	if err != nil {
+		attrs = append(attrs, slog.String("error", err.Error()))
+	}
+
+	logger.LogAttrs(context.Background(), level, "zdb command", attrs...)
+}
+
+// logPipeline logs a pipeline of commands sent by doPipelined.
+func (z *ZDB) logPipeline(commands int, latency time.Duration, errs []error, err error) {
+	level := slog.LevelDebug
+	if err != nil {
+		level = slog.LevelWarn
+	}
+
+	logger := z.log()
+	if !logger.Enabled(context.Background(), level) {
+		return
+	}
+
+	failed := 0
+	for _, e := range errs {
+		if e != nil {
+			failed++
+		}
+	}
+
+	attrs := []slog.Attr{
+		slog.String("namespace", z.logNamespace()),
+		slog.Int("commands", commands),
+		slog.Int("failed", failed),
+		slog.Duration("latency", latency),
+	}
+
+	if err != nil {
+		attrs = append(attrs, slog.String("error", err.Error()))
+	}
+
+	logger.LogAttrs(context.Background(), level, "zdb pipeline", attrs...)
+}
+
+// logIterator logs the creation of an iterator, with its bounds.
+func (z *ZDB) logIterator(start, end []byte, forward bool) {
+	logger := z.log()
+	if !logger.Enabled(context.Background(), slog.LevelDebug) {
+		return
+	}
+
+	attrs := []slog.Attr{
+		slog.String("namespace", z.logNamespace()),
+		slog.Bool("reverse", !forward),
+	}
+
+	if start != nil {
+		attrs = append(attrs, slog.Group("start", z.keyAttr(start)))
+	}
+
+	if end != nil {
+		attrs = append(attrs, slog.Group("end", z.keyAttr(end)))
+	}
+
+	logger.LogAttrs(context.Background(), slog.LevelDebug, "zdb iterator", attrs...)
+}
+
+func firstKey(cmd string, args []interface{}) ([]byte, bool) {
+	if !keyCommands[cmd] || len(args) == 0 {
+		return nil, false
+	}
+
+	key, ok := args[0].([]byte)
+
+	return key, ok
+}
@@ -0,0 +1,99 @@
+package db
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"log/slog"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func logRecords(t *testing.T, buf *bytes.Buffer) []map[string]interface{} {
+	t.Helper()
+
+	var records []map[string]interface{}
+	for _, line := range bytes.Split(bytes.TrimSpace(buf.Bytes()), []byte("\n")) {
+		if len(line) == 0 {
+			continue
+		}
+
+		var record map[string]interface{}
+		require.NoError(t, json.Unmarshal(line, &record))
+		records = append(records, record)
+	}
+
+	return records
+}
+
+func TestLogger(t *testing.T) {
+	_, server := newTestZDB(t)
+
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewJSONHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug}))
+
+	z, err := NewZDB(server.Addr(), WithLogger(logger))
+	require.NoError(t, err)
+	defer z.Close()
+
+	require.NoError(t, z.Set([]byte("secret-key"), []byte("secret-value")))
+	_, err = z.Get([]byte("secret-key"))
+	require.NoError(t, err)
+
+	it, err := z.Iterator([]byte("secret-key"), nil)
+	require.NoError(t, err)
+	require.NoError(t, it.Close())
+
+	assert.NotContains(t, buf.String(), "secret")
+	assert.NotContains(t, buf.String(), hex.EncodeToString([]byte("secret")))
+
+	records := logRecords(t, &buf)
+	require.GreaterOrEqual(t, len(records), 3)
+
+	set := records[0]
+	assert.Equal(t, "DEBUG", set["level"])
+	assert.Equal(t, "zdb command", set["msg"])
+	assert.Equal(t, "SET", set["command"])
+	assert.Equal(t, "default", set["namespace"])
+	assert.Len(t, set["key_hash"], 16)
+	assert.Contains(t, set, "latency")
+
+	get := records[1]
+	assert.Equal(t, "GET", get["command"])
+	assert.Equal(t, set["key_hash"], get["key_hash"])
+
+	iterator := records[2]
+	assert.Equal(t, "zdb iterator", iterator["msg"])
+	assert.Equal(t, map[string]interface{}{"key_hash": set["key_hash"]}, iterator["start"])
+
+	// connection failures are warnings
+	buf.Reset()
+	require.NoError(t, server.Close())
+	_, err = z.Get([]byte("secret-key"))
+	require.Error(t, err)
+
+	records = logRecords(t, &buf)
+	require.Len(t, records, 1)
+	assert.Equal(t, "WARN", records[0]["level"])
+	assert.Contains(t, records[0], "error")
+}
+
+func TestKeyLogging(t *testing.T) {
+	_, server := newTestZDB(t)
+
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewJSONHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug}))
+
+	z, err := NewZDB(server.Addr(), WithLogger(logger), WithKeyLogging())
+	require.NoError(t, err)
+	defer z.Close()
+
+	require.NoError(t, z.Set([]byte("key"), []byte("secret-value")))
+
+	records := logRecords(t, &buf)
+	require.Len(t, records, 1)
+	assert.Equal(t, hex.EncodeToString([]byte("key")), records[0]["key"])
+	assert.NotContains(t, buf.String(), "secret")
+}
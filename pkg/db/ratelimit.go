@@ -0,0 +1,294 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// OpClass is the class of an operation, every class is limited separately.
+type OpClass int
+
+const (
+	OpRead OpClass = iota
+	OpWrite
+	OpScan
+	opClasses
+)
+
+func (c OpClass) String() string {
+	switch c {
+	case OpRead:
+		return "read"
+	case OpWrite:
+		return "write"
+	case OpScan:
+		return "scan"
+	default:
+		return fmt.Sprintf("OpClass(%d)", int(c))
+	}
+}
+
+// Priority is the lane the operations of a ZDB are admitted in.
+type Priority int
+
+const (
+	// PriorityNormal operations wait for tokens, ahead of PriorityLow ones.
+	PriorityNormal Priority = iota
+	// PriorityHigh operations never wait. They still take tokens, so the other lanes wait
+	// longer to keep the overall rate.
+	PriorityHigh
+	// PriorityLow operations wait until no PriorityNormal operation is waiting, for background
+	// jobs such as exports and reindexing.
+	PriorityLow
+	priorities
+)
+
+// ErrThrottled is returned by the operations which waited for the rate limiter longer than
+// the timeout given with WithThrottleTimeout.
+var ErrThrottled = errors.New("operation throttled for too long")
+
+// minThrottleWait is the shortest time a throttled operation sleeps before checking again.
+const minThrottleWait = time.Millisecond
+
+// Limit is a token bucket limit.
+type Limit struct {
+	// Rate is the number of operations per second, zero means no limit.
+	Rate float64
+	// Burst is the number of operations allowed at once, Rate rounded up if zero.
+	Burst int
+}
+
+// RateLimits holds the limit of every operation class.
+type RateLimits struct {
+	Read  Limit
+	Write Limit
+	Scan  Limit
+}
+
+// ThrottleStats counts the operations of a class which had to wait, and the time they waited.
+type ThrottleStats struct {
+	Throttled uint64
+	Delay     time.Duration
+}
+
+// RateLimiter limits the operations of the ZDB instances it is given to. Clones share the
+// limiter of the instance they were cloned from.
+type RateLimiter struct {
+	buckets [opClasses]*bucket
+}
+
+func NewRateLimiter(limits RateLimits) *RateLimiter {
+	return &RateLimiter{
+		buckets: [opClasses]*bucket{
+			OpRead:  newBucket(limits.Read),
+			OpWrite: newBucket(limits.Write),
+			OpScan:  newBucket(limits.Scan),
+		},
+	}
+}
+
+// WithRateLimit admits the operations through the rate limiter.
+func WithRateLimit(l *RateLimiter) Option {
+	return func(z *ZDB) {
+		z.limiter = l
+	}
+}
+
+// WithPriority sets the lane the operations are admitted in, PriorityNormal by default.
+func WithPriority(p Priority) Option {
+	return func(z *ZDB) {
+		z.priority = p
+	}
+}
+
+// WithThrottleTimeout fails the operations waiting for the rate limiter longer than d with
+// ErrThrottled. They wait as long as needed by default.
+func WithThrottleTimeout(d time.Duration) Option {
+	return func(z *ZDB) {
+		z.throttleTimeout = d
+	}
+}
+
+// Wait blocks until n operations of the class can be admitted in the lane, or the context is
+// done. No token is taken if it returns an error.
+func (l *RateLimiter) Wait(ctx context.Context, class OpClass, p Priority, n int) error {
+	if class < 0 || class >= opClasses {
+		return nil
+	}
+
+	return l.buckets[class].wait(ctx, p, n)
+}
+
+// Stats returns the throttling counters of every class.
+func (l *RateLimiter) Stats() map[OpClass]ThrottleStats {
+	stats := make(map[OpClass]ThrottleStats, opClasses)
+	for class, b := range l.buckets {
+		if b == nil {
+			continue
+		}
+
+		stats[OpClass(class)] = ThrottleStats{
+			Throttled: b.throttled.Load(),
+			Delay:     time.Duration(b.delay.Load()),
+		}
+	}
+
+	return stats
+}
+
+// throttle waits until n operations of the class can be sent, up to the throttle timeout.
+func (z *ZDB) throttle(class OpClass, n int) error {
+	if z.limiter == nil {
+		return nil
+	}
+
+	ctx := context.Background()
+	if z.throttleTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, z.throttleTimeout)
+		defer cancel()
+	}
+
+	if err := z.limiter.Wait(ctx, class, z.priority, n); err != nil {
+		return fmt.Errorf("%w: %w", ErrThrottled, err)
+	}
+
+	return nil
+}
+
+func (z *ZDB) rateLimitStats(stats map[string]string) {
+	if z.limiter == nil {
+		return
+	}
+
+	for class, s := range z.limiter.Stats() {
+		stats["ratelimit_"+class.String()+"_throttled"] = strconv.FormatUint(s.Throttled, 10)
+		stats["ratelimit_"+class.String()+"_delay_ms"] = strconv.FormatInt(s.Delay.Milliseconds(), 10)
+	}
+}
+
+type bucket struct {
+	rate  float64
+	burst float64
+
+	mu      sync.Mutex
+	tokens  float64
+	last    time.Time
+	waiting [priorities]int
+
+	throttled atomic.Uint64
+	delay     atomic.Int64
+}
+
+func newBucket(l Limit) *bucket {
+	if l.Rate <= 0 {
+		return nil
+	}
+
+	burst := float64(l.Burst)
+	if burst <= 0 {
+		burst = math.Ceil(l.Rate)
+	}
+
+	return &bucket{
+		rate:   l.Rate,
+		burst:  burst,
+		tokens: burst,
+		last:   time.Now(),
+	}
+}
+
+func (b *bucket) refill(now time.Time) {
+	b.tokens = math.Min(b.burst, b.tokens+now.Sub(b.last).Seconds()*b.rate)
+	b.last = now
+}
+
+// wait takes n tokens, once they are available and no operation of a higher lane is waiting,
+// or fails once the context is done. More tokens than the burst can be taken at once, the
+// bucket then owes them.
+func (b *bucket) wait(ctx context.Context, p Priority, n int) error {
+	if b == nil || n <= 0 {
+		return nil
+	}
+
+	if p < 0 || p >= priorities {
+		p = PriorityNormal
+	}
+
+	need := math.Min(float64(n), b.burst)
+	start := time.Now()
+	throttled := false
+
+	var timer *time.Timer
+	defer func() {
+		if timer != nil {
+			timer.Stop()
+		}
+	}()
+
+	b.mu.Lock()
+	for {
+		b.refill(time.Now())
+
+		yield := p == PriorityLow && b.waiting[PriorityNormal] > 0
+		if p == PriorityHigh || (b.tokens >= need && !yield) {
+			break
+		}
+
+		if !throttled {
+			throttled = true
+			b.waiting[p]++
+		}
+
+		sleep := time.Duration((need - b.tokens) / b.rate * float64(time.Second))
+		if sleep < minThrottleWait {
+			sleep = minThrottleWait
+		}
+
+		b.mu.Unlock()
+
+		if timer == nil {
+			timer = time.NewTimer(sleep)
+		} else {
+			timer.Reset(sleep)
+		}
+
+		select {
+		case <-ctx.Done():
+			b.mu.Lock()
+			b.waiting[p]--
+			b.mu.Unlock()
+
+			b.record(start)
+
+			return ctx.Err()
+		case <-timer.C:
+		}
+
+		b.mu.Lock()
+	}
+
+	b.tokens -= float64(n)
+	if throttled {
+		b.waiting[p]--
+	}
+	b.mu.Unlock()
+
+	if throttled {
+		b.record(start)
+	}
+
+	return nil
+}
+
+// record counts an operation throttled since start.
+func (b *bucket) record(start time.Time) {
+	b.throttled.Add(1)
+	b.delay.Add(int64(time.Since(start)))
+}
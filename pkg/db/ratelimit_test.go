@@ -0,0 +1,133 @@
+package db
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRateLimiter(t *testing.T) {
+	ctx := context.Background()
+	l := NewRateLimiter(RateLimits{Write: Limit{Rate: 100, Burst: 1}})
+
+	start := time.Now()
+	for i := 0; i < 6; i++ {
+		l.Wait(ctx, OpWrite, PriorityNormal, 1)
+	}
+	assert.GreaterOrEqual(t, time.Since(start), 40*time.Millisecond)
+
+	stats := l.Stats()
+	assert.Equal(t, uint64(5), stats[OpWrite].Throttled)
+	assert.Greater(t, stats[OpWrite].Delay, 30*time.Millisecond)
+
+	// classes without a limit are not throttled
+	start = time.Now()
+	for i := 0; i < 100; i++ {
+		l.Wait(ctx, OpRead, PriorityNormal, 1)
+	}
+	assert.Less(t, time.Since(start), 10*time.Millisecond)
+	assert.NotContains(t, l.Stats(), OpRead)
+
+	// high priority operations skip ahead, and the bucket owes their tokens
+	start = time.Now()
+	for i := 0; i < 5; i++ {
+		l.Wait(ctx, OpWrite, PriorityHigh, 1)
+	}
+	assert.Less(t, time.Since(start), 10*time.Millisecond)
+
+	start = time.Now()
+	l.Wait(ctx, OpWrite, PriorityNormal, 1)
+	assert.GreaterOrEqual(t, time.Since(start), 40*time.Millisecond)
+}
+
+func TestRateLimiterLanes(t *testing.T) {
+	ctx := context.Background()
+	l := NewRateLimiter(RateLimits{Scan: Limit{Rate: 20, Burst: 1}})
+	l.Wait(ctx, OpScan, PriorityNormal, 1)
+
+	var (
+		mu    sync.Mutex
+		order []Priority
+		wg    sync.WaitGroup
+	)
+	admit := func(p Priority) {
+		defer wg.Done()
+
+		l.Wait(ctx, OpScan, p, 1)
+
+		mu.Lock()
+		order = append(order, p)
+		mu.Unlock()
+	}
+
+	wg.Add(2)
+	go admit(PriorityLow)
+	time.Sleep(10 * time.Millisecond)
+	go admit(PriorityNormal)
+	wg.Wait()
+
+	assert.Equal(t, []Priority{PriorityNormal, PriorityLow}, order)
+}
+
+func TestZDBRateLimit(t *testing.T) {
+	_, server := newTestZDB(t)
+
+	l := NewRateLimiter(RateLimits{Write: Limit{Rate: 200, Burst: 2}})
+	z, err := NewZDB(server.Addr(), WithRateLimit(l))
+	require.NoError(t, err)
+	defer z.Close()
+
+	c, err := z.Clone()
+	require.NoError(t, err)
+	defer c.Close()
+
+	for i := 0; i < 4; i++ {
+		require.NoError(t, z.Set([]byte{byte('a' + i)}, []byte("value")))
+		require.NoError(t, c.Set([]byte{byte('a' + i)}, []byte("value")))
+	}
+
+	b := z.NewBatch()
+	for i := 0; i < 10; i++ {
+		require.NoError(t, b.Set([]byte{byte('k'), byte(i)}, []byte("value")))
+	}
+	require.NoError(t, b.Write())
+
+	// clones share the limiter
+	stats := z.Stats()
+	assert.NotEqual(t, "0", stats["ratelimit_write_throttled"])
+	assert.Greater(t, l.Stats()[OpWrite].Delay, 20*time.Millisecond)
+	assert.NotContains(t, stats, "ratelimit_read_throttled")
+}
+
+func TestRateLimiterCancel(t *testing.T) {
+	l := NewRateLimiter(RateLimits{Write: Limit{Rate: 1, Burst: 1}})
+	require.NoError(t, l.Wait(context.Background(), OpWrite, PriorityNormal, 1))
+
+	// the next token comes in a second
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	err := l.Wait(ctx, OpWrite, PriorityNormal, 1)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.Less(t, time.Since(start), 500*time.Millisecond)
+
+	// the waits of every lane can be canceled
+	ctx, cancel = context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	assert.ErrorIs(t, l.Wait(ctx, OpWrite, PriorityLow, 1), context.DeadlineExceeded)
+	assert.Equal(t, uint64(2), l.Stats()[OpWrite].Throttled)
+
+	_, server := newTestZDB(t)
+	z, err := NewZDB(server.Addr(), WithRateLimit(l), WithThrottleTimeout(20*time.Millisecond))
+	require.NoError(t, err)
+	defer z.Close()
+
+	err = z.Set([]byte("key"), []byte("value"))
+	assert.ErrorIs(t, err, ErrThrottled)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+}
@@ -0,0 +1,63 @@
+package db
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrReadOnlyMode is returned by the writes and administrative calls of a ZDB opened with
+// WithReadOnly. Nothing is sent to ZDB.
+var ErrReadOnlyMode = errors.New("zdb is opened in read-only mode")
+
+// WithReadOnly refuses every write with ErrReadOnlyMode, for nodes which only serve reads or
+// to inspect a database without risking to change it.
+func WithReadOnly() Option {
+	return func(z *ZDB) {
+		z.readOnly = true
+	}
+}
+
+// OpenReadOnly connects to ZDB with WithReadOnly and selects the namespace, or stays on the
+// default namespace if it is empty. Public namespaces can be opened without their password.
+// It fails if the namespace can't be read.
+func OpenReadOnly(address, namespace string, opts ...Option) (*ZDB, error) {
+	opts = append(opts[:len(opts):len(opts)], WithReadOnly())
+
+	z, err := NewZDB(address, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	if namespace != "" {
+		if err := z.Select(namespace); err != nil {
+			z.Close()
+			return nil, fmt.Errorf("failed to open namespace %s: %w", namespace, err)
+		}
+	}
+
+	if err := z.checkReadable(); err != nil {
+		z.Close()
+		return nil, fmt.Errorf("namespace %s is not readable: %w", z.logNamespace(), err)
+	}
+
+	return &z, nil
+}
+
+// checkReadable lists the first key of the namespace, an empty namespace is readable.
+func (z *ZDB) checkReadable() error {
+	_, err := z.Scan()
+	if errors.Is(err, ErrCursorNoMoreData) {
+		return nil
+	}
+
+	return err
+}
+
+// writable fails with ErrReadOnlyMode if the ZDB is read-only.
+func (z *ZDB) writable() error {
+	if z.readOnly {
+		return ErrReadOnlyMode
+	}
+
+	return nil
+}
@@ -0,0 +1,91 @@
+package db
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReadOnly(t *testing.T) {
+	z, server := newTestZDB(t)
+
+	require.NoError(t, z.NewNamespace("app"))
+	require.NoError(t, z.Select("app"))
+	require.NoError(t, z.Set([]byte("key"), []byte("value")))
+
+	_, err := z.con.Do("NSSET", "app", "password", "secret")
+	require.NoError(t, err)
+
+	r, err := OpenReadOnly(server.Addr(), "app")
+	require.NoError(t, err)
+	defer r.Close()
+
+	value, err := r.Get([]byte("key"))
+	require.NoError(t, err)
+	assert.Equal(t, []byte("value"), value)
+
+	assert.ErrorIs(t, r.Set([]byte("key"), []byte("other")), ErrReadOnlyMode)
+	assert.ErrorIs(t, r.Delete([]byte("key")), ErrReadOnlyMode)
+	assert.ErrorIs(t, r.NewNamespace("other"), ErrReadOnlyMode)
+	assert.ErrorIs(t, r.DeleteNamespace("app"), ErrReadOnlyMode)
+
+	batch := r.NewBatch()
+	defer batch.Close()
+	require.NoError(t, batch.Set([]byte("key"), []byte("other")))
+	assert.ErrorIs(t, batch.Write(), ErrReadOnlyMode)
+
+	// clones are read-only as well
+	c, err := r.Clone()
+	require.NoError(t, err)
+	defer c.Close()
+	assert.ErrorIs(t, c.Set([]byte("key"), []byte("other")), ErrReadOnlyMode)
+
+	value, err = z.Get([]byte("key"))
+	require.NoError(t, err)
+	assert.Equal(t, []byte("value"), value)
+}
+
+func TestReadOnlyEmptyNamespace(t *testing.T) {
+	_, server := newTestZDB(t)
+
+	r, err := OpenReadOnly(server.Addr(), "")
+	require.NoError(t, err)
+	defer r.Close()
+
+	value, err := r.Get([]byte("key"))
+	require.NoError(t, err)
+	assert.Nil(t, value)
+}
+
+func TestReadOnlyNotReadable(t *testing.T) {
+	z, server := newTestZDB(t)
+
+	_, err := OpenReadOnly(server.Addr(), "missing")
+	assert.ErrorIs(t, err, ErrNamespaceNotFound)
+
+	require.NoError(t, z.NewNamespace("app"))
+	_, err = z.con.Do("NSSET", "app", "password", "secret")
+	require.NoError(t, err)
+	_, err = z.con.Do("NSSET", "app", "public", 0)
+	require.NoError(t, err)
+
+	_, err = OpenReadOnly(server.Addr(), "app")
+	assert.ErrorIs(t, err, ErrPermissionDenied)
+}
+
+func TestPublicNamespaceWithoutPassword(t *testing.T) {
+	z, server := newTestZDB(t)
+
+	require.NoError(t, z.NewNamespace("app"))
+	_, err := z.con.Do("NSSET", "app", "password", "secret")
+	require.NoError(t, err)
+
+	// ZDB refuses the writes of a connection which did not give the password
+	w, err := NewZDB(server.Addr())
+	require.NoError(t, err)
+	defer w.Close()
+	require.NoError(t, w.Select("app"))
+
+	assert.ErrorIs(t, w.Set([]byte("key"), []byte("value")), ErrReadOnly)
+}
@@ -0,0 +1,94 @@
+package failover
+
+import (
+	"errors"
+
+	"github.com/mariobassem/tendermint-zdb/pkg/db"
+	tmdb "github.com/tendermint/tm-db"
+)
+
+var errBatchClosed = errors.New("batch has been written or closed")
+
+type op struct {
+	key    []byte
+	value  []byte
+	delete bool
+}
+
+// batch collects operations, and writes them to the endpoint active when it is written.
+type batch struct {
+	db     *DB
+	ops    []op
+	closed bool
+}
+
+var _ tmdb.Batch = (*batch)(nil)
+
+// Set sets a key/value pair.
+// CONTRACT: key, value readonly []byte
+func (b *batch) Set(key, value []byte) error {
+	if b.closed {
+		return errBatchClosed
+	}
+
+	b.ops = append(b.ops, op{key: key, value: value})
+
+	return nil
+}
+
+// Delete deletes a key/value pair.
+// CONTRACT: key readonly []byte
+func (b *batch) Delete(key []byte) error {
+	if b.closed {
+		return errBatchClosed
+	}
+
+	b.ops = append(b.ops, op{key: key, delete: true})
+
+	return nil
+}
+
+// Write writes the batch to the active endpoint.
+func (b *batch) Write() error {
+	if b.closed {
+		return errBatchClosed
+	}
+
+	err := b.db.write(func(conn *db.ZDB) error {
+		zb := conn.NewBatch()
+		defer zb.Close()
+
+		for _, o := range b.ops {
+			var err error
+			if o.delete {
+				err = zb.Delete(o.key)
+			} else {
+				err = zb.Set(o.key, o.value)
+			}
+
+			if err != nil {
+				return err
+			}
+		}
+
+		return zb.Write()
+	})
+	if err != nil {
+		return err
+	}
+
+	return b.Close()
+}
+
+// WriteSync writes the batch to the active endpoint.
+func (b *batch) WriteSync() error {
+	return b.Write()
+}
+
+// Close closes the batch without writing it.
+func (b *batch) Close() error {
+	b.closed = true
+	b.ops = nil
+
+	return nil
+}
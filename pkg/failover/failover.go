@@ -0,0 +1,664 @@
+// Package failover spreads a tm-db database over a list of ZDB endpoints, and moves reads and
+// writes to a healthy endpoint when the active one fails.
+//
+// Endpoints are probed in the background with PING and INFO. When the active endpoint fails,
+// the policy picks the next one: another primary, or a replica serving reads only. Every
+// change is reported as an Event, so the node can stop writing instead of diverging.
+package failover
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/mariobassem/tendermint-zdb/pkg/db"
+	"github.com/mariobassem/tendermint-zdb/pkg/zdb"
+	tmdb "github.com/tendermint/tm-db"
+)
+
+const (
+	DefaultProbeInterval    = time.Second
+	DefaultProbeTimeout     = time.Second
+	DefaultFailureThreshold = 3
+)
+
+var _ tmdb.DB = (*DB)(nil)
+
+var (
+	ErrReadOnly    = errors.New("active endpoint is a replica, writes are rejected")
+	ErrUnavailable = errors.New("no healthy endpoint")
+)
+
+// Role is the role of an endpoint.
+type Role int
+
+const (
+	// Primary endpoints accept reads and writes.
+	Primary Role = iota
+	// Replica endpoints hold a copy of a primary, and only serve reads.
+	Replica
+)
+
+func (r Role) String() string {
+	if r == Replica {
+		return "replica"
+	}
+
+	return "primary"
+}
+
+// Endpoint is a ZDB namespace served by a server.
+type Endpoint struct {
+	Address   string
+	Namespace string
+	Role      Role
+}
+
+func (e Endpoint) String() string {
+	return fmt.Sprintf("%s %s/%s", e.Role, e.Address, e.Namespace)
+}
+
+// Policy decides which endpoint takes over when the active one fails.
+type Policy int
+
+const (
+	// ReplicaFallback only writes to the first primary. While it is down, reads are served by
+	// a replica and writes fail with ErrReadOnly. The first primary is used again once healthy.
+	ReplicaFallback Policy = iota
+	// Promote moves reads and writes to the next healthy primary, and keeps using it once the
+	// failed primary is back. Replicas serve reads while no primary is healthy.
+	Promote
+)
+
+// EventType is the kind of an Event.
+type EventType int
+
+const (
+	// EndpointDown is sent when an endpoint failed FailureThreshold probes in a row.
+	EndpointDown EventType = iota
+	// EndpointUp is sent when a down endpoint answers probes again.
+	EndpointUp
+	// Switched is sent when reads and writes moved to another endpoint.
+	Switched
+	// ReadOnly is sent when the active endpoint became a replica, writes fail until Writable.
+	ReadOnly
+	// Writable is sent when writes are accepted again.
+	Writable
+	// Unavailable is sent when no endpoint is healthy.
+	Unavailable
+)
+
+func (t EventType) String() string {
+	switch t {
+	case EndpointDown:
+		return "endpoint down"
+	case EndpointUp:
+		return "endpoint up"
+	case Switched:
+		return "switched"
+	case ReadOnly:
+		return "read only"
+	case Writable:
+		return "writable"
+	case Unavailable:
+		return "unavailable"
+	default:
+		return "unknown"
+	}
+}
+
+// Event reports a change of an endpoint health, or of the active endpoint.
+type Event struct {
+	Type EventType
+	// Endpoint is the endpoint that went down or up, or the new active endpoint.
+	Endpoint Endpoint
+	// Previous is the previously active endpoint of a Switched event.
+	Previous Endpoint
+	// Err is the error that made an endpoint go down.
+	Err  error
+	Time time.Time
+}
+
+// Options configures failover.
+type Options struct {
+	Policy Policy
+	// ProbeInterval is the interval between two probes of every endpoint.
+	ProbeInterval time.Duration
+	// ProbeTimeout bounds the time an endpoint has to answer a probe.
+	ProbeTimeout time.Duration
+	// FailureThreshold is the number of failed probes in a row after which an endpoint is down.
+	// A connection error of the active endpoint marks it down right away.
+	FailureThreshold int
+	// DBOptions configure the connection to the active endpoint.
+	DBOptions []db.Option
+	// OnEvent is called with every event, from the goroutine that detected it. It must not
+	// call methods of the DB.
+	OnEvent func(Event)
+}
+
+type endpointState struct {
+	Endpoint
+	probe    *zdb.Client
+	failures int
+	down     bool
+}
+
+// DB is a tmdb.DB backed by the active endpoint of a list.
+type DB struct {
+	opts Options
+
+	// switchMu serializes switching endpoints.
+	switchMu  sync.Mutex
+	mu        sync.RWMutex
+	endpoints []*endpointState
+	active    int
+	conn      *db.ZDB
+	writable  bool
+	// connMu serializes the commands sent on conn, a connection can't be used concurrently.
+	connMu sync.Mutex
+
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+// New probes the endpoints, connects to the one the policy picks, and starts probing them in
+// the background.
+func New(endpoints []Endpoint, opts Options) (*DB, error) {
+	if len(endpoints) == 0 {
+		return nil, errors.New("no endpoints")
+	}
+
+	if opts.ProbeInterval <= 0 {
+		opts.ProbeInterval = DefaultProbeInterval
+	}
+
+	if opts.ProbeTimeout <= 0 {
+		opts.ProbeTimeout = DefaultProbeTimeout
+	}
+
+	if opts.FailureThreshold <= 0 {
+		opts.FailureThreshold = DefaultFailureThreshold
+	}
+
+	d := &DB{opts: opts, active: -1, writable: true}
+	for _, e := range endpoints {
+		client := zdb.NewClient(e.Address)
+		d.endpoints = append(d.endpoints, &endpointState{Endpoint: e, probe: &client})
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	d.cancel = cancel
+
+	// the first probe decides the initial endpoint, so failures count at once
+	for _, e := range d.endpoints {
+		if err := d.probe(ctx, e); err != nil {
+			e.down = true
+		}
+	}
+
+	if err := d.failover(); err != nil {
+		d.Close()
+		return nil, err
+	}
+
+	d.wg.Add(1)
+	go d.probeEvery(ctx)
+
+	return d, nil
+}
+
+func (d *DB) probe(ctx context.Context, e *endpointState) error {
+	ctx, cancel := context.WithTimeout(ctx, d.opts.ProbeTimeout)
+	defer cancel()
+
+	if err := e.probe.Ping(ctx); err != nil {
+		return err
+	}
+
+	_, err := e.probe.Info(ctx)
+	return err
+}
+
+func (d *DB) probeEvery(ctx context.Context) {
+	defer d.wg.Done()
+
+	ticker := time.NewTicker(d.opts.ProbeInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		changed := false
+		for _, e := range d.endpoints {
+			err := d.probe(ctx, e)
+			if ctx.Err() != nil {
+				return
+			}
+
+			d.mu.Lock()
+			changed = d.record(e, err) || changed
+			d.mu.Unlock()
+		}
+
+		if changed {
+			// failover reports the errors as events
+			_ = d.failover()
+		}
+	}
+}
+
+// record updates the health of an endpoint with the result of a probe, and returns whether
+// it went down or up. The caller must hold d.mu.
+func (d *DB) record(e *endpointState, err error) bool {
+	if err == nil {
+		e.failures = 0
+		if !e.down {
+			return false
+		}
+
+		e.down = false
+		d.emit(Event{Type: EndpointUp, Endpoint: e.Endpoint})
+
+		return true
+	}
+
+	e.failures++
+	if e.down || e.failures < d.opts.FailureThreshold {
+		return false
+	}
+
+	e.down = true
+	d.emit(Event{Type: EndpointDown, Endpoint: e.Endpoint, Err: err})
+
+	return true
+}
+
+// pick returns the endpoint the policy wants active, or -1. The caller must hold d.mu.
+func (d *DB) pick() int {
+	healthy := func(idx int) bool { return !d.endpoints[idx].down }
+
+	firstPrimary := -1
+	for idx, e := range d.endpoints {
+		if e.Role == Primary {
+			firstPrimary = idx
+			break
+		}
+	}
+
+	switch {
+	case d.opts.Policy == ReplicaFallback && firstPrimary >= 0 && healthy(firstPrimary):
+		return firstPrimary
+	case d.opts.Policy == Promote && d.active >= 0 && d.endpoints[d.active].Role == Primary && healthy(d.active):
+		// a promoted primary stays active, switching back could lose its writes
+		return d.active
+	case d.opts.Policy == Promote:
+		for idx, e := range d.endpoints {
+			if e.Role == Primary && healthy(idx) {
+				return idx
+			}
+		}
+	}
+
+	for idx, e := range d.endpoints {
+		if e.Role == Replica && healthy(idx) {
+			return idx
+		}
+	}
+
+	return -1
+}
+
+// failover connects to the endpoint the policy picks, if it isn't the active one already.
+// An endpoint that can't be connected to is marked down, and the next one is tried.
+func (d *DB) failover() error {
+	d.switchMu.Lock()
+	defer d.switchMu.Unlock()
+
+	for {
+		d.mu.RLock()
+		target := d.pick()
+		current := d.active
+		d.mu.RUnlock()
+
+		if target < 0 {
+			d.mu.Lock()
+			if current >= 0 {
+				d.setConn(-1, nil)
+			}
+			d.mu.Unlock()
+
+			return ErrUnavailable
+		}
+
+		if target == current {
+			return nil
+		}
+
+		e := d.endpoints[target]
+		conn, err := d.connect(e.Endpoint)
+
+		d.mu.Lock()
+		if err != nil {
+			e.down = true
+			d.emit(Event{Type: EndpointDown, Endpoint: e.Endpoint, Err: err})
+			d.mu.Unlock()
+
+			continue
+		}
+
+		d.setConn(target, conn)
+		d.mu.Unlock()
+
+		return nil
+	}
+}
+
+// setConn replaces the active connection, and reports the switch. The caller must hold d.mu.
+func (d *DB) setConn(target int, conn *db.ZDB) {
+	var previous Endpoint
+	if d.active >= 0 {
+		previous = d.endpoints[d.active].Endpoint
+	}
+
+	if d.conn != nil {
+		d.conn.Close()
+	}
+
+	d.active = target
+	d.conn = conn
+
+	if target < 0 {
+		d.writable = false
+		d.emit(Event{Type: Unavailable, Previous: previous})
+
+		return
+	}
+
+	e := d.endpoints[target].Endpoint
+	d.emit(Event{Type: Switched, Endpoint: e, Previous: previous})
+
+	writable := e.Role == Primary
+	if writable != d.writable {
+		if writable {
+			d.emit(Event{Type: Writable, Endpoint: e})
+		} else {
+			d.emit(Event{Type: ReadOnly, Endpoint: e})
+		}
+	}
+
+	d.writable = writable
+}
+
+func (d *DB) connect(e Endpoint) (*db.ZDB, error) {
+	conn, err := db.NewZDB(e.Address, d.opts.DBOptions...)
+	if err != nil {
+		return nil, err
+	}
+
+	if e.Namespace != "" {
+		if err := conn.Select(e.Namespace); err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+
+	return &conn, nil
+}
+
+func (d *DB) emit(e Event) {
+	if d.opts.OnEvent == nil {
+		return
+	}
+
+	e.Time = time.Now()
+	d.opts.OnEvent(e)
+}
+
+// Active returns the active endpoint, and false if none is healthy.
+func (d *DB) Active() (Endpoint, bool) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	if d.active < 0 {
+		return Endpoint{}, false
+	}
+
+	return d.endpoints[d.active].Endpoint, true
+}
+
+// ReadOnly reports whether writes are rejected, because the active endpoint is a replica or
+// no endpoint is healthy.
+func (d *DB) ReadOnly() bool {
+	e, ok := d.Active()
+	return !ok || e.Role == Replica
+}
+
+// read runs a read on the active endpoint. When the connection fails, the endpoint is marked
+// down and the read is retried once on the endpoint taking over.
+func (d *DB) read(fn func(conn *db.ZDB) error) error {
+	err := d.run(false, fn)
+	if !isConnectionError(err) {
+		return err
+	}
+
+	return d.run(false, fn)
+}
+
+// write runs a write on the active endpoint. A write that failed on a broken connection may
+// have been applied, so it is not retried.
+func (d *DB) write(fn func(conn *db.ZDB) error) error {
+	return d.run(true, fn)
+}
+
+func (d *DB) run(write bool, fn func(conn *db.ZDB) error) error {
+	d.mu.RLock()
+	if d.active < 0 {
+		d.mu.RUnlock()
+		return ErrUnavailable
+	}
+
+	active := d.endpoints[d.active]
+	if write && active.Role == Replica {
+		d.mu.RUnlock()
+		return ErrReadOnly
+	}
+
+	d.connMu.Lock()
+	err := fn(d.conn)
+	d.connMu.Unlock()
+	d.mu.RUnlock()
+
+	if !isConnectionError(err) {
+		return err
+	}
+
+	d.mu.Lock()
+	if !active.down {
+		active.down = true
+		d.emit(Event{Type: EndpointDown, Endpoint: active.Endpoint, Err: err})
+	}
+	d.mu.Unlock()
+
+	if ferr := d.failover(); ferr != nil {
+		return errors.Join(err, ferr)
+	}
+
+	return err
+}
+
+// isConnectionError reports whether the error comes from the connection rather than the server.
+func isConnectionError(err error) bool {
+	if err == nil {
+		return false
+	}
+
+	var netErr net.Error
+	return errors.As(err, &netErr) ||
+		errors.Is(err, io.EOF) ||
+		errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, net.ErrClosed)
+}
+
+// Get fetches the value of the given key, or nil if it does not exist.
+// CONTRACT: key, value readonly []byte
+func (d *DB) Get(key []byte) (value []byte, err error) {
+	err = d.read(func(conn *db.ZDB) error {
+		value, err = conn.Get(key)
+		return err
+	})
+
+	return value, err
+}
+
+// Has checks if a key exists.
+// CONTRACT: key, value readonly []byte
+func (d *DB) Has(key []byte) (has bool, err error) {
+	err = d.read(func(conn *db.ZDB) error {
+		has, err = conn.Has(key)
+		return err
+	})
+
+	return has, err
+}
+
+// Set sets the value for the given key.
+// CONTRACT: key, value readonly []byte
+func (d *DB) Set(key, value []byte) error {
+	return d.write(func(conn *db.ZDB) error {
+		return conn.Set(key, value)
+	})
+}
+
+// SetSync sets the value for the given key, and flushes it to storage.
+// CONTRACT: key, value readonly []byte
+func (d *DB) SetSync(key, value []byte) error {
+	return d.write(func(conn *db.ZDB) error {
+		return conn.SetSync(key, value)
+	})
+}
+
+// Delete deletes the key.
+// CONTRACT: key readonly []byte
+func (d *DB) Delete(key []byte) error {
+	return d.write(func(conn *db.ZDB) error {
+		return conn.Delete(key)
+	})
+}
+
+// DeleteSync deletes the key, and flushes the deletion to storage.
+// CONTRACT: key readonly []byte
+func (d *DB) DeleteSync(key []byte) error {
+	return d.write(func(conn *db.ZDB) error {
+		return conn.DeleteSync(key)
+	})
+}
+
+// Iterator returns an iterator over the active endpoint. It keeps using that endpoint, and
+// fails if the endpoint does.
+// CONTRACT: No writes may happen within a domain while an iterator exists over it.
+// CONTRACT: start, end readonly []byte
+func (d *DB) Iterator(start, end []byte) (tmdb.Iterator, error) {
+	return d.iterator(func(conn *db.ZDB) (tmdb.Iterator, error) {
+		return conn.Iterator(start, end)
+	})
+}
+
+// ReverseIterator returns a reverse iterator over the active endpoint.
+// CONTRACT: No writes may happen within a domain while an iterator exists over it.
+// CONTRACT: start, end readonly []byte
+func (d *DB) ReverseIterator(start, end []byte) (tmdb.Iterator, error) {
+	return d.iterator(func(conn *db.ZDB) (tmdb.Iterator, error) {
+		return conn.ReverseIterator(start, end)
+	})
+}
+
+// iterator opens an iterator on its own connection to the active endpoint, since iterators
+// send commands until they are closed.
+func (d *DB) iterator(open func(conn *db.ZDB) (tmdb.Iterator, error)) (it tmdb.Iterator, err error) {
+	err = d.read(func(conn *db.ZDB) error {
+		c, err := conn.Clone()
+		if err != nil {
+			return err
+		}
+
+		i, err := open(c)
+		if err != nil {
+			c.Close()
+			return err
+		}
+
+		it = &connIterator{Iterator: i, conn: c}
+		return nil
+	})
+
+	return it, err
+}
+
+// connIterator closes the connection of the iterator with it.
+type connIterator struct {
+	tmdb.Iterator
+	conn *db.ZDB
+}
+
+func (i *connIterator) Close() error {
+	return errors.Join(i.Iterator.Close(), i.conn.Close())
+}
+
+// NewBatch creates a batch written to the endpoint active when it is written.
+func (d *DB) NewBatch() tmdb.Batch {
+	return &batch{db: d}
+}
+
+// Print is used for debugging.
+func (d *DB) Print() error {
+	return nil
+}
+
+// Stats returns the statistics of the active endpoint, along with its address and role.
+func (d *DB) Stats() map[string]string {
+	var stats map[string]string
+	_ = d.read(func(conn *db.ZDB) error {
+		stats = conn.Stats()
+		return nil
+	})
+
+	if stats == nil {
+		stats = map[string]string{}
+	}
+
+	if e, ok := d.Active(); ok {
+		stats["failover_endpoint"] = e.Address
+		stats["failover_role"] = e.Role.String()
+	}
+
+	return stats
+}
+
+// Close stops probing, and closes every connection.
+func (d *DB) Close() error {
+	d.cancel()
+	d.wg.Wait()
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	errs := []error{}
+	if d.conn != nil {
+		errs = append(errs, d.conn.Close())
+		d.conn = nil
+	}
+
+	for _, e := range d.endpoints {
+		errs = append(errs, e.probe.Close())
+	}
+
+	return errors.Join(errs...)
+}
@@ -0,0 +1,214 @@
+package failover
+
+import (
+	"bytes"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/mariobassem/tendermint-zdb/pkg/db"
+	"github.com/mariobassem/tendermint-zdb/pkg/zdb/zdbtest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type recorder struct {
+	mu     sync.Mutex
+	events []Event
+}
+
+func (r *recorder) record(e Event) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.events = append(r.events, e)
+}
+
+func (r *recorder) has(typ EventType, address string) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, e := range r.events {
+		if e.Type == typ && e.Endpoint.Address == address {
+			return true
+		}
+	}
+
+	return false
+}
+
+func newServer(t *testing.T) *zdbtest.Server {
+	t.Helper()
+
+	server, err := zdbtest.NewServer()
+	require.NoError(t, err)
+	t.Cleanup(func() { server.Close() })
+
+	return server
+}
+
+func testOptions(policy Policy, r *recorder) Options {
+	return Options{
+		Policy:           policy,
+		ProbeInterval:    10 * time.Millisecond,
+		ProbeTimeout:     100 * time.Millisecond,
+		FailureThreshold: 1,
+		OnEvent:          r.record,
+	}
+}
+
+func TestPromote(t *testing.T) {
+	first, second := newServer(t), newServer(t)
+	r := &recorder{}
+
+	// probes are slow enough not to notice the failure before the write does
+	opts := testOptions(Promote, r)
+	opts.ProbeInterval = 200 * time.Millisecond
+
+	d, err := New([]Endpoint{
+		{Address: first.Addr(), Role: Primary},
+		{Address: second.Addr(), Role: Primary},
+	}, opts)
+	require.NoError(t, err)
+	defer d.Close()
+
+	require.NoError(t, d.Set([]byte("key"), []byte("first")))
+
+	require.NoError(t, first.Close())
+
+	// a write on a broken connection may have been applied, it is not retried
+	assert.Error(t, d.Set([]byte("key"), []byte("second")))
+	assert.True(t, r.has(EndpointDown, first.Addr()))
+	assert.True(t, r.has(Switched, second.Addr()))
+
+	require.NoError(t, d.Set([]byte("key"), []byte("second")))
+	active, ok := d.Active()
+	require.True(t, ok)
+	assert.Equal(t, second.Addr(), active.Address)
+	assert.False(t, d.ReadOnly())
+
+	require.NoError(t, first.Restart())
+	require.Eventually(t, func() bool { return r.has(EndpointUp, first.Addr()) }, 2*time.Second, 5*time.Millisecond)
+
+	// the promoted primary stays active
+	value, err := d.Get([]byte("key"))
+	require.NoError(t, err)
+	assert.Equal(t, []byte("second"), value)
+}
+
+func TestReplicaFallback(t *testing.T) {
+	primary, replica := newServer(t), newServer(t)
+	r := &recorder{}
+
+	// replicas are kept in sync by other means
+	z, err := db.NewZDB(replica.Addr())
+	require.NoError(t, err)
+	require.NoError(t, z.Set([]byte("key"), []byte("value")))
+	require.NoError(t, z.Close())
+
+	d, err := New([]Endpoint{
+		{Address: primary.Addr(), Role: Primary},
+		{Address: replica.Addr(), Role: Replica},
+	}, testOptions(ReplicaFallback, r))
+	require.NoError(t, err)
+	defer d.Close()
+
+	require.NoError(t, d.Set([]byte("key"), []byte("value")))
+
+	require.NoError(t, primary.Close())
+
+	// reads are retried on the replica
+	value, err := d.Get([]byte("key"))
+	require.NoError(t, err)
+	assert.Equal(t, []byte("value"), value)
+	assert.True(t, r.has(ReadOnly, replica.Addr()))
+	assert.True(t, d.ReadOnly())
+
+	assert.ErrorIs(t, d.Set([]byte("key"), []byte("other")), ErrReadOnly)
+
+	b := d.NewBatch()
+	require.NoError(t, b.Set([]byte("key"), []byte("other")))
+	assert.ErrorIs(t, b.Write(), ErrReadOnly)
+
+	require.NoError(t, primary.Restart())
+	require.Eventually(t, func() bool { return r.has(Writable, primary.Addr()) }, time.Second, 5*time.Millisecond)
+
+	require.NoError(t, d.Set([]byte("key"), []byte("other")))
+	assert.False(t, d.ReadOnly())
+}
+
+func TestUnavailable(t *testing.T) {
+	server := newServer(t)
+	r := &recorder{}
+
+	d, err := New([]Endpoint{{Address: server.Addr(), Role: Primary}}, testOptions(Promote, r))
+	require.NoError(t, err)
+	defer d.Close()
+
+	require.NoError(t, server.Close())
+	require.Eventually(t, func() bool {
+		_, ok := d.Active()
+		return !ok
+	}, time.Second, 5*time.Millisecond)
+
+	_, err = d.Get([]byte("key"))
+	assert.ErrorIs(t, err, ErrUnavailable)
+	assert.True(t, r.has(Unavailable, ""))
+
+	_, err = New([]Endpoint{{Address: server.Addr(), Role: Primary}}, Options{})
+	assert.ErrorIs(t, err, ErrUnavailable)
+}
+
+func TestConcurrentAccess(t *testing.T) {
+	server := newServer(t)
+
+	d, err := New([]Endpoint{{Address: server.Addr(), Role: Primary}}, Options{})
+	require.NoError(t, err)
+	defer d.Close()
+
+	const workers = 8
+
+	var wg sync.WaitGroup
+	errs := make(chan error, workers)
+	for i := 0; i < workers; i++ {
+		key := []byte{'k', byte('0' + i)}
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 50; j++ {
+				value := []byte{byte(j)}
+				if err := d.Set(key, value); err != nil {
+					errs <- err
+					return
+				}
+
+				got, err := d.Get(key)
+				if err != nil {
+					errs <- err
+					return
+				}
+
+				if !bytes.Equal(got, value) {
+					errs <- fmt.Errorf("got %x for %s, expected %x", got, key, value)
+					return
+				}
+			}
+		}()
+	}
+
+	// iterators use their own connection, they can be used along the other calls
+	it, err := d.Iterator(nil, nil)
+	require.NoError(t, err)
+	for ; it.Valid(); it.Next() {
+	}
+	require.NoError(t, it.Error())
+	require.NoError(t, it.Close())
+
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		require.NoError(t, err)
+	}
+}
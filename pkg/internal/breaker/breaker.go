@@ -0,0 +1,263 @@
+// Package breaker implements the circuit breaker shared by the clients of ZDB.
+package breaker
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/mariobassem/tendermint-zdb/pkg/internal/zdberr"
+)
+
+// ErrOpen is returned without sending the command while the breaker is open.
+var ErrOpen = errors.New("circuit breaker is open")
+
+const (
+	DefaultErrorRate   = 0.5
+	DefaultMinRequests = 10
+	DefaultWindow      = 10 * time.Second
+	DefaultOpenTimeout = 5 * time.Second
+)
+
+// State is the state of a breaker.
+type State int
+
+const (
+	// Closed lets every command through.
+	Closed State = iota
+	// Open fails every command with ErrOpen.
+	Open
+	// HalfOpen lets a few probe commands through, to decide whether to close again.
+	HalfOpen
+)
+
+func (s State) String() string {
+	switch s {
+	case Closed:
+		return "closed"
+	case Open:
+		return "open"
+	case HalfOpen:
+		return "half-open"
+	default:
+		return fmt.Sprintf("State(%d)", int(s))
+	}
+}
+
+// Options configures a Breaker.
+type Options struct {
+	// ErrorRate is the ratio of failed commands within Window opening the breaker.
+	ErrorRate float64
+	// MinRequests is the number of commands within Window before the error rate is considered.
+	MinRequests int
+	// Window is the period commands are counted over.
+	Window time.Duration
+	// SlowThreshold counts the commands slower than it as failed, zero disables it.
+	SlowThreshold time.Duration
+	// OpenTimeout is the time the breaker stays open before letting probes through.
+	OpenTimeout time.Duration
+	// HalfOpenRequests is the number of probes which must succeed to close the breaker.
+	HalfOpenRequests int
+	// OnStateChange is called when the state of the breaker changes.
+	OnStateChange func(from, to State)
+	// Now returns the current time, time.Now if nil.
+	Now func() time.Time
+}
+
+// Breaker fails commands fast while ZDB is unhealthy, instead of letting every caller wait
+// for it. It opens when too many commands fail or are slow, or as soon as ZDB reports its
+// disk is full or it is read-only. A nil Breaker lets every command through.
+type Breaker struct {
+	opts Options
+
+	mu          sync.Mutex
+	state       State
+	windowStart time.Time
+	requests    int
+	failures    int
+	openedAt    time.Time
+	probes      int
+	successes   int
+	lastErr     error
+	// changes are the state changes to report once b.mu is released.
+	changes [][2]State
+}
+
+// New returns a closed breaker, the zero options are replaced by their defaults.
+func New(opts Options) *Breaker {
+	if opts.ErrorRate <= 0 {
+		opts.ErrorRate = DefaultErrorRate
+	}
+
+	if opts.MinRequests <= 0 {
+		opts.MinRequests = DefaultMinRequests
+	}
+
+	if opts.Window <= 0 {
+		opts.Window = DefaultWindow
+	}
+
+	if opts.OpenTimeout <= 0 {
+		opts.OpenTimeout = DefaultOpenTimeout
+	}
+
+	if opts.HalfOpenRequests <= 0 {
+		opts.HalfOpenRequests = 1
+	}
+
+	if opts.Now == nil {
+		opts.Now = time.Now
+	}
+
+	return &Breaker{
+		opts:        opts,
+		windowStart: opts.Now(),
+	}
+}
+
+// State returns the state of the breaker.
+func (b *Breaker) State() State {
+	b.mu.Lock()
+	defer b.unlock()
+
+	b.advance(b.opts.Now())
+
+	return b.state
+}
+
+// Allow fails with ErrOpen if a command can't be sent now. Every allowed command must be
+// reported with Record.
+func (b *Breaker) Allow() error {
+	if b == nil {
+		return nil
+	}
+
+	b.mu.Lock()
+	defer b.unlock()
+
+	b.advance(b.opts.Now())
+
+	switch b.state {
+	case Open:
+		return fmt.Errorf("%w: %s", ErrOpen, b.lastErr)
+	case HalfOpen:
+		if b.probes >= b.opts.HalfOpenRequests {
+			return fmt.Errorf("%w: waiting for probes", ErrOpen)
+		}
+		b.probes++
+	}
+
+	return nil
+}
+
+// Record counts the result of a command let through by Allow. Error replies about the
+// command itself, such as a missing key, are not failures.
+func (b *Breaker) Record(err error, elapsed time.Duration) {
+	if b == nil {
+		return
+	}
+
+	b.mu.Lock()
+	defer b.unlock()
+
+	now := b.opts.Now()
+	b.advance(now)
+
+	failed := isFailure(err)
+	if !failed && b.opts.SlowThreshold > 0 && elapsed > b.opts.SlowThreshold {
+		failed = true
+		err = fmt.Errorf("command took %s", elapsed)
+	}
+
+	if failed {
+		b.lastErr = err
+	}
+
+	switch b.state {
+	case HalfOpen:
+		if failed {
+			b.setState(Open, now)
+			return
+		}
+
+		b.successes++
+		if b.successes >= b.opts.HalfOpenRequests {
+			b.setState(Closed, now)
+		}
+	case Closed:
+		b.requests++
+		if !failed {
+			return
+		}
+
+		b.failures++
+		if zdberr.Unavailable(err) ||
+			(b.requests >= b.opts.MinRequests && float64(b.failures)/float64(b.requests) >= b.opts.ErrorRate) {
+			b.setState(Open, now)
+		}
+	}
+}
+
+// advance moves an open breaker to half-open once its timeout expired, and starts a new
+// counting window when the current one is over. The caller must hold b.mu.
+func (b *Breaker) advance(now time.Time) {
+	if b.state == Open && now.Sub(b.openedAt) >= b.opts.OpenTimeout {
+		b.setState(HalfOpen, now)
+	}
+
+	if b.state == Closed && now.Sub(b.windowStart) >= b.opts.Window {
+		b.windowStart = now
+		b.requests = 0
+		b.failures = 0
+	}
+}
+
+// setState changes the state, and resets the counters. The caller must hold b.mu.
+func (b *Breaker) setState(state State, now time.Time) {
+	from := b.state
+	b.state = state
+	b.windowStart = now
+	b.requests = 0
+	b.failures = 0
+	b.probes = 0
+	b.successes = 0
+
+	if state == Open {
+		b.openedAt = now
+	}
+
+	if from != state {
+		b.changes = append(b.changes, [2]State{from, state})
+	}
+}
+
+// unlock releases b.mu, then reports the state changes made while it was held.
+func (b *Breaker) unlock() {
+	changes := b.changes
+	b.changes = nil
+	b.mu.Unlock()
+
+	if b.opts.OnStateChange == nil {
+		return
+	}
+
+	for _, c := range changes {
+		b.opts.OnStateChange(c[0], c[1])
+	}
+}
+
+// isFailure reports whether an error is a sign of an unhealthy ZDB. Error replies about the
+// command itself, such as a missing key, are not.
+func isFailure(err error) bool {
+	if err == nil {
+		return false
+	}
+
+	var serverErr *zdberr.ServerError
+	if errors.As(err, &serverErr) {
+		return zdberr.Unavailable(err)
+	}
+
+	return true
+}
@@ -0,0 +1,101 @@
+package breaker
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/mariobassem/tendermint-zdb/pkg/internal/zdberr"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBreaker(t *testing.T) {
+	now := time.Unix(1000, 0)
+	var changes []State
+	b := New(Options{
+		ErrorRate:        0.5,
+		MinRequests:      4,
+		OpenTimeout:      time.Second,
+		HalfOpenRequests: 2,
+		OnStateChange:    func(from, to State) { changes = append(changes, to) },
+		Now:              func() time.Time { return now },
+	})
+
+	failure := errors.New("connection reset")
+
+	// error replies about the command don't count as failures
+	for i := 0; i < 4; i++ {
+		require.NoError(t, b.Allow())
+		b.Record(zdberr.New("Key not found", errors.New("Key not found")), 0)
+	}
+	assert.Equal(t, Closed, b.State())
+
+	for i := 0; i < 3; i++ {
+		require.NoError(t, b.Allow())
+		b.Record(failure, 0)
+		assert.Equal(t, Closed, b.State())
+	}
+
+	// 4 failures out of 8 commands
+	require.NoError(t, b.Allow())
+	b.Record(failure, 0)
+	assert.Equal(t, Open, b.State())
+
+	err := b.Allow()
+	assert.ErrorIs(t, err, ErrOpen)
+	assert.ErrorContains(t, err, failure.Error())
+
+	// once the timeout expired, only the probes are let through
+	now = now.Add(time.Second)
+	assert.Equal(t, HalfOpen, b.State())
+	require.NoError(t, b.Allow())
+	require.NoError(t, b.Allow())
+	assert.ErrorIs(t, b.Allow(), ErrOpen)
+
+	// a failed probe opens the breaker again
+	b.Record(nil, 0)
+	b.Record(failure, 0)
+	assert.Equal(t, Open, b.State())
+
+	now = now.Add(time.Second)
+	require.NoError(t, b.Allow())
+	require.NoError(t, b.Allow())
+	b.Record(nil, 0)
+	b.Record(nil, 0)
+	assert.Equal(t, Closed, b.State())
+
+	assert.Equal(t, []State{Open, HalfOpen, Open, HalfOpen, Closed}, changes)
+}
+
+func TestBreakerWindow(t *testing.T) {
+	now := time.Unix(1000, 0)
+	b := New(Options{
+		MinRequests: 2,
+		Window:      time.Second,
+		Now:         func() time.Time { return now },
+	})
+
+	require.NoError(t, b.Allow())
+	b.Record(errors.New("timeout"), 0)
+
+	// the failure of the previous window is forgotten
+	now = now.Add(time.Second)
+	require.NoError(t, b.Allow())
+	b.Record(nil, 0)
+	assert.Equal(t, Closed, b.State())
+	require.NoError(t, b.Allow())
+	b.Record(errors.New("timeout"), 0)
+	assert.Equal(t, Open, b.State())
+}
+
+func TestBreakerSlowCommands(t *testing.T) {
+	b := New(Options{MinRequests: 2, SlowThreshold: 100 * time.Millisecond})
+
+	require.NoError(t, b.Allow())
+	b.Record(nil, 10*time.Millisecond)
+	require.NoError(t, b.Allow())
+	b.Record(nil, time.Second)
+	assert.Equal(t, Open, b.State())
+	assert.ErrorContains(t, b.Allow(), "command took 1s")
+}
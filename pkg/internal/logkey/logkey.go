@@ -0,0 +1,37 @@
+// Package logkey formats the keys written to logs. Keys may hold private data, so they are
+// logged as a hash unless the caller asks to reveal them.
+package logkey
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"log/slog"
+)
+
+// hashSize is the number of bytes of the sha256 hash of a key logged in its place, enough to
+// tell keys apart and to match the same key across log lines.
+const hashSize = 8
+
+// Attr returns the key as a key_hash attribute, or as a hex encoded key attribute if reveal is
+// set. The hash is not salted, so it only hides keys which can't be guessed: a low entropy key,
+// such as a block height or a short prefix, is found back by hashing the candidates.
+func Attr(key []byte, reveal bool) slog.Attr {
+	if reveal {
+		return slog.String("key", hex.EncodeToString(key))
+	}
+
+	sum := sha256.Sum256(key)
+
+	return slog.String("key_hash", hex.EncodeToString(sum[:hashSize]))
+}
+
+// Discard is a logger dropping every record, used when no logger is configured.
+var Discard = slog.New(discardHandler{})
+
+type discardHandler struct{}
+
+func (discardHandler) Enabled(ctx context.Context, level slog.Level) bool { return false }
+func (discardHandler) Handle(ctx context.Context, r slog.Record) error    { return nil }
+func (h discardHandler) WithAttrs(attrs []slog.Attr) slog.Handler         { return h }
+func (h discardHandler) WithGroup(name string) slog.Handler               { return h }
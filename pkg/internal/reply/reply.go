@@ -0,0 +1,214 @@
+// Package reply decodes the replies of 0-db commands, as returned by the go-redis and redigo
+// clients. go-redis returns bulk strings as strings and redigo as byte slices, both are
+// accepted. Unexpected replies are reported as errors.
+package reply
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// KeyInfo is a key listed by SCAN or RSCAN.
+type KeyInfo struct {
+	Key       []byte
+	Size      uint64
+	Timestamp int64
+}
+
+// ScanReply is the reply of SCAN and RSCAN: the cursor of the last listed key, and the keys.
+type ScanReply struct {
+	Next []byte
+	Keys []KeyInfo
+}
+
+// Info parses the "name: value" lines of INFO and NSINFO, other lines are skipped.
+func Info(res string) map[string]string {
+	lines := strings.Split(res, "\n")
+	parsed := make(map[string]string, len(lines))
+	for _, line := range lines {
+		key, value, found := strings.Cut(line, ":")
+		if !found {
+			continue
+		}
+
+		parsed[key] = strings.Trim(value, " \r\n")
+	}
+
+	return parsed
+}
+
+// Scan decodes the reply of SCAN and RSCAN.
+func Scan(res []interface{}) (ScanReply, error) {
+	if len(res) != 2 {
+		return ScanReply{}, fmt.Errorf("invalid response, scan operations should return two elements, but %d were returned", len(res))
+	}
+
+	next, err := Bytes(res[0], "next key")
+	if err != nil {
+		return ScanReply{}, err
+	}
+
+	keys, err := Array(res[1], "keys")
+	if err != nil {
+		return ScanReply{}, err
+	}
+
+	ret := make([]KeyInfo, 0, len(keys))
+	for _, k := range keys {
+		fields, err := Array(k, "key information")
+		if err != nil {
+			return ScanReply{}, err
+		}
+
+		if len(fields) != 3 {
+			return ScanReply{}, fmt.Errorf("invalid response, expected key information to be a slice with 3 elements, but %d elements were returned", len(fields))
+		}
+
+		key, err := Bytes(fields[0], "key")
+		if err != nil {
+			return ScanReply{}, err
+		}
+
+		size, err := Int64(fields[1], "key size")
+		if err != nil {
+			return ScanReply{}, err
+		}
+
+		if size < 0 {
+			return ScanReply{}, fmt.Errorf("invalid response, negative key size %d", size)
+		}
+
+		ts, err := Int64(fields[2], "key creation timestamp")
+		if err != nil {
+			return ScanReply{}, err
+		}
+
+		ret = append(ret, KeyInfo{
+			Key:       key,
+			Size:      uint64(size),
+			Timestamp: ts,
+		})
+	}
+
+	return ScanReply{
+		Next: next,
+		Keys: ret,
+	}, nil
+}
+
+// Bytes returns the content of a bulk or simple string, what names it in the error.
+func Bytes(v interface{}, what string) ([]byte, error) {
+	switch b := v.(type) {
+	case []byte:
+		return b, nil
+	case string:
+		return []byte(b), nil
+	default:
+		return nil, fmt.Errorf("invalid response, expected %s to be a string, but a %T was returned", what, v)
+	}
+}
+
+// String returns the content of a bulk or simple string, what names it in the error.
+func String(v interface{}, what string) (string, error) {
+	switch s := v.(type) {
+	case []byte:
+		return string(s), nil
+	case string:
+		return s, nil
+	default:
+		return "", fmt.Errorf("invalid response, expected %s to be a string, but a %T was returned", what, v)
+	}
+}
+
+// Int64 returns an integer reply, what names it in the error.
+func Int64(v interface{}, what string) (int64, error) {
+	i, ok := v.(int64)
+	if !ok {
+		return 0, fmt.Errorf("invalid response, expected %s to be an int64, but a %T was returned", what, v)
+	}
+
+	return i, nil
+}
+
+// Array returns the elements of an array reply, what names it in the error.
+func Array(v interface{}, what string) ([]interface{}, error) {
+	a, ok := v.([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("invalid response, expected %s to be an array, but a %T was returned", what, v)
+	}
+
+	return a, nil
+}
+
+// Strings returns the elements of an array of strings, what names an element in the error.
+func Strings(v interface{}, what string) ([]string, error) {
+	elems, err := Array(v, what+" list")
+	if err != nil {
+		return nil, err
+	}
+
+	ret := make([]string, 0, len(elems))
+	for _, elem := range elems {
+		s, err := String(elem, what)
+		if err != nil {
+			return nil, err
+		}
+
+		ret = append(ret, s)
+	}
+
+	return ret, nil
+}
+
+// Time decodes the reply of TIME: the unix time in seconds and the microseconds elapsed in
+// the current second, as strings. Only the seconds are returned. A single integer is accepted
+// as well.
+func Time(v interface{}) (int64, error) {
+	t, err := Timestamp(v)
+	if err != nil {
+		return 0, err
+	}
+
+	return t.Unix(), nil
+}
+
+// Timestamp decodes the reply of TIME with its microseconds. A single integer is accepted as
+// the seconds.
+func Timestamp(v interface{}) (time.Time, error) {
+	if i, ok := v.(int64); ok {
+		return time.Unix(i, 0), nil
+	}
+
+	fields, err := Array(v, "time")
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	if len(fields) != 2 {
+		return time.Time{}, fmt.Errorf("invalid response, time should return two elements, but %d were returned", len(fields))
+	}
+
+	sec, err := String(fields[0], "seconds")
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	ts, err := strconv.ParseInt(sec, 10, 64)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid response, invalid seconds %q: %w", sec, err)
+	}
+
+	usec, err := String(fields[1], "microseconds")
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	us, err := strconv.ParseInt(usec, 10, 64)
+	if err != nil || us < 0 || us >= 1000000 {
+		return time.Time{}, fmt.Errorf("invalid response, invalid microseconds %q", usec)
+	}
+
+	return time.Unix(ts, us*1000), nil
+}
@@ -0,0 +1,215 @@
+package reply
+
+import (
+	"bufio"
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/mariobassem/tendermint-zdb/pkg/zdb/zdbtest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// decode reads a RESP reply like go-redis, or like redigo with bulk strings as byte slices.
+func decode(data []byte, redigo bool) (interface{}, bool) {
+	v, err := zdbtest.ReadReply(bufio.NewReader(bytes.NewReader(data)))
+	if err != nil {
+		return nil, false
+	}
+
+	if redigo {
+		v = toBytes(v)
+	}
+
+	return v, true
+}
+
+func toBytes(v interface{}) interface{} {
+	switch v := v.(type) {
+	case string:
+		return []byte(v)
+	case []interface{}:
+		ret := make([]interface{}, 0, len(v))
+		for _, elem := range v {
+			ret = append(ret, toBytes(elem))
+		}
+
+		return ret
+	default:
+		return v
+	}
+}
+
+func TestScan(t *testing.T) {
+	res := []interface{}{
+		"cursor",
+		[]interface{}{
+			[]interface{}{"key", int64(5), int64(1700000000)},
+			[]interface{}{[]byte("other"), int64(0), int64(1700000001)},
+		},
+	}
+
+	scan, err := Scan(res)
+	require.NoError(t, err)
+	assert.Equal(t, ScanReply{
+		Next: []byte("cursor"),
+		Keys: []KeyInfo{
+			{Key: []byte("key"), Size: 5, Timestamp: 1700000000},
+			{Key: []byte("other"), Size: 0, Timestamp: 1700000001},
+		},
+	}, scan)
+
+	invalid := [][]interface{}{
+		{"cursor"},
+		{int64(1), []interface{}{}},
+		{"cursor", "keys"},
+		{"cursor", []interface{}{"key"}},
+		{"cursor", []interface{}{[]interface{}{"key", int64(1)}}},
+		{"cursor", []interface{}{[]interface{}{int64(1), int64(1), int64(1)}}},
+		{"cursor", []interface{}{[]interface{}{"key", "1", int64(1)}}},
+		{"cursor", []interface{}{[]interface{}{"key", int64(-1), int64(1)}}},
+		{"cursor", []interface{}{[]interface{}{"key", int64(1), nil}}},
+	}
+	for _, res := range invalid {
+		_, err := Scan(res)
+		assert.Error(t, err, "%v", res)
+	}
+}
+
+func TestInfo(t *testing.T) {
+	info := Info("# namespace\r\nname: default\r\nentries: 3\r\nno separator\r\ndata_current_id: 0\r\n")
+	assert.Equal(t, map[string]string{
+		"name":            "default",
+		"entries":         "3",
+		"data_current_id": "0",
+	}, info)
+}
+
+func TestStrings(t *testing.T) {
+	got, err := Strings([]interface{}{"default", []byte("other")}, "namespace")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"default", "other"}, got)
+
+	_, err = Strings("default", "namespace")
+	assert.EqualError(t, err, "invalid response, expected namespace list to be an array, but a string was returned")
+
+	_, err = Strings([]interface{}{int64(1)}, "namespace")
+	assert.EqualError(t, err, "invalid response, expected namespace to be a string, but a int64 was returned")
+}
+
+func TestTime(t *testing.T) {
+	ts, err := Time([]interface{}{"1700000000", "123456"})
+	require.NoError(t, err)
+	assert.Equal(t, int64(1700000000), ts)
+
+	ts, err = Time(int64(1700000000))
+	require.NoError(t, err)
+	assert.Equal(t, int64(1700000000), ts)
+
+	_, err = Time([]interface{}{"now", "0"})
+	assert.Error(t, err)
+
+	_, err = Time("1700000000")
+	assert.Error(t, err)
+
+	now, err := Timestamp([]interface{}{"1700000000", "123456"})
+	require.NoError(t, err)
+	assert.Equal(t, time.Unix(1700000000, 123456000), now)
+
+	_, err = Timestamp([]interface{}{"1700000000", "1000000"})
+	assert.Error(t, err)
+}
+
+func FuzzScan(f *testing.F) {
+	f.Add(zdbtest.EncodeReply([]interface{}{
+		"\x01\x00\x00\x00",
+		[]interface{}{[]interface{}{"key", int64(5), int64(1700000000)}},
+	}))
+	f.Add(zdbtest.EncodeReply([]interface{}{"cursor", []interface{}{}}))
+	f.Add(zdbtest.EncodeReply([]interface{}{"cursor", []interface{}{[]interface{}{"key", nil, "1"}}}))
+	f.Add([]byte("*2\r\n$-1\r\n*1\r\n*3\r\n:1\r\n:-1\r\n-ERR\r\n"))
+	f.Add([]byte("-No more data\r\n"))
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		for _, redigo := range []bool{false, true} {
+			v, ok := decode(data, redigo)
+			if !ok {
+				return
+			}
+
+			res, err := Array(v, "scan")
+			if err != nil {
+				return
+			}
+
+			scan, err := Scan(res)
+			if err != nil {
+				return
+			}
+
+			if len(scan.Keys) != len(res[1].([]interface{})) {
+				t.Fatalf("decoded %d keys out of %d", len(scan.Keys), len(res[1].([]interface{})))
+			}
+		}
+	})
+}
+
+func FuzzInfo(f *testing.F) {
+	f.Add(zdbtest.EncodeReply("# server\nversion: 2.0.0\r\nuptime: 12\n\nbroken line\n:\n"))
+	f.Add([]byte("+name: default\r\n"))
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		v, ok := decode(data, false)
+		if !ok {
+			return
+		}
+
+		s, err := String(v, "info")
+		if err != nil {
+			return
+		}
+
+		for key, value := range Info(s) {
+			if bytes.ContainsAny([]byte(key), "\n") || bytes.ContainsAny([]byte(value), "\n") {
+				t.Fatalf("field %q: %q spans several lines", key, value)
+			}
+		}
+	})
+}
+
+func FuzzStrings(f *testing.F) {
+	f.Add(zdbtest.EncodeReply([]interface{}{"default", "other"}))
+	f.Add(zdbtest.EncodeReply([]interface{}{"default", int64(1), nil}))
+	f.Add([]byte("*-1\r\n"))
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		for _, redigo := range []bool{false, true} {
+			v, ok := decode(data, redigo)
+			if !ok {
+				return
+			}
+
+			_, _ = Strings(v, "namespace")
+		}
+	})
+}
+
+func FuzzTime(f *testing.F) {
+	f.Add(zdbtest.EncodeReply([]interface{}{"1700000000", "123456"}))
+	f.Add(zdbtest.EncodeReply(int64(1700000000)))
+	f.Add(zdbtest.EncodeReply([]interface{}{"99999999999999999999", "0"}))
+	f.Add([]byte("*1\r\n:1\r\n"))
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		for _, redigo := range []bool{false, true} {
+			v, ok := decode(data, redigo)
+			if !ok {
+				return
+			}
+
+			_, _ = Time(v)
+			_, _ = Timestamp(v)
+		}
+	})
+}
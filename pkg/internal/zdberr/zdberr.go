@@ -0,0 +1,97 @@
+// Package zdberr classifies the error replies of 0-db. The zdb and db packages export its
+// errors, whichever client they use.
+package zdberr
+
+import (
+	"errors"
+	"strings"
+)
+
+var (
+	ErrKeyNotFound       = errors.New("Key not found")
+	ErrCursorNoMoreData  = errors.New("No more data")
+	ErrNamespaceNotFound = errors.New("namespace not found")
+	ErrNamespaceExists   = errors.New("namespace already exists")
+	ErrNamespaceInUse    = errors.New("namespace is in use")
+	ErrPermissionDenied  = errors.New("permission denied")
+	ErrReadOnly          = errors.New("namespace is read-only")
+	ErrNamespaceFull     = errors.New("namespace is full")
+	ErrInvalidKey        = errors.New("invalid key")
+	ErrInvalidCursor     = errors.New("invalid cursor")
+	ErrInvalidArgument   = errors.New("invalid argument")
+	ErrUnsupported       = errors.New("command not supported")
+	ErrTimeout           = errors.New("timeout")
+)
+
+// kinds maps fragments of the error replies of 0-db to their kind, the first match wins.
+var kinds = []struct {
+	fragment string
+	kind     error
+}{
+	{"key not found", ErrKeyNotFound},
+	{"no more data", ErrCursorNoMoreData},
+	{"namespace not found", ErrNamespaceNotFound},
+	{"namespace is not available", ErrNamespaceExists},
+	{"cannot remove", ErrNamespaceInUse},
+	{"access denied", ErrPermissionDenied},
+	{"permission denied", ErrPermissionDenied},
+	{"protected and private", ErrPermissionDenied},
+	{"worm mode", ErrReadOnly},
+	{"read-only", ErrReadOnly},
+	{"read only", ErrReadOnly},
+	{"no space left", ErrNamespaceFull},
+	{"key too large", ErrInvalidKey},
+	{"invalid key", ErrInvalidKey},
+	{"invalid cursor", ErrInvalidCursor},
+	{"not supported", ErrUnsupported},
+	{"unknown command", ErrUnsupported},
+	{"timeout", ErrTimeout},
+	{"wrong number of arguments", ErrInvalidArgument},
+	{"invalid", ErrInvalidArgument},
+	{"unknown", ErrInvalidArgument},
+}
+
+// ServerError is an error reply of 0-db. It matches the error of its kind with errors.Is, and
+// the reply error of the client with errors.As.
+type ServerError struct {
+	// Message is the error reply, as sent by the server.
+	Message string
+	// Kind is one of the errors of this package, nil for replies which are not known.
+	Kind error
+	// Err is the error returned by the client.
+	Err error
+}
+
+// New classifies an error reply, err is the error returned by the client for it.
+func New(message string, err error) *ServerError {
+	e := &ServerError{Message: message, Err: err}
+
+	lower := strings.ToLower(message)
+	for _, k := range kinds {
+		if strings.Contains(lower, k.fragment) {
+			e.Kind = k.kind
+			break
+		}
+	}
+
+	return e
+}
+
+// Error returns the error reply unchanged.
+func (e *ServerError) Error() string {
+	return e.Message
+}
+
+func (e *ServerError) Unwrap() []error {
+	if e.Kind == nil {
+		return []error{e.Err}
+	}
+
+	return []error{e.Kind, e.Err}
+}
+
+// Unavailable reports whether the error says the namespace refuses writes for now, because it
+// is full or read-only.
+func Unavailable(err error) bool {
+	return errors.Is(err, ErrNamespaceFull) || errors.Is(err, ErrReadOnly)
+}
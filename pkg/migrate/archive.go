@@ -0,0 +1,359 @@
+package migrate
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/mariobassem/tendermint-zdb/pkg/db"
+	tmdb "github.com/tendermint/tm-db"
+)
+
+// An archive starts with archiveMagic and the format version, followed by records. Every record
+// starts with recordMarker, then the uvarint length of the key, the key, the uvarint length of
+// the value, the value, and the varint timestamp of the key. The archive ends with endMarker,
+// the uvarint record count and the digest of the records as computed by Summary.
+var archiveMagic = []byte("ZDBARCH")
+
+const (
+	archiveVersion = 1
+	recordMarker   = 1
+	endMarker      = 0
+)
+
+// MaxRecordFieldSize is the largest key or value of an archive record. Larger lengths are
+// read as a corrupted archive, rather than allocated.
+const MaxRecordFieldSize = 64 << 20
+
+var ErrInvalidArchive = errors.New("invalid archive")
+
+// Record is a key, its value and its creation timestamp.
+type Record struct {
+	Key       []byte
+	Value     []byte
+	Timestamp int64
+}
+
+// ArchiveWriter writes records to an archive.
+type ArchiveWriter struct {
+	w       *bufio.Writer
+	summary Summary
+	closed  bool
+}
+
+// NewArchiveWriter writes the archive header and returns a writer for its records.
+func NewArchiveWriter(w io.Writer) (*ArchiveWriter, error) {
+	bw := bufio.NewWriter(w)
+	if _, err := bw.Write(archiveMagic); err != nil {
+		return nil, err
+	}
+
+	if err := bw.WriteByte(archiveVersion); err != nil {
+		return nil, err
+	}
+
+	return &ArchiveWriter{w: bw}, nil
+}
+
+// Write appends a record to the archive.
+func (a *ArchiveWriter) Write(r Record) error {
+	if a.closed {
+		return errors.New("archive writer is closed")
+	}
+
+	if len(r.Key) > MaxRecordFieldSize || len(r.Value) > MaxRecordFieldSize {
+		return fmt.Errorf("record of key %x is larger than %d bytes", r.Key, MaxRecordFieldSize)
+	}
+
+	buf := make([]byte, 0, 1+3*binary.MaxVarintLen64+len(r.Key)+len(r.Value))
+	buf = append(buf, recordMarker)
+	buf = binary.AppendUvarint(buf, uint64(len(r.Key)))
+	buf = append(buf, r.Key...)
+	buf = binary.AppendUvarint(buf, uint64(len(r.Value)))
+	buf = append(buf, r.Value...)
+	buf = binary.AppendVarint(buf, r.Timestamp)
+
+	if _, err := a.w.Write(buf); err != nil {
+		return err
+	}
+
+	a.summary.Add(r.Key, r.Value)
+
+	return nil
+}
+
+// Summary returns the key count and digest of the written records.
+func (a *ArchiveWriter) Summary() Summary {
+	return a.summary
+}
+
+// Close writes the archive trailer and flushes the archive. It does not close the underlying writer.
+func (a *ArchiveWriter) Close() error {
+	if a.closed {
+		return nil
+	}
+	a.closed = true
+
+	buf := []byte{endMarker}
+	buf = binary.AppendUvarint(buf, a.summary.Keys)
+	buf = append(buf, a.summary.Digest[:]...)
+
+	if _, err := a.w.Write(buf); err != nil {
+		return err
+	}
+
+	return a.w.Flush()
+}
+
+// ArchiveReader reads the records of an archive.
+type ArchiveReader struct {
+	r       *bufio.Reader
+	summary Summary
+	done    bool
+}
+
+// NewArchiveReader checks the archive header and returns a reader for its records.
+func NewArchiveReader(r io.Reader) (*ArchiveReader, error) {
+	br := bufio.NewReader(r)
+
+	header := make([]byte, len(archiveMagic)+1)
+	if _, err := io.ReadFull(br, header); err != nil {
+		return nil, fmt.Errorf("%w: failed to read header: %s", ErrInvalidArchive, err)
+	}
+
+	if !bytes.Equal(header[:len(archiveMagic)], archiveMagic) {
+		return nil, fmt.Errorf("%w: bad magic", ErrInvalidArchive)
+	}
+
+	if header[len(archiveMagic)] != archiveVersion {
+		return nil, fmt.Errorf("%w: unsupported version %d", ErrInvalidArchive, header[len(archiveMagic)])
+	}
+
+	return &ArchiveReader{r: br}, nil
+}
+
+// Next returns the next record, or io.EOF once all records were read and the archive
+// trailer matches them.
+func (a *ArchiveReader) Next() (Record, error) {
+	if a.done {
+		return Record{}, io.EOF
+	}
+
+	marker, err := a.r.ReadByte()
+	if err != nil {
+		return Record{}, a.invalid(err)
+	}
+
+	if marker == endMarker {
+		return Record{}, a.readTrailer()
+	}
+
+	if marker != recordMarker {
+		return Record{}, fmt.Errorf("%w: unexpected record marker %d", ErrInvalidArchive, marker)
+	}
+
+	key, err := a.readBytes()
+	if err != nil {
+		return Record{}, err
+	}
+
+	value, err := a.readBytes()
+	if err != nil {
+		return Record{}, err
+	}
+
+	ts, err := binary.ReadVarint(a.r)
+	if err != nil {
+		return Record{}, a.invalid(err)
+	}
+
+	a.summary.Add(key, value)
+
+	return Record{Key: key, Value: value, Timestamp: ts}, nil
+}
+
+// Summary returns the key count and digest of the records read so far.
+func (a *ArchiveReader) Summary() Summary {
+	return a.summary
+}
+
+func (a *ArchiveReader) readBytes() ([]byte, error) {
+	size, err := binary.ReadUvarint(a.r)
+	if err != nil {
+		return nil, a.invalid(err)
+	}
+
+	if size > MaxRecordFieldSize {
+		return nil, fmt.Errorf("%w: record field of %d bytes", ErrInvalidArchive, size)
+	}
+
+	// the buffer grows with the data read, so a truncated archive doesn't allocate the whole size
+	buf, err := io.ReadAll(io.LimitReader(a.r, int64(size)))
+	if err != nil {
+		return nil, a.invalid(err)
+	}
+
+	if uint64(len(buf)) != size {
+		return nil, a.invalid(io.ErrUnexpectedEOF)
+	}
+
+	return buf, nil
+}
+
+func (a *ArchiveReader) readTrailer() error {
+	count, err := binary.ReadUvarint(a.r)
+	if err != nil {
+		return a.invalid(err)
+	}
+
+	var digest [sha256.Size]byte
+	if _, err := io.ReadFull(a.r, digest[:]); err != nil {
+		return a.invalid(err)
+	}
+
+	if count != a.summary.Keys || digest != a.summary.Digest {
+		return fmt.Errorf("%w: trailer does not match the %d records read", ErrInvalidArchive, a.summary.Keys)
+	}
+
+	a.done = true
+
+	return io.EOF
+}
+
+func (a *ArchiveReader) invalid(err error) error {
+	if errors.Is(err, io.EOF) {
+		err = io.ErrUnexpectedEOF
+	}
+
+	return fmt.Errorf("%w: %s", ErrInvalidArchive, err)
+}
+
+// Export writes every key of the selected namespace of src, with its creation timestamp, to an archive.
+func Export(ctx context.Context, src *db.ZDB, w io.Writer) (Summary, error) {
+	aw, err := NewArchiveWriter(w)
+	if err != nil {
+		return Summary{}, err
+	}
+
+	res, err := src.Scan()
+	for ; err == nil; res, err = src.ScanCursor(res.Next) {
+		if err := ctx.Err(); err != nil {
+			return aw.Summary(), err
+		}
+
+		for _, info := range res.Keys {
+			key, value, err := src.Entry(info.Key)
+			if err != nil {
+				return aw.Summary(), err
+			}
+
+			if key == nil {
+				// deleted since it was scanned
+				continue
+			}
+
+			if err := aw.Write(Record{Key: key, Value: value, Timestamp: info.Timestamp}); err != nil {
+				return aw.Summary(), err
+			}
+		}
+	}
+
+	if !errors.Is(err, db.ErrCursorNoMoreData) {
+		return aw.Summary(), err
+	}
+
+	return aw.Summary(), aw.Close()
+}
+
+// Import writes every record of an archive to dst in batches.
+func Import(ctx context.Context, r io.Reader, dst tmdb.DB, batchSize int) (Summary, error) {
+	if batchSize <= 0 {
+		batchSize = DefaultBatchSize
+	}
+
+	ar, err := NewArchiveReader(r)
+	if err != nil {
+		return Summary{}, err
+	}
+
+	batch := dst.NewBatch()
+	defer func() { batch.Close() }()
+
+	pending := 0
+	for {
+		if err := ctx.Err(); err != nil {
+			return ar.Summary(), err
+		}
+
+		rec, err := ar.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return ar.Summary(), err
+		}
+
+		if err := batch.Set(rec.Key, rec.Value); err != nil {
+			return ar.Summary(), err
+		}
+
+		pending++
+		if pending < batchSize {
+			continue
+		}
+
+		if err := batch.Write(); err != nil {
+			return ar.Summary(), err
+		}
+
+		batch.Close()
+		batch = dst.NewBatch()
+		pending = 0
+	}
+
+	return ar.Summary(), batch.Write()
+}
+
+// VerifyArchive reads the whole archive, checks its trailer, and compares its key count and
+// digest with the database.
+func VerifyArchive(ctx context.Context, r io.Reader, database tmdb.DB) error {
+	ar, err := NewArchiveReader(r)
+	if err != nil {
+		return err
+	}
+
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		_, err := ar.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	got, err := Summarize(ctx, database)
+	if err != nil {
+		return err
+	}
+
+	want := ar.Summary()
+	if want.Keys != got.Keys {
+		return fmt.Errorf("%w: archive has %d keys, database has %d", ErrVerificationFailed, want.Keys, got.Keys)
+	}
+
+	if want.Digest != got.Digest {
+		return fmt.Errorf("%w: archive digest %x, database digest %x", ErrVerificationFailed, want.Digest, got.Digest)
+	}
+
+	return nil
+}
@@ -0,0 +1,280 @@
+// Package migrate copies the content of a tm-db database into another one, for example from
+// a goleveldb data directory into a ZDB namespace and back, and exports ZDB namespaces to
+// portable archives.
+package migrate
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	tmdb "github.com/tendermint/tm-db"
+)
+
+// DefaultBatchSize is the default number of keys written per batch.
+const DefaultBatchSize = 1000
+
+var ErrVerificationFailed = errors.New("verification failed")
+
+// Options configures a copy.
+type Options struct {
+	// BatchSize is the number of keys written per batch.
+	BatchSize int
+	// StatePath is the file the progress is saved to after every batch. When it exists, the
+	// copy resumes after the last copied key. An empty path disables resuming.
+	StatePath string
+	// OnProgress is called after every written batch.
+	OnProgress func(Progress)
+}
+
+// Progress describes how far a copy went.
+type Progress struct {
+	Keys    uint64
+	Bytes   uint64
+	LastKey []byte
+	Elapsed time.Duration
+}
+
+// state is the resumable progress saved to Options.StatePath.
+type state struct {
+	LastKey string `json:"last_key"`
+	Keys    uint64 `json:"keys"`
+	Bytes   uint64 `json:"bytes"`
+	Done    bool   `json:"done"`
+}
+
+// Summary is a key count and an order independent digest of a database's content.
+type Summary struct {
+	Keys   uint64
+	Digest [sha256.Size]byte
+}
+
+// Copy streams every key of src into dst in batches, in src's key order. It returns the
+// progress of the whole copy, including the keys copied by previous interrupted runs.
+func Copy(ctx context.Context, src, dst tmdb.DB, opts Options) (Progress, error) {
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = DefaultBatchSize
+	}
+
+	st, err := loadState(opts.StatePath)
+	if err != nil {
+		return Progress{}, err
+	}
+
+	var start []byte
+	if st.LastKey != "" {
+		start, err = hex.DecodeString(st.LastKey)
+		if err != nil {
+			return Progress{}, fmt.Errorf("invalid state file %s: %w", opts.StatePath, err)
+		}
+	}
+
+	progress := Progress{
+		Keys:    st.Keys,
+		Bytes:   st.Bytes,
+		LastKey: start,
+	}
+
+	if st.Done {
+		return progress, nil
+	}
+
+	it, err := src.Iterator(start, nil)
+	if err != nil {
+		return progress, err
+	}
+	defer it.Close()
+
+	begin := time.Now()
+	batch := dst.NewBatch()
+	pending := 0
+
+	flush := func() error {
+		if pending == 0 {
+			return nil
+		}
+
+		if err := batch.Write(); err != nil {
+			return err
+		}
+
+		if err := batch.Close(); err != nil {
+			return err
+		}
+
+		batch = dst.NewBatch()
+		pending = 0
+		progress.Elapsed = time.Since(begin)
+
+		if err := saveState(opts.StatePath, state{
+			LastKey: hex.EncodeToString(progress.LastKey),
+			Keys:    progress.Keys,
+			Bytes:   progress.Bytes,
+		}); err != nil {
+			return err
+		}
+
+		if opts.OnProgress != nil {
+			opts.OnProgress(progress)
+		}
+
+		return nil
+	}
+
+	for ; it.Valid(); it.Next() {
+		if err := ctx.Err(); err != nil {
+			return progress, err
+		}
+
+		key := it.Key()
+		if start != nil && bytes.Equal(key, start) {
+			// copied by the previous run
+			continue
+		}
+
+		value := it.Value()
+		if err := batch.Set(key, value); err != nil {
+			return progress, err
+		}
+
+		progress.Keys++
+		progress.Bytes += uint64(len(key) + len(value))
+		progress.LastKey = key
+		pending++
+
+		if pending == opts.BatchSize {
+			if err := flush(); err != nil {
+				return progress, err
+			}
+		}
+	}
+
+	if err := it.Error(); err != nil {
+		return progress, err
+	}
+
+	if err := flush(); err != nil {
+		return progress, err
+	}
+
+	if err := batch.Close(); err != nil {
+		return progress, err
+	}
+
+	progress.Elapsed = time.Since(begin)
+
+	return progress, saveState(opts.StatePath, state{
+		LastKey: hex.EncodeToString(progress.LastKey),
+		Keys:    progress.Keys,
+		Bytes:   progress.Bytes,
+		Done:    true,
+	})
+}
+
+// Summarize iterates over the whole database and returns its key count and digest. The digest
+// doesn't depend on the iteration order, so databases with different orderings can be compared.
+func Summarize(ctx context.Context, db tmdb.DB) (Summary, error) {
+	it, err := db.Iterator(nil, nil)
+	if err != nil {
+		return Summary{}, err
+	}
+	defer it.Close()
+
+	var summary Summary
+	for ; it.Valid(); it.Next() {
+		if err := ctx.Err(); err != nil {
+			return summary, err
+		}
+
+		summary.Add(it.Key(), it.Value())
+	}
+
+	return summary, it.Error()
+}
+
+// Add adds a key and its value to the summary.
+func (s *Summary) Add(key, value []byte) {
+	h := sha256.New()
+
+	var size [binary.MaxVarintLen64]byte
+	n := binary.PutUvarint(size[:], uint64(len(key)))
+	h.Write(size[:n])
+	h.Write(key)
+	h.Write(value)
+
+	sum := h.Sum(nil)
+	for idx := range s.Digest {
+		s.Digest[idx] ^= sum[idx]
+	}
+
+	s.Keys++
+}
+
+// Verify compares the key count and digest of both databases.
+func Verify(ctx context.Context, src, dst tmdb.DB) error {
+	want, err := Summarize(ctx, src)
+	if err != nil {
+		return fmt.Errorf("failed to summarize source: %w", err)
+	}
+
+	got, err := Summarize(ctx, dst)
+	if err != nil {
+		return fmt.Errorf("failed to summarize destination: %w", err)
+	}
+
+	if want.Keys != got.Keys {
+		return fmt.Errorf("%w: source has %d keys, destination has %d", ErrVerificationFailed, want.Keys, got.Keys)
+	}
+
+	if want.Digest != got.Digest {
+		return fmt.Errorf("%w: source digest %x, destination digest %x", ErrVerificationFailed, want.Digest, got.Digest)
+	}
+
+	return nil
+}
+
+func loadState(path string) (state, error) {
+	var st state
+	if path == "" {
+		return st, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return st, nil
+	}
+	if err != nil {
+		return st, err
+	}
+
+	if err := json.Unmarshal(data, &st); err != nil {
+		return st, fmt.Errorf("invalid state file %s: %w", path, err)
+	}
+
+	return st, nil
+}
+
+func saveState(path string, st state) error {
+	if path == "" {
+		return nil
+	}
+
+	data, err := json.Marshal(st)
+	if err != nil {
+		return err
+	}
+
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp, path)
+}
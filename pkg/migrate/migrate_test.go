@@ -0,0 +1,91 @@
+package migrate
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"testing"
+
+	"github.com/mariobassem/tendermint-zdb/pkg/db"
+	"github.com/mariobassem/tendermint-zdb/pkg/zdb/zdbtest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	tmdb "github.com/tendermint/tm-db"
+)
+
+func newTestZDB(t *testing.T) *db.ZDB {
+	t.Helper()
+
+	server, err := zdbtest.NewServer()
+	require.NoError(t, err)
+	t.Cleanup(func() { server.Close() })
+
+	z, err := db.NewZDB(server.Addr())
+	require.NoError(t, err)
+	t.Cleanup(func() { z.Close() })
+
+	return &z
+}
+
+func newSource(t *testing.T, n int) tmdb.DB {
+	t.Helper()
+
+	src := tmdb.NewMemDB()
+	for i := 0; i < n; i++ {
+		require.NoError(t, src.Set([]byte(fmt.Sprintf("key-%04d", i)), []byte(fmt.Sprintf("value-%d", i))))
+	}
+
+	return src
+}
+
+func TestCopy(t *testing.T) {
+	src := newSource(t, 250)
+	dst := newTestZDB(t)
+	ctx := context.Background()
+
+	batches := 0
+	progress, err := Copy(ctx, src, dst, Options{
+		BatchSize:  100,
+		OnProgress: func(Progress) { batches++ },
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(250), progress.Keys)
+	assert.Equal(t, 3, batches)
+
+	assert.NoError(t, Verify(ctx, src, dst))
+
+	require.NoError(t, dst.Set([]byte("key-0001"), []byte("changed")))
+	assert.ErrorIs(t, Verify(ctx, src, dst), ErrVerificationFailed)
+}
+
+func TestCopyResume(t *testing.T) {
+	src := newSource(t, 250)
+	dst := newTestZDB(t)
+	statePath := filepath.Join(t.TempDir(), "state.json")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	_, err := Copy(ctx, src, dst, Options{
+		BatchSize:  100,
+		StatePath:  statePath,
+		OnProgress: func(Progress) { cancel() },
+	})
+	assert.ErrorIs(t, err, context.Canceled)
+
+	copied, err := Summarize(context.Background(), dst)
+	require.NoError(t, err)
+	assert.Equal(t, uint64(100), copied.Keys)
+
+	progress, err := Copy(context.Background(), src, dst, Options{
+		BatchSize: 100,
+		StatePath: statePath,
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(250), progress.Keys)
+
+	assert.NoError(t, Verify(context.Background(), src, dst))
+
+	// a completed copy is not repeated
+	progress, err = Copy(context.Background(), src, dst, Options{StatePath: statePath})
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(250), progress.Keys)
+}
@@ -0,0 +1,78 @@
+package mirror
+
+import (
+	"errors"
+
+	tmdb "github.com/tendermint/tm-db"
+)
+
+var errBatchClosed = errors.New("batch has been written or closed")
+
+// batch collects operations, then writes them to the primary and queues them for the mirror.
+type batch struct {
+	db     *DB
+	ops    []op
+	closed bool
+}
+
+var _ tmdb.Batch = (*batch)(nil)
+
+// Set sets a key/value pair.
+// CONTRACT: key, value readonly []byte
+func (b *batch) Set(key, value []byte) error {
+	if b.closed {
+		return errBatchClosed
+	}
+
+	b.ops = append(b.ops, op{
+		kind:  opSet,
+		key:   append([]byte{}, key...),
+		value: append([]byte{}, value...),
+	})
+
+	return nil
+}
+
+// Delete deletes a key/value pair.
+// CONTRACT: key readonly []byte
+func (b *batch) Delete(key []byte) error {
+	if b.closed {
+		return errBatchClosed
+	}
+
+	b.ops = append(b.ops, op{kind: opDelete, key: append([]byte{}, key...)})
+
+	return nil
+}
+
+// Write writes the batch to the primary, and queues it for the mirror.
+func (b *batch) Write() error {
+	return b.write(false)
+}
+
+// WriteSync writes the batch, and flushes the queue to disk.
+func (b *batch) WriteSync() error {
+	return b.write(true)
+}
+
+func (b *batch) write(sync bool) error {
+	if b.closed {
+		return errBatchClosed
+	}
+
+	if len(b.ops) > 0 {
+		if err := b.db.write(sync, b.ops...); err != nil {
+			return err
+		}
+	}
+
+	return b.Close()
+}
+
+// Close closes the batch without writing it.
+func (b *batch) Close() error {
+	b.closed = true
+	b.ops = nil
+
+	return nil
+}
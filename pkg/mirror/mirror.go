@@ -0,0 +1,693 @@
+// Package mirror keeps a secondary ZDB instance as a hot standby of a primary one.
+//
+// Writes are applied to the primary, then queued to a persistent replay queue that a
+// background goroutine applies to the mirror in order. Reads only hit the primary. A mirror
+// that fell too far behind is marked out of sync, and CatchUp copies the primary over to it.
+package mirror
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/mariobassem/tendermint-zdb/pkg/db"
+	tmdb "github.com/tendermint/tm-db"
+)
+
+const (
+	DefaultQueueSize     = 10000
+	DefaultRetryInterval = time.Second
+	DefaultSampleSize    = 100
+	DefaultBatchSize     = 1000
+)
+
+var _ tmdb.DB = (*DB)(nil)
+
+var (
+	ErrOutOfSync = errors.New("mirror is out of sync")
+	ErrClosed    = errors.New("mirror is closed")
+)
+
+// Options configures a mirrored database.
+type Options struct {
+	// QueuePath is the file the writes not applied to the mirror yet are saved to. Its state
+	// is saved next to it, in QueuePath with a .state suffix.
+	QueuePath string
+	// QueueSize is the maximum number of queued writes. When the queue is full, it is dropped
+	// and the mirror is marked out of sync until CatchUp runs.
+	QueueSize int
+	// RetryInterval is the time waited before applying a write to the mirror again after a failure.
+	RetryInterval time.Duration
+	// SampleInterval is the interval between two comparisons of sampled keys, zero disables them.
+	SampleInterval time.Duration
+	// SampleSize is the minimum number of keys compared every SampleInterval.
+	SampleSize int
+	// OnDivergence is called with the keys whose value differs between the primary and the mirror.
+	OnDivergence func(key []byte)
+}
+
+// Status describes the state of the mirror.
+type Status struct {
+	// Pending is the number of writes not applied to the mirror yet.
+	Pending int
+	// Lag is the time the oldest pending write has been queued for.
+	Lag time.Duration
+	// Applied is the number of writes applied to the mirror.
+	Applied uint64
+	// OutOfSync is set when the queue overflowed, and the mirror needs a CatchUp.
+	OutOfSync bool
+	// Compared and Diverged count the sampled keys, and the ones that differed.
+	Compared uint64
+	Diverged uint64
+	// LastError is the last error returned by the mirror, if any.
+	LastError error
+}
+
+// DB is a tmdb.DB writing to a primary ZDB, and asynchronously to a mirror.
+type DB struct {
+	primary *db.ZDB
+	mirror  *db.ZDB
+	opts    Options
+
+	// mu guards the queue, the counters and the connection to the primary, which can't be
+	// used concurrently. It orders writes: a write is queued in the order it was applied to
+	// the primary.
+	mu      sync.Mutex
+	queue   *queue
+	pending map[string]int
+	status  Status
+	// sampleCursor is the primary scan cursor sampling resumes from.
+	sampleCursor []byte
+	catchingUp   bool
+
+	// replayMu is held while writing to the mirror, CatchUp holds it to pause the replay.
+	replayMu sync.Mutex
+
+	notify chan struct{}
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+	closed bool
+}
+
+// New opens the replay queue, and starts applying the writes it holds to the mirror. The
+// returned DB owns both databases, and closes them on Close.
+func New(primary, mirror *db.ZDB, opts Options) (*DB, error) {
+	if opts.QueuePath == "" {
+		return nil, errors.New("a queue path is required")
+	}
+
+	if opts.QueueSize <= 0 {
+		opts.QueueSize = DefaultQueueSize
+	}
+
+	if opts.RetryInterval <= 0 {
+		opts.RetryInterval = DefaultRetryInterval
+	}
+
+	if opts.SampleSize <= 0 {
+		opts.SampleSize = DefaultSampleSize
+	}
+
+	q, err := openQueue(opts.QueuePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open replay queue: %w", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	d := &DB{
+		primary: primary,
+		mirror:  mirror,
+		opts:    opts,
+		queue:   q,
+		pending: map[string]int{},
+		notify:  make(chan struct{}, 1),
+		cancel:  cancel,
+	}
+
+	d.status.OutOfSync = q.outOfSync
+	for _, rec := range q.records {
+		d.addPending(rec.keys)
+	}
+
+	d.wg.Add(1)
+	go d.replay(ctx)
+
+	if opts.SampleInterval > 0 {
+		d.wg.Add(1)
+		go d.sampleEvery(ctx, opts.SampleInterval)
+	}
+
+	return d, nil
+}
+
+// Get fetches the value of the given key from the primary, or nil if it does not exist.
+// CONTRACT: key, value readonly []byte
+func (d *DB) Get(key []byte) ([]byte, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	return d.primary.Get(key)
+}
+
+// Has checks if a key exists on the primary.
+// CONTRACT: key, value readonly []byte
+func (d *DB) Has(key []byte) (bool, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	return d.primary.Has(key)
+}
+
+// Set sets the value for the given key on the primary, and queues it for the mirror.
+// CONTRACT: key, value readonly []byte
+func (d *DB) Set(key, value []byte) error {
+	return d.write(false, op{kind: opSet, key: key, value: value})
+}
+
+// SetSync sets the value for the given key, and flushes the queue to disk.
+// CONTRACT: key, value readonly []byte
+func (d *DB) SetSync(key, value []byte) error {
+	return d.write(true, op{kind: opSet, key: key, value: value})
+}
+
+// Delete deletes the key from the primary, and queues the deletion for the mirror.
+// CONTRACT: key readonly []byte
+func (d *DB) Delete(key []byte) error {
+	return d.write(false, op{kind: opDelete, key: key})
+}
+
+// DeleteSync deletes the key, and flushes the queue to disk.
+// CONTRACT: key readonly []byte
+func (d *DB) DeleteSync(key []byte) error {
+	return d.write(true, op{kind: opDelete, key: key})
+}
+
+func (d *DB) write(sync bool, ops ...op) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.closed {
+		return ErrClosed
+	}
+
+	if err := apply(d.primary, ops); err != nil {
+		return err
+	}
+
+	d.enqueue(ops, sync)
+
+	return nil
+}
+
+// enqueue queues written operations for the mirror. The operations are already applied to
+// the primary, so failing to queue them marks the mirror out of sync instead of failing the write.
+// The caller must hold d.mu.
+func (d *DB) enqueue(ops []op, sync bool) {
+	if d.queue.outOfSync {
+		return
+	}
+
+	if d.queue.len() >= d.opts.QueueSize {
+		d.dropQueue(fmt.Errorf("%w: replay queue is full", ErrOutOfSync))
+		return
+	}
+
+	rec := record{queued: time.Now(), ops: make([]op, 0, len(ops))}
+	for _, o := range ops {
+		// the caller may reuse the key and value
+		rec.ops = append(rec.ops, op{
+			kind:  o.kind,
+			key:   append([]byte{}, o.key...),
+			value: append([]byte{}, o.value...),
+		})
+	}
+
+	if err := d.queue.push(rec, sync); err != nil {
+		d.dropQueue(fmt.Errorf("%w: failed to queue write: %s", ErrOutOfSync, err))
+		return
+	}
+
+	d.addPending(rec.keys())
+
+	select {
+	case d.notify <- struct{}{}:
+	default:
+	}
+}
+
+// dropQueue drops the queue, and marks the mirror out of sync. The caller must hold d.mu.
+func (d *DB) dropQueue(cause error) {
+	d.status.LastError = cause
+	d.status.OutOfSync = true
+	d.pending = map[string]int{}
+
+	if err := d.queue.reset(true); err != nil {
+		d.status.LastError = errors.Join(cause, err)
+	}
+}
+
+func (d *DB) addPending(keys []string) {
+	for _, k := range keys {
+		d.pending[k]++
+	}
+}
+
+func (d *DB) removePending(keys []string) {
+	for _, k := range keys {
+		d.pending[k]--
+		if d.pending[k] <= 0 {
+			delete(d.pending, k)
+		}
+	}
+}
+
+// replay applies the queued writes to the mirror in order, until the context is canceled.
+func (d *DB) replay(ctx context.Context) {
+	defer d.wg.Done()
+
+	for {
+		d.mu.Lock()
+		if d.queue.len() == 0 {
+			d.mu.Unlock()
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-d.notify:
+				continue
+			}
+		}
+
+		rec, head, generation, err := d.queue.peek()
+		d.mu.Unlock()
+
+		if err == nil {
+			d.replayMu.Lock()
+			err = apply(d.mirror, rec.ops)
+			d.replayMu.Unlock()
+		}
+
+		if err != nil {
+			d.mu.Lock()
+			d.status.LastError = err
+			d.mu.Unlock()
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(d.opts.RetryInterval):
+				continue
+			}
+		}
+
+		d.mu.Lock()
+		if generation == d.queue.generation {
+			d.removePending(head.keys)
+			d.status.Applied++
+		}
+
+		if err := d.queue.ack(generation); err != nil {
+			d.dropQueue(fmt.Errorf("%w: failed to update replay queue: %s", ErrOutOfSync, err))
+		}
+		d.mu.Unlock()
+	}
+}
+
+// apply writes operations to a database, in a batch if there are many.
+func apply(database *db.ZDB, ops []op) error {
+	if len(ops) == 1 {
+		if ops[0].kind == opSet {
+			return database.Set(ops[0].key, ops[0].value)
+		}
+
+		return database.Delete(ops[0].key)
+	}
+
+	batch := database.NewBatch()
+	defer batch.Close()
+
+	for _, o := range ops {
+		var err error
+		if o.kind == opSet {
+			err = batch.Set(o.key, o.value)
+		} else {
+			err = batch.Delete(o.key)
+		}
+
+		if err != nil {
+			return err
+		}
+	}
+
+	return batch.Write()
+}
+
+// Status returns the state of the mirror.
+func (d *DB) Status() Status {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	status := d.status
+	status.Pending = d.queue.len()
+	if status.Pending > 0 {
+		status.Lag = time.Since(d.queue.records[0].queued)
+	}
+
+	return status
+}
+
+// Lag returns the time the oldest write not applied to the mirror has been queued for.
+func (d *DB) Lag() time.Duration {
+	return d.Status().Lag
+}
+
+// Compare compares the next SampleSize keys of the primary with the mirror, resuming where
+// the previous comparison stopped, and returns the keys that differ. Whole scan pages are
+// compared, so a few more keys may be. Keys with queued writes are skipped.
+func (d *DB) Compare(ctx context.Context) ([][]byte, error) {
+	primary, err := d.primary.Clone()
+	if err != nil {
+		return nil, err
+	}
+	defer primary.Close()
+
+	mirror, err := d.mirror.Clone()
+	if err != nil {
+		return nil, err
+	}
+	defer mirror.Close()
+
+	d.mu.Lock()
+	cursor := d.sampleCursor
+	d.mu.Unlock()
+
+	diverged := [][]byte{}
+	compared := 0
+	for compared < d.opts.SampleSize {
+		if err := ctx.Err(); err != nil {
+			return diverged, err
+		}
+
+		var res db.ScanResponse
+		if cursor == nil {
+			res, err = primary.Scan()
+		} else {
+			res, err = primary.ScanCursor(cursor)
+		}
+
+		if errors.Is(err, db.ErrCursorNoMoreData) {
+			cursor = nil
+			break
+		}
+		if err != nil {
+			return diverged, err
+		}
+
+		for _, k := range res.Keys {
+			same, checked, err := d.compareKey(primary, mirror, k.Key)
+			if err != nil {
+				return diverged, err
+			}
+
+			if !checked {
+				continue
+			}
+
+			compared++
+			if !same {
+				diverged = append(diverged, k.Key)
+			}
+		}
+
+		cursor = res.Next
+	}
+
+	d.mu.Lock()
+	d.sampleCursor = cursor
+	d.status.Compared += uint64(compared)
+	d.status.Diverged += uint64(len(diverged))
+	d.mu.Unlock()
+
+	if d.opts.OnDivergence != nil {
+		for _, key := range diverged {
+			d.opts.OnDivergence(key)
+		}
+	}
+
+	return diverged, nil
+}
+
+// compareKey compares a stored key of the primary with the mirror. Writes are paused while
+// comparing, so the key can't change in between. Keys with queued writes are not checked.
+func (d *DB) compareKey(primary, mirror *db.ZDB, stored []byte) (same bool, checked bool, err error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	key, want, err := primary.Entry(stored)
+	if err != nil {
+		return false, false, err
+	}
+
+	if key == nil || d.pending[string(key)] > 0 || d.queue.outOfSync || d.catchingUp {
+		return false, false, nil
+	}
+
+	got, err := mirror.Get(key)
+	if err != nil {
+		return false, false, err
+	}
+
+	return string(want) == string(got) && got != nil, true, nil
+}
+
+func (d *DB) sampleEvery(ctx context.Context, interval time.Duration) {
+	defer d.wg.Done()
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		if _, err := d.Compare(ctx); err != nil && ctx.Err() == nil {
+			d.mu.Lock()
+			d.status.LastError = err
+			d.mu.Unlock()
+		}
+	}
+}
+
+// CatchUp copies every key of the primary to the mirror in batches of batchSize keys, to
+// backfill a fresh mirror or one that is out of sync, and returns the number of copied keys.
+// The replay is paused meanwhile, and the writes made during the copy are applied once it is
+// done. Keys deleted from the primary are not deleted from the mirror, so an out of sync
+// mirror should be emptied first.
+func (d *DB) CatchUp(ctx context.Context, batchSize int) (int, error) {
+	if batchSize <= 0 {
+		batchSize = DefaultBatchSize
+	}
+
+	primary, err := d.primary.Clone()
+	if err != nil {
+		return 0, err
+	}
+	defer primary.Close()
+
+	d.replayMu.Lock()
+	defer d.replayMu.Unlock()
+
+	// the copy reads the primary after every queued write was applied to it, so the queue
+	// is only needed for the writes made from now on.
+	d.mu.Lock()
+	if err := d.queue.reset(false); err != nil {
+		d.mu.Unlock()
+		return 0, err
+	}
+	d.pending = map[string]int{}
+	d.status.OutOfSync = false
+	d.catchingUp = true
+	d.mu.Unlock()
+
+	copied, err := d.copyPrimary(ctx, primary, batchSize)
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.catchingUp = false
+	if err != nil {
+		d.dropQueue(fmt.Errorf("%w: catch up failed: %s", ErrOutOfSync, err))
+		return copied, err
+	}
+
+	if d.queue.outOfSync {
+		return copied, fmt.Errorf("%w: replay queue overflowed during catch up", ErrOutOfSync)
+	}
+
+	return copied, nil
+}
+
+func (d *DB) copyPrimary(ctx context.Context, primary *db.ZDB, batchSize int) (int, error) {
+	copied := 0
+	ops := make([]op, 0, batchSize)
+
+	var cursor []byte
+	for {
+		if err := ctx.Err(); err != nil {
+			return copied, err
+		}
+
+		var (
+			res db.ScanResponse
+			err error
+		)
+		if cursor == nil {
+			res, err = primary.Scan()
+		} else {
+			res, err = primary.ScanCursor(cursor)
+		}
+
+		if errors.Is(err, db.ErrCursorNoMoreData) {
+			break
+		}
+		if err != nil {
+			return copied, err
+		}
+
+		for _, k := range res.Keys {
+			key, value, err := primary.Entry(k.Key)
+			if err != nil {
+				return copied, err
+			}
+
+			if key == nil {
+				continue
+			}
+
+			ops = append(ops, op{kind: opSet, key: key, value: value})
+			if len(ops) < batchSize {
+				continue
+			}
+
+			if err := apply(d.mirror, ops); err != nil {
+				return copied, err
+			}
+
+			copied += len(ops)
+			ops = ops[:0]
+		}
+
+		cursor = res.Next
+	}
+
+	if len(ops) > 0 {
+		if err := apply(d.mirror, ops); err != nil {
+			return copied, err
+		}
+
+		copied += len(ops)
+	}
+
+	return copied, nil
+}
+
+// Iterator returns an iterator over the primary, using its own connection.
+// CONTRACT: No writes may happen within a domain while an iterator exists over it.
+// CONTRACT: start, end readonly []byte
+func (d *DB) Iterator(start, end []byte) (tmdb.Iterator, error) {
+	return d.iterator(func(conn *db.ZDB) (tmdb.Iterator, error) {
+		return conn.Iterator(start, end)
+	})
+}
+
+// ReverseIterator returns a reverse iterator over the primary, using its own connection.
+// CONTRACT: No writes may happen within a domain while an iterator exists over it.
+// CONTRACT: start, end readonly []byte
+func (d *DB) ReverseIterator(start, end []byte) (tmdb.Iterator, error) {
+	return d.iterator(func(conn *db.ZDB) (tmdb.Iterator, error) {
+		return conn.ReverseIterator(start, end)
+	})
+}
+
+// iterator opens an iterator on a new connection to the primary, an iterator reads the
+// primary as it is consumed, along the other calls.
+func (d *DB) iterator(open func(conn *db.ZDB) (tmdb.Iterator, error)) (tmdb.Iterator, error) {
+	conn, err := d.primary.Clone()
+	if err != nil {
+		return nil, err
+	}
+
+	it, err := open(conn)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	return &connIterator{Iterator: it, conn: conn}, nil
+}
+
+// connIterator closes the connection of the iterator with it.
+type connIterator struct {
+	tmdb.Iterator
+	conn *db.ZDB
+}
+
+func (i *connIterator) Close() error {
+	return errors.Join(i.Iterator.Close(), i.conn.Close())
+}
+
+// Close stops the replay, and closes the queue and both databases. Queued writes are applied
+// to the mirror once the database is opened again.
+func (d *DB) Close() error {
+	d.mu.Lock()
+	if d.closed {
+		d.mu.Unlock()
+		return nil
+	}
+	d.closed = true
+	d.mu.Unlock()
+
+	d.cancel()
+	d.wg.Wait()
+
+	return errors.Join(d.queue.close(), d.primary.Close(), d.mirror.Close())
+}
+
+// NewBatch creates a batch written to the primary, then queued for the mirror as a whole.
+func (d *DB) NewBatch() tmdb.Batch {
+	return &batch{db: d}
+}
+
+// Print is used for debugging.
+func (d *DB) Print() error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	return d.primary.Print()
+}
+
+// Stats returns the primary statistics, along with the mirror status.
+func (d *DB) Stats() map[string]string {
+	d.mu.Lock()
+	stats := d.primary.Stats()
+	d.mu.Unlock()
+
+	if stats == nil {
+		stats = map[string]string{}
+	}
+
+	status := d.Status()
+	stats["mirror_pending"] = strconv.Itoa(status.Pending)
+	stats["mirror_lag"] = status.Lag.String()
+	stats["mirror_applied"] = strconv.FormatUint(status.Applied, 10)
+	stats["mirror_out_of_sync"] = strconv.FormatBool(status.OutOfSync)
+	stats["mirror_diverged"] = strconv.FormatUint(status.Diverged, 10)
+
+	return stats
+}
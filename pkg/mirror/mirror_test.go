@@ -0,0 +1,347 @@
+package mirror
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/mariobassem/tendermint-zdb/pkg/db"
+	"github.com/mariobassem/tendermint-zdb/pkg/zdb"
+	"github.com/mariobassem/tendermint-zdb/pkg/zdb/zdbtest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type testSetup struct {
+	primary *zdbtest.Server
+	mirror  *zdbtest.Server
+	// admin is a client of the mirror server, used to make it fail.
+	admin     *zdb.Client
+	queuePath string
+}
+
+func newTestSetup(t *testing.T) *testSetup {
+	t.Helper()
+
+	primary, err := zdbtest.NewServer()
+	require.NoError(t, err)
+	t.Cleanup(func() { primary.Close() })
+
+	mirror, err := zdbtest.NewServer()
+	require.NoError(t, err)
+	t.Cleanup(func() { mirror.Close() })
+
+	admin := zdb.NewClient(mirror.Addr())
+	t.Cleanup(func() { admin.Close() })
+
+	return &testSetup{
+		primary:   primary,
+		mirror:    mirror,
+		admin:     &admin,
+		queuePath: filepath.Join(t.TempDir(), "queue"),
+	}
+}
+
+func (s *testSetup) open(t *testing.T, opts Options) *DB {
+	t.Helper()
+
+	primary, err := db.NewZDB(s.primary.Addr())
+	require.NoError(t, err)
+
+	mirror, err := db.NewZDB(s.mirror.Addr())
+	require.NoError(t, err)
+
+	opts.QueuePath = s.queuePath
+	if opts.RetryInterval == 0 {
+		opts.RetryInterval = 10 * time.Millisecond
+	}
+
+	d, err := New(&primary, &mirror, opts)
+	require.NoError(t, err)
+
+	return d
+}
+
+func (s *testSetup) openMirror(t *testing.T) *db.ZDB {
+	t.Helper()
+
+	mirror, err := db.NewZDB(s.mirror.Addr())
+	require.NoError(t, err)
+	t.Cleanup(func() { mirror.Close() })
+
+	return &mirror
+}
+
+// failMirror makes every write to the mirror fail until restoreMirror is called.
+func (s *testSetup) failMirror(t *testing.T) {
+	require.NoError(t, s.admin.SetNamespace(context.Background(), "default", "maxsize", "1"))
+}
+
+func (s *testSetup) restoreMirror(t *testing.T) {
+	require.NoError(t, s.admin.SetNamespace(context.Background(), "default", "maxsize", "0"))
+}
+
+func waitDrained(t *testing.T, d *DB) {
+	t.Helper()
+
+	require.Eventually(t, func() bool {
+		return d.Status().Pending == 0
+	}, 5*time.Second, 5*time.Millisecond)
+}
+
+func TestMirrorWrites(t *testing.T) {
+	setup := newTestSetup(t)
+	d := setup.open(t, Options{})
+	defer d.Close()
+
+	require.NoError(t, d.Set([]byte("a"), []byte("1")))
+	require.NoError(t, d.Set([]byte("b"), []byte("2")))
+	require.NoError(t, d.Delete([]byte("a")))
+
+	b := d.NewBatch()
+	require.NoError(t, b.Set([]byte("c"), []byte("3")))
+	require.NoError(t, b.Set([]byte("d"), []byte("4")))
+	require.NoError(t, b.Delete([]byte("b")))
+	require.NoError(t, b.Write())
+
+	waitDrained(t, d)
+
+	mirror := setup.openMirror(t)
+	for key, want := range map[string][]byte{"a": nil, "b": nil, "c": []byte("3"), "d": []byte("4")} {
+		got, err := mirror.Get([]byte(key))
+		require.NoError(t, err)
+		assert.Equal(t, want, got, key)
+	}
+
+	status := d.Status()
+	assert.Equal(t, uint64(4), status.Applied)
+	assert.False(t, status.OutOfSync)
+	assert.Equal(t, time.Duration(0), status.Lag)
+}
+
+func TestMirrorQueueSurvivesRestart(t *testing.T) {
+	setup := newTestSetup(t)
+	setup.failMirror(t)
+
+	d := setup.open(t, Options{})
+	for i := 0; i < 5; i++ {
+		require.NoError(t, d.Set([]byte(fmt.Sprintf("k%d", i)), []byte("v")))
+	}
+
+	status := d.Status()
+	assert.Equal(t, 5, status.Pending)
+	assert.Greater(t, status.Lag, time.Duration(0))
+	require.Eventually(t, func() bool { return d.Status().LastError != nil }, time.Second, 5*time.Millisecond)
+	require.NoError(t, d.Close())
+
+	setup.restoreMirror(t)
+
+	d = setup.open(t, Options{})
+	defer d.Close()
+
+	waitDrained(t, d)
+
+	mirror := setup.openMirror(t)
+	for i := 0; i < 5; i++ {
+		got, err := mirror.Get([]byte(fmt.Sprintf("k%d", i)))
+		require.NoError(t, err)
+		assert.Equal(t, []byte("v"), got)
+	}
+}
+
+func TestMirrorOverflowAndCatchUp(t *testing.T) {
+	setup := newTestSetup(t)
+	setup.failMirror(t)
+
+	d := setup.open(t, Options{QueueSize: 3})
+	defer d.Close()
+
+	for i := 0; i < 10; i++ {
+		require.NoError(t, d.Set([]byte(fmt.Sprintf("k%d", i)), []byte("v")))
+	}
+
+	status := d.Status()
+	assert.True(t, status.OutOfSync)
+	assert.ErrorIs(t, status.LastError, ErrOutOfSync)
+	assert.Equal(t, 0, status.Pending)
+
+	setup.restoreMirror(t)
+
+	copied, err := d.CatchUp(context.Background(), 4)
+	require.NoError(t, err)
+	assert.Equal(t, 10, copied)
+	assert.False(t, d.Status().OutOfSync)
+
+	require.NoError(t, d.Set([]byte("after"), []byte("catch up")))
+	waitDrained(t, d)
+
+	mirror := setup.openMirror(t)
+	for i := 0; i < 10; i++ {
+		got, err := mirror.Get([]byte(fmt.Sprintf("k%d", i)))
+		require.NoError(t, err)
+		assert.Equal(t, []byte("v"), got)
+	}
+
+	got, err := mirror.Get([]byte("after"))
+	require.NoError(t, err)
+	assert.Equal(t, []byte("catch up"), got)
+}
+
+func TestMirrorDivergence(t *testing.T) {
+	setup := newTestSetup(t)
+
+	setup.primary.PageSize = 2
+
+	diverged := [][]byte{}
+	d := setup.open(t, Options{SampleSize: 2, OnDivergence: func(key []byte) { diverged = append(diverged, key) }})
+	defer d.Close()
+
+	for i := 0; i < 5; i++ {
+		require.NoError(t, d.Set([]byte(fmt.Sprintf("k%d", i)), []byte("v")))
+	}
+	waitDrained(t, d)
+
+	// written behind the mirror's back
+	mirror := setup.openMirror(t)
+	require.NoError(t, mirror.Set([]byte("k3"), []byte("changed")))
+
+	ctx := context.Background()
+	keys, err := d.Compare(ctx)
+	require.NoError(t, err)
+	assert.Empty(t, keys)
+
+	keys, err = d.Compare(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, [][]byte{[]byte("k3")}, keys)
+	assert.Equal(t, [][]byte{[]byte("k3")}, diverged)
+
+	status := d.Status()
+	assert.Equal(t, uint64(4), status.Compared)
+	assert.Equal(t, uint64(1), status.Diverged)
+}
+
+func TestQueueDropsTornRecord(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "queue")
+
+	q, err := openQueue(path)
+	require.NoError(t, err)
+
+	rec := record{queued: time.Now(), ops: []op{{kind: opSet, key: []byte("key"), value: []byte("value")}}}
+	require.NoError(t, q.push(rec, true))
+	require.NoError(t, q.push(rec, true))
+
+	// cut the last record, as a crash while writing it would
+	require.NoError(t, q.file.Truncate(q.tail-3))
+	require.NoError(t, q.close())
+
+	q, err = openQueue(path)
+	require.NoError(t, err)
+	defer q.close()
+
+	require.Equal(t, 1, q.len())
+
+	got, _, _, err := q.peek()
+	require.NoError(t, err)
+	assert.Equal(t, rec.ops, got.ops)
+}
+
+func TestQueueCompaction(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "queue")
+
+	q, err := openQueue(path)
+	require.NoError(t, err)
+	q.compactSize = 100
+
+	push := func(i int) {
+		rec := record{queued: time.Now(), ops: []op{{kind: opSet, key: []byte(fmt.Sprintf("k%03d", i)), value: []byte("value")}}}
+		require.NoError(t, q.push(rec, false))
+	}
+
+	// the queue is never fully drained, a few records stay pending
+	next := 0
+	for ; next < 5; next++ {
+		push(next)
+	}
+
+	for i := 0; i < 200; i++ {
+		push(next)
+		next++
+
+		_, _, generation, err := q.peek()
+		require.NoError(t, err)
+		require.NoError(t, q.ack(generation))
+	}
+
+	info, err := q.file.Stat()
+	require.NoError(t, err)
+	assert.Less(t, info.Size(), int64(200))
+	assert.Equal(t, q.tail, info.Size())
+	require.NoError(t, q.close())
+
+	q, err = openQueue(path)
+	require.NoError(t, err)
+	defer q.close()
+
+	require.Equal(t, 5, q.len())
+	for i := next - 5; i < next; i++ {
+		rec, _, generation, err := q.peek()
+		require.NoError(t, err)
+		assert.Equal(t, []byte(fmt.Sprintf("k%03d", i)), rec.ops[0].key)
+		require.NoError(t, q.ack(generation))
+	}
+}
+
+func TestMirrorConcurrentAccess(t *testing.T) {
+	setup := newTestSetup(t)
+	d := setup.open(t, Options{})
+	defer d.Close()
+
+	const workers = 8
+
+	var wg sync.WaitGroup
+	errs := make(chan error, workers)
+	for i := 0; i < workers; i++ {
+		key := []byte{'k', byte('0' + i)}
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 50; j++ {
+				value := []byte{byte(j)}
+				if err := d.Set(key, value); err != nil {
+					errs <- err
+					return
+				}
+
+				got, err := d.Get(key)
+				if err != nil {
+					errs <- err
+					return
+				}
+
+				if !bytes.Equal(got, value) {
+					errs <- fmt.Errorf("got %x for %s, expected %x", got, key, value)
+					return
+				}
+			}
+		}()
+	}
+
+	// iterators use their own connection, they can be used along the other calls
+	it, err := d.Iterator(nil, nil)
+	require.NoError(t, err)
+	for ; it.Valid(); it.Next() {
+	}
+	require.NoError(t, it.Error())
+	require.NoError(t, it.Close())
+
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		require.NoError(t, err)
+	}
+}
@@ -0,0 +1,388 @@
+package mirror
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"time"
+)
+
+// A queue file is a sequence of records: the uvarint length of the record body, the body and
+// its big endian crc32. A body is the varint time the record was queued at in nanoseconds,
+// the uvarint number of operations, and the operations: their type, the uvarint length of the
+// key, the key and, for sets, the uvarint length of the value and the value.
+//
+// The state file holds the big endian offset of the first record not applied to the mirror yet,
+// followed by a byte set when the mirror is out of sync.
+const stateSize = 9
+
+// defaultCompactSize is the size of the applied records a queue file must start with before
+// the pending records are moved to its beginning.
+const defaultCompactSize = 1 << 20
+
+const (
+	opSet    byte = 1
+	opDelete byte = 2
+)
+
+var errInvalidRecord = errors.New("invalid queue record")
+
+type op struct {
+	kind  byte
+	key   []byte
+	value []byte
+}
+
+type record struct {
+	queued time.Time
+	ops    []op
+}
+
+// queued describes a record of the queue file, the record itself is read back when applied.
+type queued struct {
+	offset int64
+	size   int64
+	queued time.Time
+	keys   []string
+}
+
+// queue is a persistent queue of records, it is not safe for concurrent use.
+type queue struct {
+	file  *os.File
+	state *os.File
+
+	head      int64
+	tail      int64
+	records   []queued
+	outOfSync bool
+	// generation changes every time the queue is dropped, so records read before are not acked.
+	generation uint64
+	// compactSize is the size of the applied records compacted away, see compact.
+	compactSize int64
+}
+
+func openQueue(path string) (*queue, error) {
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0o644)
+	if err != nil {
+		return nil, err
+	}
+
+	state, err := os.OpenFile(path+".state", os.O_RDWR|os.O_CREATE, 0o644)
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+
+	q := &queue{file: file, state: state, compactSize: defaultCompactSize}
+	if err := q.load(); err != nil {
+		q.close()
+		return nil, err
+	}
+
+	return q, nil
+}
+
+// load reads the state file and the records following the head. A record cut by a crash
+// while being written is dropped.
+func (q *queue) load() error {
+	buf := make([]byte, stateSize)
+	_, err := q.state.ReadAt(buf, 0)
+	if err != nil && !errors.Is(err, io.EOF) {
+		return err
+	}
+
+	if err == nil {
+		q.head = int64(binary.BigEndian.Uint64(buf))
+		q.outOfSync = buf[8] == 1
+	}
+
+	info, err := q.file.Stat()
+	if err != nil {
+		return err
+	}
+
+	if q.head > info.Size() {
+		return fmt.Errorf("queue head %d is past the end of the queue file", q.head)
+	}
+
+	r := bufio.NewReader(io.NewSectionReader(q.file, q.head, info.Size()-q.head))
+	offset := q.head
+	for {
+		size, rec, err := readRecord(r, info.Size()-offset)
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if errors.Is(err, io.ErrUnexpectedEOF) || errors.Is(err, errInvalidRecord) {
+			break
+		}
+		if err != nil {
+			return err
+		}
+
+		q.records = append(q.records, queued{offset: offset, size: size, queued: rec.queued, keys: rec.keys()})
+		offset += size
+	}
+
+	q.tail = offset
+	if offset != info.Size() {
+		return q.file.Truncate(offset)
+	}
+
+	return nil
+}
+
+func (q *queue) len() int {
+	return len(q.records)
+}
+
+// push appends a record to the queue file.
+func (q *queue) push(rec record, sync bool) error {
+	buf := encodeRecord(rec)
+	if _, err := q.file.WriteAt(buf, q.tail); err != nil {
+		return err
+	}
+
+	if sync {
+		if err := q.file.Sync(); err != nil {
+			return err
+		}
+	}
+
+	q.records = append(q.records, queued{offset: q.tail, size: int64(len(buf)), queued: rec.queued, keys: rec.keys()})
+	q.tail += int64(len(buf))
+
+	return nil
+}
+
+// peek reads the record at the head of the queue.
+func (q *queue) peek() (record, queued, uint64, error) {
+	head := q.records[0]
+
+	r := bufio.NewReader(io.NewSectionReader(q.file, head.offset, head.size))
+	_, rec, err := readRecord(r, head.size)
+	if err != nil {
+		return record{}, queued{}, 0, err
+	}
+
+	return rec, head, q.generation, nil
+}
+
+// ack removes the head record once applied, unless the queue was dropped since it was read.
+func (q *queue) ack(generation uint64) error {
+	if generation != q.generation || len(q.records) == 0 {
+		return nil
+	}
+
+	q.records = q.records[1:]
+	if len(q.records) == 0 {
+		return q.reset(q.outOfSync)
+	}
+
+	q.head = q.records[0].offset
+
+	if err := q.saveState(); err != nil {
+		return err
+	}
+
+	return q.compact()
+}
+
+// compact moves the pending records to the beginning of the queue file once the applied
+// records before them reach compactSize, so a queue that is never fully drained does not
+// grow forever. It waits until the pending records are smaller than the applied ones, so
+// they are copied over applied records only: the queue file is valid at every step.
+func (q *queue) compact() error {
+	size := q.tail - q.head
+	if q.head < q.compactSize || size >= q.head {
+		return nil
+	}
+
+	buf := make([]byte, size)
+	if _, err := q.file.ReadAt(buf, q.head); err != nil {
+		return err
+	}
+
+	// an empty record follows the copied records, so if the state is saved but the file not
+	// truncated yet, load stops there instead of reading the applied records that follow
+	buf = append(buf, 0)
+	if _, err := q.file.WriteAt(buf, 0); err != nil {
+		return err
+	}
+
+	if err := q.file.Sync(); err != nil {
+		return err
+	}
+
+	moved := q.head
+	q.head = 0
+	if err := q.saveState(); err != nil {
+		q.head = moved
+		return err
+	}
+
+	if err := q.state.Sync(); err != nil {
+		return err
+	}
+
+	for i := range q.records {
+		q.records[i].offset -= moved
+	}
+	q.tail = size
+
+	return q.file.Truncate(size)
+}
+
+// reset drops every record.
+func (q *queue) reset(outOfSync bool) error {
+	if err := q.file.Truncate(0); err != nil {
+		return err
+	}
+
+	q.head = 0
+	q.tail = 0
+	q.records = nil
+	q.outOfSync = outOfSync
+	q.generation++
+
+	return q.saveState()
+}
+
+func (q *queue) saveState() error {
+	buf := make([]byte, stateSize)
+	binary.BigEndian.PutUint64(buf, uint64(q.head))
+	if q.outOfSync {
+		buf[8] = 1
+	}
+
+	_, err := q.state.WriteAt(buf, 0)
+	return err
+}
+
+func (q *queue) close() error {
+	return errors.Join(q.file.Close(), q.state.Close())
+}
+
+func (r record) keys() []string {
+	keys := make([]string, 0, len(r.ops))
+	for _, o := range r.ops {
+		keys = append(keys, string(o.key))
+	}
+
+	return keys
+}
+
+func encodeRecord(rec record) []byte {
+	body := binary.AppendVarint(nil, rec.queued.UnixNano())
+	body = binary.AppendUvarint(body, uint64(len(rec.ops)))
+	for _, o := range rec.ops {
+		body = append(body, o.kind)
+		body = binary.AppendUvarint(body, uint64(len(o.key)))
+		body = append(body, o.key...)
+
+		if o.kind == opSet {
+			body = binary.AppendUvarint(body, uint64(len(o.value)))
+			body = append(body, o.value...)
+		}
+	}
+
+	buf := binary.AppendUvarint(nil, uint64(len(body)))
+	buf = append(buf, body...)
+
+	return binary.BigEndian.AppendUint32(buf, crc32.ChecksumIEEE(body))
+}
+
+// readRecord reads a record of at most limit bytes and returns it along with its size in the
+// queue file.
+func readRecord(r *bufio.Reader, limit int64) (int64, record, error) {
+	length, err := binary.ReadUvarint(r)
+	if err != nil {
+		return 0, record{}, err
+	}
+
+	if length > uint64(limit) {
+		return 0, record{}, fmt.Errorf("%w: record of %d bytes is larger than the queue file", errInvalidRecord, length)
+	}
+
+	buf := make([]byte, length+4)
+	if _, err := io.ReadFull(r, buf); err != nil {
+		if errors.Is(err, io.EOF) {
+			err = io.ErrUnexpectedEOF
+		}
+
+		return 0, record{}, err
+	}
+
+	body := buf[:length]
+	if crc32.ChecksumIEEE(body) != binary.BigEndian.Uint32(buf[length:]) {
+		return 0, record{}, fmt.Errorf("%w: checksum mismatch", errInvalidRecord)
+	}
+
+	rec, err := decodeRecord(body)
+	if err != nil {
+		return 0, record{}, err
+	}
+
+	size := int64(len(binary.AppendUvarint(nil, length))) + int64(len(buf))
+
+	return size, rec, nil
+}
+
+func decodeRecord(body []byte) (record, error) {
+	r := bufio.NewReader(bytes.NewReader(body))
+
+	queuedAt, err := binary.ReadVarint(r)
+	if err != nil {
+		return record{}, fmt.Errorf("%w: %s", errInvalidRecord, err)
+	}
+
+	count, err := binary.ReadUvarint(r)
+	if err != nil {
+		return record{}, fmt.Errorf("%w: %s", errInvalidRecord, err)
+	}
+
+	rec := record{queued: time.Unix(0, queuedAt)}
+	for i := uint64(0); i < count; i++ {
+		kind, err := r.ReadByte()
+		if err != nil {
+			return record{}, fmt.Errorf("%w: %s", errInvalidRecord, err)
+		}
+
+		if kind != opSet && kind != opDelete {
+			return record{}, fmt.Errorf("%w: unknown operation %d", errInvalidRecord, kind)
+		}
+
+		o := op{kind: kind}
+		if o.key, err = readBytes(r); err != nil {
+			return record{}, err
+		}
+
+		if kind == opSet {
+			if o.value, err = readBytes(r); err != nil {
+				return record{}, err
+			}
+		}
+
+		rec.ops = append(rec.ops, o)
+	}
+
+	return rec, nil
+}
+
+func readBytes(r *bufio.Reader) ([]byte, error) {
+	size, err := binary.ReadUvarint(r)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", errInvalidRecord, err)
+	}
+
+	buf := make([]byte, size)
+	if _, err := io.ReadFull(r, buf); err != nil {
+		return nil, fmt.Errorf("%w: %s", errInvalidRecord, err)
+	}
+
+	return buf, nil
+}
@@ -0,0 +1,127 @@
+package shard
+
+import (
+	"errors"
+	"fmt"
+
+	tmdb "github.com/tendermint/tm-db"
+)
+
+var errBatchClosed = errors.New("batch has been written or closed")
+
+// batch splits its operations into a batch per shard. Shard batches are written one after
+// the other, so a batch is only atomic on each shard. A shard batch that was written is not
+// written again when Write is retried after a failure.
+type batch struct {
+	db      *DB
+	batches map[string]tmdb.Batch
+	order   []string
+	written map[string]bool
+	closed  bool
+}
+
+var _ tmdb.Batch = (*batch)(nil)
+
+func (b *batch) shardBatch(name string) tmdb.Batch {
+	sb, ok := b.batches[name]
+	if !ok {
+		sb = b.db.shards[name].NewBatch()
+		b.batches[name] = sb
+		b.order = append(b.order, name)
+	}
+
+	return sb
+}
+
+// Set sets a key/value pair on the batch of the key's shard.
+// CONTRACT: key, value readonly []byte
+func (b *batch) Set(key, value []byte) error {
+	if b.closed {
+		return errBatchClosed
+	}
+
+	b.db.mu.RLock()
+	defer b.db.mu.RUnlock()
+
+	return b.shardBatch(b.db.ring.Locate(key)).Set(key, value)
+}
+
+// Delete deletes a key/value pair from the key's shard, and from its previous shard while
+// keys are being rebalanced.
+// CONTRACT: key readonly []byte
+func (b *batch) Delete(key []byte) error {
+	if b.closed {
+		return errBatchClosed
+	}
+
+	b.db.mu.RLock()
+	defer b.db.mu.RUnlock()
+
+	name := b.db.ring.Locate(key)
+	if b.db.previous != nil {
+		if prev := b.db.previous.Locate(key); prev != name {
+			if err := b.shardBatch(prev).Delete(key); err != nil {
+				return err
+			}
+		}
+	}
+
+	return b.shardBatch(name).Delete(key)
+}
+
+// Write writes the batch of every shard.
+func (b *batch) Write() error {
+	return b.write(false)
+}
+
+// WriteSync writes the batch of every shard, and flushes them to storage.
+func (b *batch) WriteSync() error {
+	return b.write(true)
+}
+
+func (b *batch) write(sync bool) error {
+	if b.closed {
+		return errBatchClosed
+	}
+
+	if b.written == nil {
+		b.written = map[string]bool{}
+	}
+
+	for _, name := range b.order {
+		if b.written[name] {
+			continue
+		}
+
+		var err error
+		if sync {
+			err = b.batches[name].WriteSync()
+		} else {
+			err = b.batches[name].Write()
+		}
+
+		if err != nil {
+			return fmt.Errorf("failed to write batch to shard %s: %w", name, err)
+		}
+
+		b.written[name] = true
+	}
+
+	return b.Close()
+}
+
+// Close closes the batch of every shard.
+func (b *batch) Close() error {
+	if b.closed {
+		return nil
+	}
+
+	b.closed = true
+
+	errs := []error{}
+	for _, sb := range b.batches {
+		errs = append(errs, sb.Close())
+	}
+
+	return errors.Join(errs...)
+}
@@ -0,0 +1,354 @@
+package shard
+
+import (
+	"bytes"
+	"container/heap"
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/mariobassem/tendermint-zdb/pkg/db"
+	tmdb "github.com/tendermint/tm-db"
+)
+
+type shardIterator struct {
+	tmdb.Iterator
+	name string
+}
+
+// mergeIterator merges the ordered iterators of every shard with a heap of their current
+// keys. A key found on several shards, which happens while rebalancing, is returned once,
+// with the value of the shard owning it.
+type mergeIterator struct {
+	start     []byte
+	end       []byte
+	ring      *Ring
+	iterators []shardIterator
+	heap      iteratorHeap
+	err       error
+}
+
+var _ tmdb.Iterator = (*mergeIterator)(nil)
+
+type heapItem struct {
+	iterator int
+	key      []byte
+	owned    bool
+}
+
+type iteratorHeap struct {
+	items   []heapItem
+	reverse bool
+}
+
+func (h iteratorHeap) Len() int { return len(h.items) }
+
+func (h iteratorHeap) Less(i, j int) bool {
+	if c := compareKeys(h.items[i].key, h.items[j].key, h.reverse); c != 0 {
+		return c < 0
+	}
+
+	return h.items[i].owned && !h.items[j].owned
+}
+
+func (h iteratorHeap) Swap(i, j int) { h.items[i], h.items[j] = h.items[j], h.items[i] }
+
+func (h *iteratorHeap) Push(x interface{}) { h.items = append(h.items, x.(heapItem)) }
+
+func (h *iteratorHeap) Pop() interface{} {
+	item := h.items[len(h.items)-1]
+	h.items = h.items[:len(h.items)-1]
+
+	return item
+}
+
+func newMergeIterator(start, end []byte, reverse bool, ring *Ring, iterators []shardIterator) *mergeIterator {
+	m := &mergeIterator{
+		start:     start,
+		end:       end,
+		ring:      ring,
+		iterators: iterators,
+		heap:      iteratorHeap{reverse: reverse},
+	}
+
+	for idx := range iterators {
+		m.push(idx)
+	}
+
+	return m
+}
+
+// push adds the current key of an iterator to the heap, if it has one.
+func (m *mergeIterator) push(idx int) {
+	it := m.iterators[idx]
+	if !it.Valid() {
+		if err := it.Error(); err != nil && m.err == nil {
+			m.err = err
+		}
+
+		return
+	}
+
+	key := append([]byte{}, it.Key()...)
+	heap.Push(&m.heap, heapItem{
+		iterator: idx,
+		key:      key,
+		owned:    m.ring.Locate(key) == it.name,
+	})
+}
+
+// Domain returns the start (inclusive) and end (exclusive) limits of the iterator.
+// CONTRACT: start, end readonly []byte
+func (m *mergeIterator) Domain() (start []byte, end []byte) {
+	return m.start, m.end
+}
+
+// Valid returns whether the current iterator is valid. Once invalid, the Iterator remains
+// invalid forever.
+func (m *mergeIterator) Valid() bool {
+	return m.heap.Len() > 0 && m.Error() == nil
+}
+
+// Next moves the iterator to the next key, skipping the copies of the current key found on
+// other shards. If Valid returns false, this method will panic.
+func (m *mergeIterator) Next() {
+	m.assertValid()
+
+	current := heap.Pop(&m.heap).(heapItem)
+	m.advance(current.iterator)
+
+	for m.heap.Len() > 0 && compareKeys(m.heap.items[0].key, current.key, false) == 0 {
+		dup := heap.Pop(&m.heap).(heapItem)
+		m.advance(dup.iterator)
+	}
+}
+
+func (m *mergeIterator) advance(idx int) {
+	m.iterators[idx].Next()
+	m.push(idx)
+}
+
+// Key returns the key at the current position. Panics if the iterator is invalid.
+// CONTRACT: key readonly []byte
+func (m *mergeIterator) Key() (key []byte) {
+	m.assertValid()
+
+	return m.heap.items[0].key
+}
+
+// Value returns the value at the current position. Panics if the iterator is invalid.
+// CONTRACT: value readonly []byte
+func (m *mergeIterator) Value() (value []byte) {
+	m.assertValid()
+
+	return m.iterators[m.heap.items[0].iterator].Value()
+}
+
+// Error returns the first error encountered by a shard iterator, if any.
+func (m *mergeIterator) Error() error {
+	if m.err != nil {
+		return m.err
+	}
+
+	for _, it := range m.iterators {
+		if err := it.Error(); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Close closes the iterator of every shard.
+func (m *mergeIterator) Close() error {
+	errs := []error{}
+	for _, it := range m.iterators {
+		errs = append(errs, it.Close())
+	}
+
+	m.heap.items = nil
+
+	return errors.Join(errs...)
+}
+
+func (m *mergeIterator) assertValid() {
+	if !m.Valid() {
+		if err := m.Error(); err != nil {
+			panic(err)
+		}
+
+		panic("iterator is invalid")
+	}
+}
+
+// sortedIterator iterates over the keys of a database which doesn't iterate in key order. The
+// keys of the whole database are scanned when it is created, the ones in the domain are kept
+// and sorted, and their values are read one by one as the iterator moves.
+type sortedIterator struct {
+	database tmdb.DB
+	start    []byte
+	end      []byte
+	keys     [][]byte
+
+	// value is the value of the current key, once read.
+	value  []byte
+	loaded bool
+	err    error
+}
+
+var _ tmdb.Iterator = (*sortedIterator)(nil)
+
+// newSortedIterator scans the keys of the database and sorts the ones in [start,end). It fails
+// with ErrUnboundedRange if start or end is nil, and with ErrRangeTooLarge if more than limit
+// keys are in the domain.
+func newSortedIterator(database tmdb.DB, start, end []byte, reverse bool, limit int) (*sortedIterator, error) {
+	if start == nil || end == nil {
+		return nil, ErrUnboundedRange
+	}
+
+	s := &sortedIterator{database: database, start: start, end: end}
+	add := func(key []byte) error {
+		if bytes.Compare(key, start) < 0 || bytes.Compare(key, end) >= 0 {
+			return nil
+		}
+
+		if len(s.keys) == limit {
+			return fmt.Errorf("%w: more than %d keys in [%x,%x)", ErrRangeTooLarge, limit, start, end)
+		}
+
+		s.keys = append(s.keys, append([]byte{}, key...))
+
+		return nil
+	}
+
+	var err error
+	if z, ok := database.(*db.ZDB); ok {
+		err = scanZDBKeys(z, add)
+	} else {
+		err = scanKeys(database, add)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Slice(s.keys, func(i, j int) bool {
+		return compareKeys(s.keys[i], s.keys[j], reverse) < 0
+	})
+
+	return s, nil
+}
+
+// scanZDBKeys calls fn with every key of a ZDB, without reading the values.
+func scanZDBKeys(z *db.ZDB, fn func(key []byte) error) error {
+	res, err := z.Scan()
+	for {
+		if errors.Is(err, db.ErrCursorNoMoreData) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		for _, k := range res.Keys {
+			key, err := z.EntryKey(k.Key)
+			if err != nil {
+				return err
+			}
+
+			if key == nil {
+				continue
+			}
+
+			if err := fn(key); err != nil {
+				return err
+			}
+		}
+
+		res, err = z.ScanCursor(res.Next)
+	}
+}
+
+// scanKeys calls fn with every key of a database through its iterator, which may read the
+// values along.
+func scanKeys(database tmdb.DB, fn func(key []byte) error) error {
+	it, err := database.Iterator(nil, nil)
+	if err != nil {
+		return err
+	}
+	defer it.Close()
+
+	for ; it.Valid(); it.Next() {
+		if err := fn(it.Key()); err != nil {
+			return err
+		}
+	}
+
+	return it.Error()
+}
+
+// Domain returns the start (inclusive) and end (exclusive) limits of the iterator.
+// CONTRACT: start, end readonly []byte
+func (s *sortedIterator) Domain() (start []byte, end []byte) {
+	return s.start, s.end
+}
+
+// Valid returns whether the current iterator is valid.
+func (s *sortedIterator) Valid() bool {
+	return s.err == nil && len(s.keys) > 0
+}
+
+// Next moves the iterator to the next key. If Valid returns false, this method will panic.
+func (s *sortedIterator) Next() {
+	s.assertValid()
+
+	s.keys = s.keys[1:]
+	s.value = nil
+	s.loaded = false
+}
+
+// Key returns the key at the current position. Panics if the iterator is invalid.
+// CONTRACT: key readonly []byte
+func (s *sortedIterator) Key() []byte {
+	s.assertValid()
+
+	return s.keys[0]
+}
+
+// Value reads the value at the current position. Panics if the iterator is invalid. If the
+// value can't be read, it returns nil and the iterator becomes invalid, with the error
+// returned by Error.
+// CONTRACT: value readonly []byte
+func (s *sortedIterator) Value() []byte {
+	s.assertValid()
+
+	if !s.loaded {
+		s.value, s.err = s.database.Get(s.keys[0])
+		s.loaded = true
+	}
+
+	return s.value
+}
+
+// Error returns the error which occurred reading a value, if any.
+func (s *sortedIterator) Error() error {
+	return s.err
+}
+
+// Close drops the keys.
+func (s *sortedIterator) Close() error {
+	s.keys = nil
+	s.value = nil
+
+	return nil
+}
+
+func (s *sortedIterator) assertValid() {
+	if !s.Valid() {
+		if s.err != nil {
+			panic(s.err)
+		}
+
+		panic("iterator is invalid")
+	}
+}
@@ -0,0 +1,80 @@
+package shard
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"sort"
+	"strconv"
+)
+
+// DefaultReplicas is the default number of points every shard has on the ring.
+const DefaultReplicas = 128
+
+// Ring maps keys to shards with consistent hashing: every shard owns several points of a hash
+// ring, and a key belongs to the shard owning the first point following the hash of its prefix.
+// Adding a shard only moves the keys falling right before its points.
+type Ring struct {
+	points       []uint64
+	owners       map[uint64]string
+	names        []string
+	prefixLength int
+}
+
+// NewRing creates a ring of the named shards. Only the first prefixLength bytes of keys are
+// hashed, so keys sharing a prefix stay on the same shard, zero hashes the whole key.
+func NewRing(names []string, replicas, prefixLength int) *Ring {
+	if replicas <= 0 {
+		replicas = DefaultReplicas
+	}
+
+	r := &Ring{
+		owners:       make(map[uint64]string, len(names)*replicas),
+		names:        append([]string{}, names...),
+		prefixLength: prefixLength,
+	}
+
+	for _, name := range names {
+		for i := 0; i < replicas; i++ {
+			point := hash([]byte(name + "#" + strconv.Itoa(i)))
+			if _, ok := r.owners[point]; ok {
+				continue
+			}
+
+			r.owners[point] = name
+			r.points = append(r.points, point)
+		}
+	}
+
+	sort.Slice(r.points, func(i, j int) bool { return r.points[i] < r.points[j] })
+
+	return r
+}
+
+// Locate returns the name of the shard the key belongs to.
+func (r *Ring) Locate(key []byte) string {
+	if len(r.points) == 0 {
+		return ""
+	}
+
+	if r.prefixLength > 0 && len(key) > r.prefixLength {
+		key = key[:r.prefixLength]
+	}
+
+	h := hash(key)
+	idx := sort.Search(len(r.points), func(i int) bool { return r.points[i] >= h })
+	if idx == len(r.points) {
+		idx = 0
+	}
+
+	return r.owners[r.points[idx]]
+}
+
+// Names returns the names of the shards of the ring.
+func (r *Ring) Names() []string {
+	return append([]string{}, r.names...)
+}
+
+func hash(b []byte) uint64 {
+	sum := sha256.Sum256(b)
+	return binary.BigEndian.Uint64(sum[:8])
+}
@@ -0,0 +1,520 @@
+// Package shard spreads a logical tm-db database over several ZDB servers.
+//
+// Keys are mapped to shards with consistent hashing on their prefix. Batches are split per
+// shard, and iterators merge the ordered keys of every shard. When shards are added, keys are
+// looked up on the shard that owned them before until Rebalance moved them.
+//
+// ZDB iterates in insertion order, not in key order, so an iterator over ZDB shards scans all
+// their keys, whatever its range, and sorts the ones in range. Only bounded ranges of at most
+// Options.MaxSortedKeys keys can be iterated this way, their values are read as the iterator
+// moves.
+package shard
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/mariobassem/tendermint-zdb/pkg/db"
+	tmdb "github.com/tendermint/tm-db"
+)
+
+const (
+	// DefaultBatchSize is the default number of keys moved per batch by Rebalance.
+	DefaultBatchSize = 1000
+	// DefaultMaxSortedKeys is the default number of keys an iterator sorts per unordered shard.
+	DefaultMaxSortedKeys = 10000
+)
+
+var _ tmdb.DB = (*DB)(nil)
+
+var (
+	ErrNoShards         = errors.New("no shards")
+	ErrDuplicateShard   = errors.New("duplicate shard name")
+	ErrUnknownShard     = errors.New("unknown shard")
+	ErrRebalancePending = errors.New("shards were added, but the keys were not rebalanced yet")
+	ErrUnboundedRange   = errors.New("unordered shards can't be iterated without a start and an end")
+	ErrRangeTooLarge    = errors.New("too many keys in range to sort")
+)
+
+// Shard is a named database holding a part of the keys. The name, not the database address,
+// decides which keys the shard holds, so a shard can be moved to another server.
+type Shard struct {
+	Name string
+	DB   tmdb.DB
+	// Unordered is set for databases which don't iterate in key order, such as wrappers of
+	// db.ZDB, which iterates in insertion order. Their keys are read and sorted when an
+	// iterator is created. It is set for a *db.ZDB.
+	Unordered bool
+}
+
+func (s Shard) unordered() bool {
+	_, zdb := s.DB.(*db.ZDB)
+	return s.Unordered || zdb
+}
+
+// Options configures a sharded database. Every process using the same shards must use the
+// same options, or keys won't be found.
+type Options struct {
+	// Replicas is the number of points every shard has on the ring.
+	Replicas int
+	// PrefixLength is the number of leading key bytes hashed to pick a shard, keys sharing
+	// that prefix are kept on the same shard. Zero hashes whole keys.
+	PrefixLength int
+	// Previous lists the shards before shards were added. While set, keys that are not on
+	// their shard yet are read from the shard that owned them before.
+	Previous []string
+	// MaxSortedKeys is the maximum number of keys of an unordered shard in the range of an
+	// iterator, which are held in memory to be sorted. Iterators over more fail with
+	// ErrRangeTooLarge.
+	MaxSortedKeys int
+}
+
+// DB is a tmdb.DB spreading its keys over shards.
+type DB struct {
+	opts Options
+
+	mu        sync.RWMutex
+	shards    map[string]tmdb.DB
+	unordered map[string]bool
+	ring      *Ring
+	previous  *Ring
+}
+
+// New creates a database over the given shards. The returned DB owns the shards, and closes
+// them on Close.
+func New(shards []Shard, opts Options) (*DB, error) {
+	if len(shards) == 0 {
+		return nil, ErrNoShards
+	}
+
+	if opts.MaxSortedKeys <= 0 {
+		opts.MaxSortedKeys = DefaultMaxSortedKeys
+	}
+
+	d := &DB{
+		opts:      opts,
+		shards:    make(map[string]tmdb.DB, len(shards)),
+		unordered: make(map[string]bool),
+	}
+
+	names := make([]string, 0, len(shards))
+	for _, s := range shards {
+		if _, ok := d.shards[s.Name]; ok {
+			return nil, fmt.Errorf("%w: %s", ErrDuplicateShard, s.Name)
+		}
+
+		d.shards[s.Name] = s.DB
+		d.unordered[s.Name] = s.unordered()
+		names = append(names, s.Name)
+	}
+
+	d.ring = NewRing(names, opts.Replicas, opts.PrefixLength)
+
+	if len(opts.Previous) > 0 {
+		for _, name := range opts.Previous {
+			if _, ok := d.shards[name]; !ok {
+				return nil, fmt.Errorf("%w: previous shard %s", ErrUnknownShard, name)
+			}
+		}
+
+		d.previous = NewRing(opts.Previous, opts.Replicas, opts.PrefixLength)
+	}
+
+	return d, nil
+}
+
+// AddShards adds shards to the database. Keys moving to the new shards are still read from
+// their previous shard until Rebalance moved them, and no shard can be added meanwhile.
+func (d *DB) AddShards(shards ...Shard) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.previous != nil {
+		return ErrRebalancePending
+	}
+
+	for _, s := range shards {
+		if _, ok := d.shards[s.Name]; ok {
+			return fmt.Errorf("%w: %s", ErrDuplicateShard, s.Name)
+		}
+	}
+
+	d.previous = d.ring
+
+	names := d.ring.Names()
+	for _, s := range shards {
+		d.shards[s.Name] = s.DB
+		d.unordered[s.Name] = s.unordered()
+		names = append(names, s.Name)
+	}
+
+	d.ring = NewRing(names, d.opts.Replicas, d.opts.PrefixLength)
+
+	return nil
+}
+
+// Shard returns the name of the shard holding the key.
+func (d *DB) Shard(key []byte) string {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	return d.ring.Locate(key)
+}
+
+// locate returns the shard owning the key, and the shard that owned it before shards were
+// added if it is another one. The caller must hold d.mu.
+func (d *DB) locate(key []byte) (owner tmdb.DB, previous tmdb.DB) {
+	name := d.ring.Locate(key)
+	owner = d.shards[name]
+
+	if d.previous != nil {
+		if prev := d.previous.Locate(key); prev != name {
+			previous = d.shards[prev]
+		}
+	}
+
+	return owner, previous
+}
+
+// Get fetches the value of the given key, or nil if it does not exist.
+// CONTRACT: key, value readonly []byte
+func (d *DB) Get(key []byte) ([]byte, error) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	owner, previous := d.locate(key)
+
+	value, err := owner.Get(key)
+	if err != nil || value != nil || previous == nil {
+		return value, err
+	}
+
+	return previous.Get(key)
+}
+
+// Has checks if a key exists.
+// CONTRACT: key, value readonly []byte
+func (d *DB) Has(key []byte) (bool, error) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	owner, previous := d.locate(key)
+
+	has, err := owner.Has(key)
+	if err != nil || has || previous == nil {
+		return has, err
+	}
+
+	return previous.Has(key)
+}
+
+// Set sets the value for the given key on its shard.
+// CONTRACT: key, value readonly []byte
+func (d *DB) Set(key, value []byte) error {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	owner, _ := d.locate(key)
+
+	return owner.Set(key, value)
+}
+
+// SetSync sets the value for the given key, and flushes it to storage.
+// CONTRACT: key, value readonly []byte
+func (d *DB) SetSync(key, value []byte) error {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	owner, _ := d.locate(key)
+
+	return owner.SetSync(key, value)
+}
+
+// Delete deletes the key. A key that wasn't moved to its shard yet is deleted from its
+// previous shard too, so rebalancing doesn't bring it back.
+// CONTRACT: key readonly []byte
+func (d *DB) Delete(key []byte) error {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	owner, previous := d.locate(key)
+	if previous != nil {
+		if err := previous.Delete(key); err != nil {
+			return err
+		}
+	}
+
+	return owner.Delete(key)
+}
+
+// DeleteSync deletes the key, and flushes the deletion to storage.
+// CONTRACT: key readonly []byte
+func (d *DB) DeleteSync(key []byte) error {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	owner, previous := d.locate(key)
+	if previous != nil {
+		if err := previous.DeleteSync(key); err != nil {
+			return err
+		}
+	}
+
+	return owner.DeleteSync(key)
+}
+
+// Iterator returns an iterator merging the keys of every shard in ascending order. Creating it
+// scans every key of the unordered shards, see the package documentation, and fails with
+// ErrUnboundedRange if start or end is nil while there are unordered shards.
+// CONTRACT: No writes may happen within a domain while an iterator exists over it.
+// CONTRACT: start, end readonly []byte
+func (d *DB) Iterator(start, end []byte) (tmdb.Iterator, error) {
+	return d.newIterator(start, end, false)
+}
+
+// ReverseIterator returns an iterator merging the keys of every shard in descending order. It
+// has the cost and limits of Iterator.
+// CONTRACT: No writes may happen within a domain while an iterator exists over it.
+// CONTRACT: start, end readonly []byte
+func (d *DB) ReverseIterator(start, end []byte) (tmdb.Iterator, error) {
+	return d.newIterator(start, end, true)
+}
+
+func (d *DB) newIterator(start, end []byte, reverse bool) (tmdb.Iterator, error) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	iterators := make([]shardIterator, 0, len(d.shards))
+	for _, name := range d.ring.Names() {
+		var (
+			it  tmdb.Iterator
+			err error
+		)
+		switch {
+		case d.unordered[name]:
+			it, err = newSortedIterator(d.shards[name], start, end, reverse, d.opts.MaxSortedKeys)
+		case reverse:
+			it, err = d.shards[name].ReverseIterator(start, end)
+		default:
+			it, err = d.shards[name].Iterator(start, end)
+		}
+
+		if err != nil {
+			for _, s := range iterators {
+				s.Close()
+			}
+
+			return nil, fmt.Errorf("failed to create iterator on shard %s: %w", name, err)
+		}
+
+		iterators = append(iterators, shardIterator{Iterator: it, name: name})
+	}
+
+	return newMergeIterator(start, end, reverse, d.ring, iterators), nil
+}
+
+// Rebalance moves the keys that are not on their shard since shards were added, in batches of
+// batchSize keys, and returns the number of moved keys. A key already written to its new shard
+// is not overwritten. Once done, keys are only read from their shard.
+func (d *DB) Rebalance(ctx context.Context, batchSize int) (int, error) {
+	if batchSize <= 0 {
+		batchSize = DefaultBatchSize
+	}
+
+	d.mu.RLock()
+	if d.previous == nil {
+		d.mu.RUnlock()
+		return 0, nil
+	}
+
+	names := d.previous.Names()
+	d.mu.RUnlock()
+
+	moved := 0
+	for _, name := range names {
+		n, err := d.rebalanceShard(ctx, name, batchSize)
+		moved += n
+		if err != nil {
+			return moved, fmt.Errorf("failed to rebalance shard %s: %w", name, err)
+		}
+	}
+
+	d.mu.Lock()
+	d.previous = nil
+	d.mu.Unlock()
+
+	return moved, nil
+}
+
+// rebalanceShard copies the keys of a shard that belong to another shard, then deletes them
+// once the iteration is done, since keys can't be deleted while iterating.
+func (d *DB) rebalanceShard(ctx context.Context, name string, batchSize int) (int, error) {
+	d.mu.RLock()
+	src := d.shards[name]
+	d.mu.RUnlock()
+
+	moved, err := d.copyMoved(ctx, name, src, batchSize)
+	if err != nil {
+		return 0, err
+	}
+
+	for start := 0; start < len(moved); start += batchSize {
+		b := src.NewBatch()
+		for _, key := range moved[start:min(start+batchSize, len(moved))] {
+			if err := b.Delete(key); err != nil {
+				b.Close()
+				return start, err
+			}
+		}
+
+		if err := b.Write(); err != nil {
+			b.Close()
+			return start, err
+		}
+
+		if err := b.Close(); err != nil {
+			return start, err
+		}
+	}
+
+	return len(moved), nil
+}
+
+// copyMoved copies the keys of a shard that belong to another shard to their shard, unless
+// they were written there since, and returns them.
+func (d *DB) copyMoved(ctx context.Context, name string, src tmdb.DB, batchSize int) ([][]byte, error) {
+	it, err := src.Iterator(nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer it.Close()
+
+	pending := map[string]tmdb.Batch{}
+	counts := map[string]int{}
+	moved := [][]byte{}
+
+	flush := func(owner string) error {
+		b := pending[owner]
+		delete(pending, owner)
+		counts[owner] = 0
+
+		if err := b.Write(); err != nil {
+			b.Close()
+			return err
+		}
+
+		return b.Close()
+	}
+
+	defer func() {
+		for _, b := range pending {
+			b.Close()
+		}
+	}()
+
+	for ; it.Valid(); it.Next() {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		key := append([]byte{}, it.Key()...)
+
+		d.mu.RLock()
+		owner := d.ring.Locate(key)
+		dst := d.shards[owner]
+		d.mu.RUnlock()
+
+		if owner == name {
+			continue
+		}
+
+		// the key was written to its new shard since, the copy here is outdated
+		exists, err := dst.Has(key)
+		if err != nil {
+			return nil, err
+		}
+
+		if !exists {
+			if pending[owner] == nil {
+				pending[owner] = dst.NewBatch()
+			}
+
+			if err := pending[owner].Set(key, append([]byte{}, it.Value()...)); err != nil {
+				return nil, err
+			}
+
+			counts[owner]++
+			if counts[owner] == batchSize {
+				if err := flush(owner); err != nil {
+					return nil, err
+				}
+			}
+		}
+
+		moved = append(moved, key)
+	}
+
+	if err := it.Error(); err != nil {
+		return nil, err
+	}
+
+	for owner := range pending {
+		if err := flush(owner); err != nil {
+			return nil, err
+		}
+	}
+
+	return moved, nil
+}
+
+// Close closes every shard.
+func (d *DB) Close() error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	errs := []error{}
+	for name, s := range d.shards {
+		if err := s.Close(); err != nil {
+			errs = append(errs, fmt.Errorf("shard %s: %w", name, err))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// NewBatch creates a batch split per shard. The caller must call Batch.Close.
+func (d *DB) NewBatch() tmdb.Batch {
+	return &batch{db: d, batches: map[string]tmdb.Batch{}}
+}
+
+// Print is used for debugging.
+func (d *DB) Print() error {
+	return nil
+}
+
+// Stats returns the statistics of every shard, prefixed with the shard name.
+func (d *DB) Stats() map[string]string {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	stats := map[string]string{}
+	for name, s := range d.shards {
+		for k, v := range s.Stats() {
+			stats[name+"."+k] = v
+		}
+	}
+
+	return stats
+}
+
+func compareKeys(a, b []byte, reverse bool) int {
+	c := bytes.Compare(a, b)
+	if reverse {
+		return -c
+	}
+
+	return c
+}
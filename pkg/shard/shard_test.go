@@ -0,0 +1,290 @@
+package shard
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"testing"
+
+	"github.com/mariobassem/tendermint-zdb/pkg/db"
+	"github.com/mariobassem/tendermint-zdb/pkg/zdb/zdbtest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	tmdb "github.com/tendermint/tm-db"
+)
+
+func memShards(names ...string) []Shard {
+	shards := make([]Shard, 0, len(names))
+	for _, name := range names {
+		shards = append(shards, Shard{Name: name, DB: tmdb.NewMemDB()})
+	}
+
+	return shards
+}
+
+func keys(t *testing.T, it tmdb.Iterator) []string {
+	t.Helper()
+	defer it.Close()
+
+	ret := []string{}
+	for ; it.Valid(); it.Next() {
+		ret = append(ret, string(it.Key()))
+	}
+	require.NoError(t, it.Error())
+
+	return ret
+}
+
+func TestRing(t *testing.T) {
+	ring := NewRing([]string{"a", "b", "c"}, 0, 2)
+
+	counts := map[string]int{}
+	for i := 0; i < 3000; i++ {
+		key := []byte(fmt.Sprintf("%04d", i))
+		counts[ring.Locate(key)]++
+
+		// keys sharing a prefix stay together
+		assert.Equal(t, ring.Locate(key[:2]), ring.Locate(key))
+	}
+
+	for name, count := range counts {
+		assert.Greater(t, count, 500, name)
+	}
+
+	// adding a shard only moves keys to the new shard
+	grown := NewRing([]string{"a", "b", "c", "d"}, 0, 0)
+	whole := NewRing([]string{"a", "b", "c"}, 0, 0)
+	for i := 0; i < 1000; i++ {
+		key := []byte(fmt.Sprintf("key-%d", i))
+		if owner := grown.Locate(key); owner != "d" {
+			assert.Equal(t, whole.Locate(key), owner)
+		}
+	}
+}
+
+func TestShardedIterators(t *testing.T) {
+	d, err := New(memShards("a", "b", "c"), Options{})
+	require.NoError(t, err)
+	defer d.Close()
+
+	want := []string{}
+	for i := 0; i < 50; i++ {
+		key := fmt.Sprintf("key-%02d", i)
+		want = append(want, key)
+		require.NoError(t, d.Set([]byte(key), []byte(key)))
+	}
+
+	it, err := d.Iterator(nil, nil)
+	require.NoError(t, err)
+	assert.Equal(t, want, keys(t, it))
+
+	it, err = d.Iterator([]byte("key-10"), []byte("key-20"))
+	require.NoError(t, err)
+	assert.Equal(t, want[10:20], keys(t, it))
+
+	it, err = d.ReverseIterator(nil, nil)
+	require.NoError(t, err)
+	got := keys(t, it)
+	for i, j := 0, len(got)-1; i < j; i, j = i+1, j-1 {
+		got[i], got[j] = got[j], got[i]
+	}
+	assert.Equal(t, want, got)
+
+	it, err = d.Iterator([]byte("key-42"), nil)
+	require.NoError(t, err)
+	require.True(t, it.Valid())
+	assert.Equal(t, []byte("key-42"), it.Value())
+	it.Close()
+}
+
+func TestShardedBatch(t *testing.T) {
+	shards := memShards("a", "b", "c")
+	d, err := New(shards, Options{})
+	require.NoError(t, err)
+	defer d.Close()
+
+	require.NoError(t, d.Set([]byte("deleted"), []byte("value")))
+
+	b := d.NewBatch()
+	for i := 0; i < 30; i++ {
+		require.NoError(t, b.Set([]byte(fmt.Sprintf("key-%d", i)), []byte("value")))
+	}
+	require.NoError(t, b.Delete([]byte("deleted")))
+	require.NoError(t, b.Write())
+	assert.Error(t, b.Write())
+
+	for _, s := range shards {
+		it, err := s.DB.Iterator(nil, nil)
+		require.NoError(t, err)
+
+		onShard := keys(t, it)
+		assert.NotEmpty(t, onShard, s.Name)
+		for _, key := range onShard {
+			assert.Equal(t, s.Name, d.Shard([]byte(key)))
+		}
+	}
+
+	has, err := d.Has([]byte("deleted"))
+	require.NoError(t, err)
+	assert.False(t, has)
+}
+
+func TestRebalance(t *testing.T) {
+	d, err := New(memShards("a", "b"), Options{})
+	require.NoError(t, err)
+	defer d.Close()
+
+	for i := 0; i < 100; i++ {
+		require.NoError(t, d.Set([]byte(fmt.Sprintf("key-%02d", i)), []byte("old")))
+	}
+
+	added := memShards("c")
+	require.NoError(t, d.AddShards(added...))
+	assert.ErrorIs(t, d.AddShards(memShards("d")...), ErrRebalancePending)
+
+	// keys are read from their previous shard until they are moved
+	value, err := d.Get([]byte("key-07"))
+	require.NoError(t, err)
+	assert.Equal(t, []byte("old"), value)
+
+	// writes made while rebalancing win over the moved copies, and deletions stick
+	movedKeys := []string{}
+	for i := 0; i < 100; i++ {
+		key := fmt.Sprintf("key-%02d", i)
+		if d.Shard([]byte(key)) == "c" {
+			movedKeys = append(movedKeys, key)
+		}
+	}
+	require.Greater(t, len(movedKeys), 2)
+	require.NoError(t, d.Set([]byte(movedKeys[0]), []byte("new")))
+	require.NoError(t, d.Delete([]byte(movedKeys[1])))
+
+	it, err := d.Iterator(nil, nil)
+	require.NoError(t, err)
+	assert.Len(t, keys(t, it), 99)
+
+	moved, err := d.Rebalance(context.Background(), 10)
+	require.NoError(t, err)
+	assert.Equal(t, len(movedKeys)-1, moved)
+
+	it, err = added[0].DB.Iterator(nil, nil)
+	require.NoError(t, err)
+	assert.Len(t, keys(t, it), len(movedKeys)-1)
+
+	value, err = d.Get([]byte(movedKeys[0]))
+	require.NoError(t, err)
+	assert.Equal(t, []byte("new"), value)
+
+	value, err = d.Get([]byte(movedKeys[1]))
+	require.NoError(t, err)
+	assert.Nil(t, value)
+
+	value, err = d.Get([]byte(movedKeys[2]))
+	require.NoError(t, err)
+	assert.Equal(t, []byte("old"), value)
+
+	it, err = d.Iterator(nil, nil)
+	require.NoError(t, err)
+	assert.Len(t, keys(t, it), 99)
+}
+
+func TestShardedZDB(t *testing.T) {
+	shards := []Shard{}
+	for _, name := range []string{"a", "b"} {
+		server, err := zdbtest.NewServer()
+		require.NoError(t, err)
+		t.Cleanup(func() { server.Close() })
+
+		z, err := db.NewZDB(server.Addr())
+		require.NoError(t, err)
+
+		shards = append(shards, Shard{Name: name, DB: &z})
+	}
+
+	d, err := New(shards, Options{PrefixLength: 1})
+	require.NoError(t, err)
+	defer d.Close()
+
+	b := d.NewBatch()
+	for i := 0; i < 20; i++ {
+		require.NoError(t, b.Set([]byte(fmt.Sprintf("%c-%d", 'a'+i%4, i)), []byte("value")))
+	}
+	require.NoError(t, b.Write())
+
+	for i := 0; i < 20; i++ {
+		value, err := d.Get([]byte(fmt.Sprintf("%c-%d", 'a'+i%4, i)))
+		require.NoError(t, err)
+		assert.Equal(t, []byte("value"), value)
+	}
+
+	// ZDB iterates in insertion order, the merged keys are sorted
+	all := []string{}
+	for i := 0; i < 20; i++ {
+		all = append(all, fmt.Sprintf("%c-%d", 'a'+i%4, i))
+	}
+
+	for _, key := range []string{"z", "m", "a", "q", "b", "c", "y"} {
+		require.NoError(t, d.Set([]byte(key), []byte("value")))
+		all = append(all, key)
+	}
+	sort.Strings(all)
+
+	// iterators over unordered shards must be bounded
+	_, err = d.Iterator(nil, nil)
+	assert.ErrorIs(t, err, ErrUnboundedRange)
+	_, err = d.ReverseIterator([]byte("a"), nil)
+	assert.ErrorIs(t, err, ErrUnboundedRange)
+
+	it, err := d.Iterator([]byte("a"), []byte("{"))
+	require.NoError(t, err)
+	assert.Equal(t, all, keys(t, it))
+
+	// values are read as the iterator moves
+	it, err = d.Iterator([]byte("m"), []byte("n"))
+	require.NoError(t, err)
+	require.True(t, it.Valid())
+	assert.Equal(t, []byte("m"), it.Key())
+	assert.Equal(t, []byte("value"), it.Value())
+	require.NoError(t, it.Close())
+
+	inRange := []string{}
+	for _, key := range all {
+		if key >= "b" && key < "q" {
+			inRange = append(inRange, key)
+		}
+	}
+
+	it, err = d.Iterator([]byte("b"), []byte("q"))
+	require.NoError(t, err)
+	assert.Equal(t, inRange, keys(t, it))
+
+	sort.Sort(sort.Reverse(sort.StringSlice(inRange)))
+	it, err = d.ReverseIterator([]byte("b"), []byte("q"))
+	require.NoError(t, err)
+	assert.Equal(t, inRange, keys(t, it))
+}
+
+func TestShardedZDBRangeTooLarge(t *testing.T) {
+	server, err := zdbtest.NewServer()
+	require.NoError(t, err)
+	t.Cleanup(func() { server.Close() })
+
+	z, err := db.NewZDB(server.Addr())
+	require.NoError(t, err)
+
+	d, err := New([]Shard{{Name: "a", DB: &z}}, Options{MaxSortedKeys: 5})
+	require.NoError(t, err)
+	defer d.Close()
+
+	for i := 0; i < 10; i++ {
+		require.NoError(t, d.Set([]byte(fmt.Sprintf("key-%d", i)), []byte("value")))
+	}
+
+	_, err = d.Iterator([]byte("key-"), []byte("key."))
+	assert.ErrorIs(t, err, ErrRangeTooLarge)
+
+	// the limit applies to the keys in range, not to the scanned ones
+	it, err := d.Iterator([]byte("key-2"), []byte("key-7"))
+	require.NoError(t, err)
+	assert.Equal(t, []string{"key-2", "key-3", "key-4", "key-5", "key-6"}, keys(t, it))
+}
@@ -0,0 +1,112 @@
+package ttl
+
+import (
+	"errors"
+
+	tmdb "github.com/tendermint/tm-db"
+)
+
+var errBatchClosed = errors.New("batch has been written or closed")
+
+type op struct {
+	key    []byte
+	value  []byte
+	delete bool
+}
+
+// batch collects operations, then writes them in one ZDB batch. Values expire after
+// Options.DefaultTTL, counted from the time they are added to the batch.
+type batch struct {
+	db     *DB
+	ops    []op
+	closed bool
+}
+
+var _ tmdb.Batch = (*batch)(nil)
+
+// Set sets a key/value pair.
+// CONTRACT: key, value readonly []byte
+func (b *batch) Set(key, value []byte) error {
+	if b.closed {
+		return errBatchClosed
+	}
+
+	expiry, err := b.db.expiry(b.db.opts.DefaultTTL)
+	if err != nil {
+		return err
+	}
+
+	b.ops = append(b.ops, op{
+		key:   append([]byte{}, key...),
+		value: encode(expiry, value),
+	})
+
+	return nil
+}
+
+// Delete deletes a key/value pair.
+// CONTRACT: key readonly []byte
+func (b *batch) Delete(key []byte) error {
+	if b.closed {
+		return errBatchClosed
+	}
+
+	b.ops = append(b.ops, op{key: append([]byte{}, key...), delete: true})
+
+	return nil
+}
+
+// Write writes the batch.
+func (b *batch) Write() error {
+	if b.closed {
+		return errBatchClosed
+	}
+
+	if len(b.ops) > 0 {
+		if err := b.db.write(b.ops); err != nil {
+			return err
+		}
+	}
+
+	return b.Close()
+}
+
+// WriteSync writes the batch.
+func (b *batch) WriteSync() error {
+	return b.Write()
+}
+
+// Close closes the batch without writing it.
+func (b *batch) Close() error {
+	b.closed = true
+	b.ops = nil
+
+	return nil
+}
+
+func (d *DB) write(ops []op) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.closed {
+		return ErrClosed
+	}
+
+	b := d.zdb.NewBatch()
+	defer b.Close()
+
+	for _, o := range ops {
+		var err error
+		if o.delete {
+			err = b.Delete(o.key)
+		} else {
+			err = b.Set(o.key, o.value)
+		}
+
+		if err != nil {
+			return err
+		}
+	}
+
+	return b.Write()
+}
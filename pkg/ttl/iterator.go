@@ -0,0 +1,65 @@
+package ttl
+
+import (
+	"errors"
+	"time"
+
+	"github.com/mariobassem/tendermint-zdb/pkg/db"
+	tmdb "github.com/tendermint/tm-db"
+)
+
+// iterator skips the expired keys of an iterator, and strips the expiry from values. It
+// closes the connection of the iterator with it.
+type iterator struct {
+	tmdb.Iterator
+	conn  *db.ZDB
+	now   time.Time
+	value []byte
+}
+
+var _ tmdb.Iterator = (*iterator)(nil)
+
+func newIterator(it tmdb.Iterator, conn *db.ZDB, now time.Time) *iterator {
+	i := &iterator{Iterator: it, conn: conn, now: now}
+	i.skipExpired()
+
+	return i
+}
+
+// skipExpired moves the iterator to the first key which did not expire at the time it was
+// created, so an iteration sees the same keys expired.
+func (i *iterator) skipExpired() {
+	for i.Iterator.Valid() {
+		value, expired := decode(i.Iterator.Value(), i.now)
+		if !expired {
+			i.value = value
+			return
+		}
+
+		i.Iterator.Next()
+	}
+
+	i.value = nil
+}
+
+// Next moves the iterator to the next key which did not expire. If Valid returns false,
+// this method will panic.
+func (i *iterator) Next() {
+	i.Iterator.Next()
+	i.skipExpired()
+}
+
+// Value returns the value at the current position. Panics if the iterator is invalid.
+// CONTRACT: value readonly []byte
+func (i *iterator) Value() (value []byte) {
+	if !i.Valid() {
+		panic("iterator is invalid")
+	}
+
+	return i.value
+}
+
+// Close closes the iterator and its connection.
+func (i *iterator) Close() error {
+	return errors.Join(i.Iterator.Close(), i.conn.Close())
+}
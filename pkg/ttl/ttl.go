@@ -0,0 +1,507 @@
+// Package ttl emulates key expiry over a ZDB database, which has no TTL of its own.
+//
+// Every value is written with its expiry time. Expired keys are hidden from reads and
+// iterators as soon as they expire, and a sweeper walks the namespace to delete them.
+package ttl
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/mariobassem/tendermint-zdb/pkg/db"
+	tmdb "github.com/tendermint/tm-db"
+)
+
+const DefaultBatchSize = 1000
+
+var _ tmdb.DB = (*DB)(nil)
+
+var (
+	ErrTTLTooShort = errors.New("ttl is shorter than the minimum ttl")
+	ErrClosed      = errors.New("ttl database is closed")
+)
+
+// valueMagic starts every value written by this package. It is followed by the expiry time
+// as big endian unix nanoseconds, zero for keys which never expire, then by the value.
+// Values without the magic were not written by this package, and never expire. It must not
+// start with the value header prefix of the db package, {0xc7, 'z'}, which escapes the values
+// starting with it.
+var valueMagic = []byte{0xc7, 't', 'l'}
+
+const headerSize = 3 + 8
+
+// Options configures a TTL database.
+type Options struct {
+	// DefaultTTL is the TTL of the keys written with Set, zero means they never expire.
+	DefaultTTL time.Duration
+	// MinTTL is the shortest TTL accepted. Keys can't expire before their write time plus
+	// MinTTL, so the sweeper skips the keys written more recently without reading them.
+	MinTTL time.Duration
+	// SweepInterval is the interval between two sweeps, zero disables the background sweeper.
+	SweepInterval time.Duration
+	// BatchSize is the number of expired keys deleted in one batch.
+	BatchSize int
+	// Cursor resumes sweeping after the key of a previously saved cursor.
+	Cursor []byte
+	// OnCheckpoint is called with the scan cursor once the expired keys before it are
+	// deleted, so sweeping can be resumed with Options.Cursor.
+	OnCheckpoint func(cursor []byte)
+	// OnError is called when a background sweep fails.
+	OnError func(error)
+	// Now returns the current time, time.Now if nil.
+	Now func() time.Time
+}
+
+// DB is a tmdb.DB whose keys expire.
+type DB struct {
+	zdb  *db.ZDB
+	opts Options
+
+	// mu guards the connection of zdb, which can't be used concurrently, and orders writes
+	// with the deletions of the sweeper, so a key written again after expiring is not deleted.
+	mu     sync.Mutex
+	closed bool
+	swept  uint64
+
+	// sweepMu is held while sweeping, cursor is the scan cursor the next sweep resumes from.
+	sweepMu sync.Mutex
+	cursor  []byte
+
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+// New wraps a ZDB database, and starts the sweeper if Options.SweepInterval is set. The
+// returned DB owns the database, and closes it on Close.
+func New(zdb *db.ZDB, opts Options) (*DB, error) {
+	if opts.DefaultTTL != 0 && opts.DefaultTTL < opts.MinTTL {
+		return nil, ErrTTLTooShort
+	}
+
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = DefaultBatchSize
+	}
+
+	if opts.Now == nil {
+		opts.Now = time.Now
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	d := &DB{
+		zdb:    zdb,
+		opts:   opts,
+		cursor: opts.Cursor,
+		cancel: cancel,
+	}
+
+	if opts.SweepInterval > 0 {
+		d.wg.Add(1)
+		go d.sweepEvery(ctx, opts.SweepInterval)
+	}
+
+	return d, nil
+}
+
+// encode prefixes the value with its expiry time, the zero time never expires.
+func encode(expiry time.Time, value []byte) []byte {
+	ret := make([]byte, headerSize, headerSize+len(value))
+	copy(ret, valueMagic)
+	if !expiry.IsZero() {
+		binary.BigEndian.PutUint64(ret[len(valueMagic):], uint64(expiry.UnixNano()))
+	}
+
+	return append(ret, value...)
+}
+
+// decode returns the value, and whether it is expired at the given time.
+func decode(raw []byte, now time.Time) (value []byte, expired bool) {
+	if len(raw) < headerSize || !bytes.HasPrefix(raw, valueMagic) {
+		return raw, false
+	}
+
+	expiry := int64(binary.BigEndian.Uint64(raw[len(valueMagic):]))
+
+	return raw[headerSize:], expiry != 0 && now.UnixNano() >= expiry
+}
+
+func (d *DB) expiry(ttl time.Duration) (time.Time, error) {
+	if ttl == 0 {
+		return time.Time{}, nil
+	}
+
+	if ttl < d.opts.MinTTL || ttl < 0 {
+		return time.Time{}, ErrTTLTooShort
+	}
+
+	return d.opts.Now().Add(ttl), nil
+}
+
+// Get fetches the value of the given key, or nil if it does not exist or expired.
+// CONTRACT: key, value readonly []byte
+func (d *DB) Get(key []byte) ([]byte, error) {
+	raw, err := d.get(key)
+	if err != nil || raw == nil {
+		return nil, err
+	}
+
+	value, expired := decode(raw, d.opts.Now())
+	if expired {
+		return nil, nil
+	}
+
+	return value, nil
+}
+
+// Has checks if a key exists and did not expire.
+// CONTRACT: key, value readonly []byte
+func (d *DB) Has(key []byte) (bool, error) {
+	value, err := d.Get(key)
+	if err != nil {
+		return false, err
+	}
+
+	return value != nil, nil
+}
+
+// TTL returns the time left before the key expires, zero if it never expires, or false if it
+// does not exist or expired.
+func (d *DB) TTL(key []byte) (time.Duration, bool, error) {
+	raw, err := d.get(key)
+	if err != nil || raw == nil {
+		return 0, false, err
+	}
+
+	now := d.opts.Now()
+	if _, expired := decode(raw, now); expired {
+		return 0, false, nil
+	}
+
+	if len(raw) < headerSize || !bytes.HasPrefix(raw, valueMagic) {
+		return 0, true, nil
+	}
+
+	expiry := int64(binary.BigEndian.Uint64(raw[len(valueMagic):]))
+	if expiry == 0 {
+		return 0, true, nil
+	}
+
+	return time.Duration(expiry - now.UnixNano()), true, nil
+}
+
+// get returns the raw value of the key, with its expiry.
+func (d *DB) get(key []byte) ([]byte, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.closed {
+		return nil, ErrClosed
+	}
+
+	return d.zdb.Get(key)
+}
+
+// Set sets the value for the given key, expiring after Options.DefaultTTL.
+// CONTRACT: key, value readonly []byte
+func (d *DB) Set(key, value []byte) error {
+	return d.SetWithTTL(key, value, d.opts.DefaultTTL)
+}
+
+// SetSync sets the value for the given key, expiring after Options.DefaultTTL.
+// CONTRACT: key, value readonly []byte
+func (d *DB) SetSync(key, value []byte) error {
+	return d.Set(key, value)
+}
+
+// SetWithTTL sets the value for the given key, expiring after the ttl. A zero ttl never expires.
+// CONTRACT: key, value readonly []byte
+func (d *DB) SetWithTTL(key, value []byte, ttl time.Duration) error {
+	expiry, err := d.expiry(ttl)
+	if err != nil {
+		return err
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.closed {
+		return ErrClosed
+	}
+
+	return d.zdb.Set(key, encode(expiry, value))
+}
+
+// Delete deletes the key.
+// CONTRACT: key readonly []byte
+func (d *DB) Delete(key []byte) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.closed {
+		return ErrClosed
+	}
+
+	return d.zdb.Delete(key)
+}
+
+// DeleteSync deletes the key.
+// CONTRACT: key readonly []byte
+func (d *DB) DeleteSync(key []byte) error {
+	return d.Delete(key)
+}
+
+// Iterator returns an iterator over a domain of keys, skipping expired keys. It uses its own
+// connection.
+// CONTRACT: No writes may happen within a domain while an iterator exists over it.
+// CONTRACT: start, end readonly []byte
+func (d *DB) Iterator(start, end []byte) (tmdb.Iterator, error) {
+	return d.iterator(func(conn *db.ZDB) (tmdb.Iterator, error) {
+		return conn.Iterator(start, end)
+	})
+}
+
+// ReverseIterator returns an iterator over a domain of keys in descending order, skipping
+// expired keys. It uses its own connection.
+// CONTRACT: No writes may happen within a domain while an iterator exists over it.
+// CONTRACT: start, end readonly []byte
+func (d *DB) ReverseIterator(start, end []byte) (tmdb.Iterator, error) {
+	return d.iterator(func(conn *db.ZDB) (tmdb.Iterator, error) {
+		return conn.ReverseIterator(start, end)
+	})
+}
+
+// iterator opens an iterator on a new connection, an iterator reads the database as it is
+// consumed, along the other calls.
+func (d *DB) iterator(open func(conn *db.ZDB) (tmdb.Iterator, error)) (tmdb.Iterator, error) {
+	conn, err := d.zdb.Clone()
+	if err != nil {
+		return nil, err
+	}
+
+	it, err := open(conn)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	return newIterator(it, conn, d.opts.Now()), nil
+}
+
+// NewBatch creates a batch whose keys expire after Options.DefaultTTL.
+func (d *DB) NewBatch() tmdb.Batch {
+	return &batch{db: d}
+}
+
+// Print is used for debugging.
+func (d *DB) Print() error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	return d.zdb.Print()
+}
+
+// Stats returns the stats of the database, with the number of keys deleted by the sweeper.
+func (d *DB) Stats() map[string]string {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	stats := d.zdb.Stats()
+	if stats == nil {
+		stats = map[string]string{}
+	}
+
+	stats["ttl_swept"] = strconv.FormatUint(d.swept, 10)
+
+	return stats
+}
+
+// Close stops the sweeper, and closes the database.
+func (d *DB) Close() error {
+	d.mu.Lock()
+	if d.closed {
+		d.mu.Unlock()
+		return nil
+	}
+	d.closed = true
+	d.mu.Unlock()
+
+	d.cancel()
+	d.wg.Wait()
+
+	return d.zdb.Close()
+}
+
+func (d *DB) sweepEvery(ctx context.Context, interval time.Duration) {
+	defer d.wg.Done()
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		if _, err := d.Sweep(ctx); err != nil && ctx.Err() == nil && d.opts.OnError != nil {
+			d.opts.OnError(err)
+		}
+	}
+}
+
+// Sweep walks the namespace from the current cursor to its end, deletes the expired keys, and
+// returns how many were deleted. Once the end is reached, the cursor is reset so the next
+// sweep starts from the first key.
+//
+// Only writes made through this DB are ordered with the deletions: a key written by another
+// process after it expired may be deleted.
+func (d *DB) Sweep(ctx context.Context) (int, error) {
+	d.sweepMu.Lock()
+	defer d.sweepMu.Unlock()
+
+	conn, err := d.zdb.Clone()
+	if err != nil {
+		return 0, err
+	}
+	defer conn.Close()
+
+	cursor := d.cursor
+	swept := 0
+	expired := [][]byte{}
+	for {
+		if err := ctx.Err(); err != nil {
+			return swept, err
+		}
+
+		var res db.ScanResponse
+		if cursor == nil {
+			res, err = conn.Scan()
+		} else {
+			res, err = conn.ScanCursor(cursor)
+		}
+
+		if errors.Is(err, db.ErrCursorNoMoreData) {
+			n, err := d.deleteExpired(conn, expired)
+			swept += n
+			if err != nil {
+				return swept, err
+			}
+
+			d.checkpoint(nil)
+
+			return swept, nil
+		}
+		if err != nil {
+			return swept, err
+		}
+
+		now := d.opts.Now()
+		for _, k := range res.Keys {
+			// the key was written too recently to have expired
+			if d.opts.MinTTL > 0 && time.Unix(k.Timestamp, 0).Add(d.opts.MinTTL).After(now) {
+				continue
+			}
+
+			key, raw, err := conn.Entry(k.Key)
+			if err != nil {
+				return swept, err
+			}
+
+			if key == nil {
+				continue
+			}
+
+			if _, isExpired := decode(raw, now); isExpired {
+				expired = append(expired, key)
+			}
+		}
+
+		// the cursor is saved once the expired keys before it are deleted
+		cursor = res.Next
+		if len(expired) < d.opts.BatchSize {
+			continue
+		}
+
+		n, err := d.deleteExpired(conn, expired)
+		swept += n
+		if err != nil {
+			return swept, err
+		}
+
+		expired = expired[:0]
+		d.checkpoint(cursor)
+	}
+}
+
+func (d *DB) checkpoint(cursor []byte) {
+	d.cursor = cursor
+	if d.opts.OnCheckpoint != nil {
+		d.opts.OnCheckpoint(cursor)
+	}
+}
+
+// deleteExpired deletes the keys which are still expired, in batches of Options.BatchSize.
+func (d *DB) deleteExpired(conn *db.ZDB, keys [][]byte) (int, error) {
+	deleted := 0
+	for len(keys) > 0 {
+		n := min(len(keys), d.opts.BatchSize)
+		chunk := keys[:n]
+		keys = keys[n:]
+
+		count, err := d.deleteBatch(conn, chunk)
+		deleted += count
+		if err != nil {
+			return deleted, err
+		}
+	}
+
+	return deleted, nil
+}
+
+func (d *DB) deleteBatch(conn *db.ZDB, keys [][]byte) (int, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.closed {
+		return 0, ErrClosed
+	}
+
+	b := conn.NewBatch()
+	defer b.Close()
+
+	now := d.opts.Now()
+	count := 0
+	for _, key := range keys {
+		// the key may have been written again since it was scanned
+		raw, err := conn.Get(key)
+		if err != nil {
+			return 0, err
+		}
+
+		if _, expired := decode(raw, now); raw == nil || !expired {
+			continue
+		}
+
+		if err := b.Delete(key); err != nil {
+			return 0, err
+		}
+		count++
+	}
+
+	if count == 0 {
+		return 0, nil
+	}
+
+	if err := b.Write(); err != nil {
+		return 0, err
+	}
+
+	d.swept += uint64(count)
+
+	return count, nil
+}
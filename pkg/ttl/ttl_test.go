@@ -0,0 +1,271 @@
+package ttl
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/mariobassem/tendermint-zdb/pkg/db"
+	"github.com/mariobassem/tendermint-zdb/pkg/zdb"
+	"github.com/mariobassem/tendermint-zdb/pkg/zdb/zdbtest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	tmdb "github.com/tendermint/tm-db"
+)
+
+// clock is a time source shared by the server and the database.
+type clock struct {
+	now atomic.Int64
+}
+
+func (c *clock) Now() time.Time {
+	return time.Unix(0, c.now.Load())
+}
+
+func (c *clock) Add(d time.Duration) {
+	c.now.Add(int64(d))
+}
+
+func open(t *testing.T, opts Options) (*DB, *clock) {
+	t.Helper()
+
+	c := &clock{}
+	c.now.Store(time.Unix(1700000000, 0).UnixNano())
+
+	server, err := zdbtest.NewServer()
+	require.NoError(t, err)
+	server.Now = c.Now
+	server.PageSize = 3
+	t.Cleanup(func() { server.Close() })
+
+	z, err := db.NewZDB(server.Addr())
+	require.NoError(t, err)
+
+	opts.Now = c.Now
+	d, err := New(&z, opts)
+	require.NoError(t, err)
+	t.Cleanup(func() { d.Close() })
+
+	return d, c
+}
+
+func keys(t *testing.T, it tmdb.Iterator) []string {
+	t.Helper()
+	defer it.Close()
+
+	ret := []string{}
+	for ; it.Valid(); it.Next() {
+		ret = append(ret, string(it.Key())+"="+string(it.Value()))
+	}
+	require.NoError(t, it.Error())
+
+	return ret
+}
+
+func TestExpiry(t *testing.T) {
+	d, c := open(t, Options{DefaultTTL: time.Minute, MinTTL: time.Second})
+
+	require.NoError(t, d.Set([]byte("a"), []byte("1")))
+	require.NoError(t, d.SetWithTTL([]byte("b"), []byte("2"), time.Hour))
+	require.NoError(t, d.SetWithTTL([]byte("c"), []byte("3"), 0))
+	assert.ErrorIs(t, d.SetWithTTL([]byte("d"), []byte("4"), time.Millisecond), ErrTTLTooShort)
+
+	b := d.NewBatch()
+	require.NoError(t, b.Set([]byte("e"), []byte("5")))
+	require.NoError(t, b.Write())
+
+	it, err := d.Iterator(nil, nil)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"a=1", "b=2", "c=3", "e=5"}, keys(t, it))
+
+	ttl, ok, err := d.TTL([]byte("b"))
+	require.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, time.Hour, ttl)
+
+	c.Add(time.Minute)
+
+	value, err := d.Get([]byte("a"))
+	require.NoError(t, err)
+	assert.Nil(t, value)
+
+	has, err := d.Has([]byte("e"))
+	require.NoError(t, err)
+	assert.False(t, has)
+
+	value, err = d.Get([]byte("b"))
+	require.NoError(t, err)
+	assert.Equal(t, []byte("2"), value)
+
+	_, ok, err = d.TTL([]byte("a"))
+	require.NoError(t, err)
+	assert.False(t, ok)
+
+	ttl, ok, err = d.TTL([]byte("c"))
+	require.NoError(t, err)
+	assert.True(t, ok)
+	assert.Zero(t, ttl)
+
+	it, err = d.Iterator(nil, nil)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"b=2", "c=3"}, keys(t, it))
+
+	it, err = d.ReverseIterator(nil, nil)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"c=3", "b=2"}, keys(t, it))
+}
+
+func TestSweep(t *testing.T) {
+	checkpoints := [][]byte{}
+	d, c := open(t, Options{
+		MinTTL:       time.Minute,
+		BatchSize:    4,
+		OnCheckpoint: func(cursor []byte) { checkpoints = append(checkpoints, cursor) },
+	})
+	ctx := context.Background()
+
+	for i := 0; i < 10; i++ {
+		require.NoError(t, d.SetWithTTL([]byte(fmt.Sprintf("short-%d", i)), []byte("value"), time.Minute))
+		require.NoError(t, d.SetWithTTL([]byte(fmt.Sprintf("long-%d", i)), []byte("value"), time.Hour))
+	}
+
+	// nothing can have expired yet, the keys are skipped without being read
+	swept, err := d.Sweep(ctx)
+	require.NoError(t, err)
+	assert.Zero(t, swept)
+
+	c.Add(time.Minute)
+
+	// a key written again after it expired is kept
+	require.NoError(t, d.SetWithTTL([]byte("short-0"), []byte("again"), time.Minute))
+
+	swept, err = d.Sweep(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 9, swept)
+	assert.Equal(t, "9", d.Stats()["ttl_swept"])
+
+	// the cursor is saved after every deleted batch, and reset at the end of the namespace
+	require.Greater(t, len(checkpoints), 2)
+	assert.Nil(t, checkpoints[len(checkpoints)-1])
+
+	it, err := d.Iterator(nil, nil)
+	require.NoError(t, err)
+	assert.Len(t, keys(t, it), 11)
+
+	value, err := d.Get([]byte("short-0"))
+	require.NoError(t, err)
+	assert.Equal(t, []byte("again"), value)
+
+	swept, err = d.Sweep(ctx)
+	require.NoError(t, err)
+	assert.Zero(t, swept)
+}
+
+func TestSweepResume(t *testing.T) {
+	d, c := open(t, Options{})
+
+	for i := 0; i < 6; i++ {
+		require.NoError(t, d.SetWithTTL([]byte(fmt.Sprintf("key-%d", i)), []byte("value"), time.Minute))
+	}
+	c.Add(time.Minute)
+
+	cursor, err := d.zdb.KeyCursor([]byte("key-2"))
+	require.NoError(t, err)
+
+	z, err := d.zdb.Clone()
+	require.NoError(t, err)
+
+	resumed, err := New(z, Options{Cursor: cursor, Now: c.Now})
+	require.NoError(t, err)
+	defer resumed.Close()
+
+	swept, err := resumed.Sweep(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, 3, swept)
+
+	exists, err := d.zdb.Exists([]byte("key-2"))
+	require.NoError(t, err)
+	assert.True(t, exists)
+
+	// the next sweep starts from the first key
+	swept, err = resumed.Sweep(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, 3, swept)
+}
+
+func TestValueMagic(t *testing.T) {
+	server, err := zdbtest.NewServer()
+	require.NoError(t, err)
+	t.Cleanup(func() { server.Close() })
+
+	z, err := db.NewZDB(server.Addr())
+	require.NoError(t, err)
+
+	d, err := New(&z, Options{})
+	require.NoError(t, err)
+	defer d.Close()
+
+	require.NoError(t, d.Set([]byte("key"), []byte("value")))
+
+	// the value is stored as is, the db package does not escape it
+	client := zdb.NewClient(server.Addr())
+	defer client.Close()
+
+	raw, err := client.Get(context.Background(), "key")
+	require.NoError(t, err)
+	assert.Equal(t, string(encode(time.Time{}, []byte("value"))), raw)
+
+	// values written by other packages are returned as is, even if they start like the
+	// values of the db package
+	foreign := []byte("\xc7zt-not-a-ttl-value")
+	require.NoError(t, z.Set([]byte("foreign"), foreign))
+
+	got, err := d.Get([]byte("foreign"))
+	require.NoError(t, err)
+	assert.Equal(t, foreign, got)
+}
+
+func TestConcurrentAccess(t *testing.T) {
+	d, _ := open(t, Options{})
+
+	const workers = 8
+
+	var wg sync.WaitGroup
+	errs := make(chan error, workers)
+	for i := 0; i < workers; i++ {
+		key := []byte{'k', byte('0' + i)}
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 50; j++ {
+				value := []byte{byte(j)}
+				if err := d.Set(key, value); err != nil {
+					errs <- err
+					return
+				}
+
+				got, err := d.Get(key)
+				if err != nil {
+					errs <- err
+					return
+				}
+
+				if !bytes.Equal(got, value) {
+					errs <- fmt.Errorf("got %x for %s, expected %x", got, key, value)
+					return
+				}
+			}
+		}()
+	}
+
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		require.NoError(t, err)
+	}
+}
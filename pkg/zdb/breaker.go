@@ -0,0 +1,116 @@
+package zdb
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/mariobassem/tendermint-zdb/pkg/internal/breaker"
+	"github.com/redis/go-redis/v9"
+)
+
+// ErrCircuitOpen is returned without sending the command while the circuit breaker is open.
+var ErrCircuitOpen = breaker.ErrOpen
+
+const (
+	DefaultBreakerErrorRate   = breaker.DefaultErrorRate
+	DefaultBreakerMinRequests = breaker.DefaultMinRequests
+	DefaultBreakerWindow      = breaker.DefaultWindow
+	DefaultBreakerOpenTimeout = breaker.DefaultOpenTimeout
+)
+
+// BreakerState is the state of a circuit breaker.
+type BreakerState = breaker.State
+
+const (
+	// BreakerClosed lets every command through.
+	BreakerClosed = breaker.Closed
+	// BreakerOpen fails every command with ErrCircuitOpen.
+	BreakerOpen = breaker.Open
+	// BreakerHalfOpen lets a few probe commands through, to decide whether to close again.
+	BreakerHalfOpen = breaker.HalfOpen
+)
+
+// BreakerOptions configures a CircuitBreaker.
+type BreakerOptions = breaker.Options
+
+// CircuitBreaker fails commands fast while ZDB is unhealthy, instead of letting every caller
+// wait for it. It is the same breaker as db.CircuitBreaker, so a client and a db.ZDB talking
+// to the same server can share one.
+type CircuitBreaker = breaker.Breaker
+
+func NewCircuitBreaker(opts BreakerOptions) *CircuitBreaker {
+	return breaker.New(opts)
+}
+
+// WithCircuitBreaker sends the commands and pipelines of the client through the circuit
+// breaker. A pipeline counts as a single command. The connections opened by ParallelScan and
+// Subscribe don't use it.
+func WithCircuitBreaker(b *CircuitBreaker) Option {
+	return func(o *clientOptions) {
+		o.breaker = b
+	}
+}
+
+// breakerHook admits the commands of a client through a circuit breaker, and reports their
+// results to it.
+type breakerHook struct {
+	breaker *CircuitBreaker
+}
+
+func (h breakerHook) DialHook(next redis.DialHook) redis.DialHook {
+	return next
+}
+
+func (h breakerHook) ProcessHook(next redis.ProcessHook) redis.ProcessHook {
+	return func(ctx context.Context, cmd redis.Cmder) error {
+		if err := h.breaker.Allow(); err != nil {
+			cmd.SetErr(err)
+			return err
+		}
+
+		start := time.Now()
+		err := next(ctx, cmd)
+		h.breaker.Record(breakerError(err), time.Since(start))
+
+		return err
+	}
+}
+
+func (h breakerHook) ProcessPipelineHook(next redis.ProcessPipelineHook) redis.ProcessPipelineHook {
+	return func(ctx context.Context, cmds []redis.Cmder) error {
+		if err := h.breaker.Allow(); err != nil {
+			for _, cmd := range cmds {
+				cmd.SetErr(err)
+			}
+			return err
+		}
+
+		start := time.Now()
+		err := next(ctx, cmds)
+
+		result := breakerError(err)
+		if err == nil {
+			// the first error reply tells whether ZDB refuses writes
+			for _, cmd := range cmds {
+				if result = breakerError(cmd.Err()); result != nil {
+					break
+				}
+			}
+		}
+		h.breaker.Record(result, time.Since(start))
+
+		return err
+	}
+}
+
+// breakerError returns the error of a command as seen by the breaker: error replies as a
+// *ServerError, and nil for a missing value or a command canceled by its caller, which say
+// nothing about the health of ZDB.
+func breakerError(err error) error {
+	if errors.Is(err, redis.Nil) || errors.Is(err, context.Canceled) {
+		return nil
+	}
+
+	return serverError(err)
+}
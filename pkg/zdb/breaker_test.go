@@ -0,0 +1,48 @@
+package zdb
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClientCircuitBreaker(t *testing.T) {
+	admin, server := newTestClient(t)
+	ctx := context.Background()
+
+	b := NewCircuitBreaker(BreakerOptions{OpenTimeout: time.Hour})
+	client := NewClient(server.Addr(), WithCircuitBreaker(b))
+	defer client.Close()
+
+	require.NoError(t, client.Set(ctx, "key", "value"))
+
+	// missing keys say nothing about the health of ZDB
+	for i := 0; i < DefaultBreakerMinRequests; i++ {
+		_, err := client.Get(ctx, "missing")
+		assert.ErrorIs(t, err, ErrNil)
+	}
+	assert.Equal(t, BreakerClosed, b.State())
+
+	require.NoError(t, admin.SetNamespace(ctx, "default", "maxsize", "1"))
+
+	// a full disk opens the breaker at once
+	err := client.Set(ctx, "other", "value")
+	assert.ErrorIs(t, err, ErrNamespaceFull)
+	assert.Equal(t, BreakerOpen, b.State())
+
+	_, err = client.Get(ctx, "key")
+	assert.ErrorIs(t, err, ErrCircuitOpen)
+
+	// the breaker is shared with the clients it is given to
+	other := NewClient(server.Addr(), WithCircuitBreaker(b))
+	defer other.Close()
+	assert.ErrorIs(t, other.Ping(ctx), ErrCircuitOpen)
+
+	// clients without the breaker are not affected
+	value, err := admin.Get(ctx, "key")
+	require.NoError(t, err)
+	assert.Equal(t, "value", value)
+}
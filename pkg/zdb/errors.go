@@ -0,0 +1,85 @@
+package zdb
+
+import (
+	"context"
+	"errors"
+
+	"github.com/mariobassem/tendermint-zdb/pkg/internal/zdberr"
+	"github.com/redis/go-redis/v9"
+)
+
+// Error replies of the server are returned as a *ServerError, which matches one of these
+// errors with errors.Is.
+var (
+	ErrCursorNoMoreData  = zdberr.ErrCursorNoMoreData
+	ErrKeyNotFound       = zdberr.ErrKeyNotFound
+	ErrNamespaceNotFound = zdberr.ErrNamespaceNotFound
+	ErrNamespaceExists   = zdberr.ErrNamespaceExists
+	ErrNamespaceInUse    = zdberr.ErrNamespaceInUse
+	ErrPermissionDenied  = zdberr.ErrPermissionDenied
+	ErrReadOnly          = zdberr.ErrReadOnly
+	ErrNamespaceFull     = zdberr.ErrNamespaceFull
+	ErrInvalidKey        = zdberr.ErrInvalidKey
+	ErrInvalidCursor     = zdberr.ErrInvalidCursor
+	ErrInvalidArgument   = zdberr.ErrInvalidArgument
+	ErrUnsupported       = zdberr.ErrUnsupported
+	ErrTimeout           = zdberr.ErrTimeout
+)
+
+// ServerError is an error reply of the server. It wraps the error of its kind, and the
+// redis.Error returned by go-redis.
+type ServerError = zdberr.ServerError
+
+// newRedisClient returns a go-redis client returning error replies as a *ServerError.
+func newRedisClient(opts *redis.Options) *redis.Client {
+	cl := redis.NewClient(opts)
+	cl.AddHook(errorHook{})
+
+	return cl
+}
+
+// serverError returns an error reply as a *ServerError, and other errors unchanged.
+func serverError(err error) error {
+	var redisErr redis.Error
+	if err == nil || errors.Is(err, redis.Nil) || !errors.As(err, &redisErr) {
+		return err
+	}
+
+	var serverErr *ServerError
+	if errors.As(err, &serverErr) {
+		return err
+	}
+
+	return zdberr.New(redisErr.Error(), err)
+}
+
+// errorHook replaces the error replies of the commands with a *ServerError.
+type errorHook struct{}
+
+func (errorHook) DialHook(next redis.DialHook) redis.DialHook {
+	return next
+}
+
+func (errorHook) ProcessHook(next redis.ProcessHook) redis.ProcessHook {
+	return func(ctx context.Context, cmd redis.Cmder) error {
+		err := serverError(next(ctx, cmd))
+		if err != nil {
+			cmd.SetErr(err)
+		}
+
+		return err
+	}
+}
+
+func (errorHook) ProcessPipelineHook(next redis.ProcessPipelineHook) redis.ProcessPipelineHook {
+	return func(ctx context.Context, cmds []redis.Cmder) error {
+		err := serverError(next(ctx, cmds))
+		for _, cmd := range cmds {
+			if cmdErr := serverError(cmd.Err()); cmdErr != nil {
+				cmd.SetErr(cmdErr)
+			}
+		}
+
+		return err
+	}
+}
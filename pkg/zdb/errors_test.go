@@ -0,0 +1,62 @@
+package zdb
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestServerErrors(t *testing.T) {
+	client, _ := newTestClient(t)
+	ctx := context.Background()
+
+	_, err := client.Scan(ctx)
+	assert.ErrorIs(t, err, ErrCursorNoMoreData)
+	assert.EqualError(t, err, "No more data")
+
+	var serverErr *ServerError
+	require.ErrorAs(t, err, &serverErr)
+	assert.Equal(t, "No more data", serverErr.Message)
+
+	var redisErr redis.Error
+	assert.ErrorAs(t, err, &redisErr)
+
+	_, err = client.KeyCursor(ctx, "missing")
+	assert.ErrorIs(t, err, ErrKeyNotFound)
+
+	err = client.Select(ctx, "missing")
+	assert.ErrorIs(t, err, ErrNamespaceNotFound)
+
+	require.NoError(t, client.NewNamespace(ctx, "app"))
+	assert.ErrorIs(t, client.NewNamespace(ctx, "app"), ErrNamespaceExists)
+	assert.ErrorIs(t, client.DeleteNamespace(ctx, "default"), ErrNamespaceInUse)
+
+	require.NoError(t, client.SetNamespace(ctx, "app", "password", "secret"))
+	require.NoError(t, client.SetNamespace(ctx, "app", "public", "0"))
+	assert.ErrorIs(t, client.Select(ctx, "app"), ErrPermissionDenied)
+	assert.ErrorIs(t, client.cl.Do(ctx, "SELECT", "app", "SECURE", "wrong").Err(), ErrPermissionDenied)
+
+	require.NoError(t, client.SetNamespace(ctx, "default", "worm", "1"))
+	require.NoError(t, client.Set(ctx, "key", "value"))
+	assert.ErrorIs(t, client.Set(ctx, "key", "other"), ErrReadOnly)
+
+	require.NoError(t, client.SetNamespace(ctx, "default", "maxsize", "1"))
+	err = client.Set(ctx, "other", "value")
+	assert.ErrorIs(t, err, ErrNamespaceFull)
+	assert.False(t, errors.Is(err, ErrReadOnly))
+
+	assert.ErrorIs(t, client.Set(ctx, string(make([]byte, 256)), "value"), ErrInvalidKey)
+	assert.ErrorIs(t, client.SetNamespace(ctx, "default", "color", "blue"), ErrInvalidArgument)
+
+	_, err = client.ScanCursor(ctx, "bad")
+	assert.ErrorIs(t, err, ErrInvalidCursor)
+
+	// nil replies are not errors of the server
+	_, err = client.Get(ctx, "missing")
+	assert.ErrorIs(t, err, ErrNil)
+	assert.False(t, errors.As(err, &serverErr))
+}
@@ -0,0 +1,252 @@
+package zdb
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// HookStatus is the state of a hook process.
+type HookStatus int
+
+const (
+	HookRunning HookStatus = iota
+	HookSucceeded
+	HookFailed
+)
+
+func (s HookStatus) String() string {
+	switch s {
+	case HookRunning:
+		return "running"
+	case HookSucceeded:
+		return "succeeded"
+	case HookFailed:
+		return "failed"
+	default:
+		return fmt.Sprintf("HookStatus(%d)", int(s))
+	}
+}
+
+// Hook is a hook process started by the server, as reported by HOOKS.
+type Hook struct {
+	ID        int64
+	Type      string
+	Arguments []string
+	PID       int64
+	// Started and Finished are unix timestamps, Finished is zero while the hook is running.
+	Started  int64
+	Finished int64
+	ExitCode int64
+	Status   HookStatus
+}
+
+// ListHooks returns the hooks started by the server which are still in its hooks list.
+func (c *Client) ListHooks(ctx context.Context) ([]Hook, error) {
+	res, err := c.cl.Do(ctx, "HOOKS").Slice()
+	if err != nil {
+		return nil, err
+	}
+
+	return parseHooksResponse(res)
+}
+
+// parseHooksResponse parses one array per hook: id, type, arguments, pid, started and
+// finished timestamps, and exit code.
+func parseHooksResponse(res []interface{}) ([]Hook, error) {
+	ret := make([]Hook, 0, len(res))
+	for _, elem := range res {
+		fields, ok := elem.([]interface{})
+		if !ok {
+			return nil, fmt.Errorf("invalid response, expected hook to be an array, but a %T was returned", elem)
+		}
+
+		hook, err := parseHook(fields)
+		if err != nil {
+			return nil, err
+		}
+
+		ret = append(ret, hook)
+	}
+
+	return ret, nil
+}
+
+func parseHook(fields []interface{}) (Hook, error) {
+	if len(fields) != 7 {
+		return Hook{}, fmt.Errorf("invalid response, a hook should have seven fields, but %d were returned", len(fields))
+	}
+
+	ints := make([]int64, 0, 5)
+	for _, v := range []interface{}{fields[0], fields[3], fields[4], fields[5], fields[6]} {
+		i, ok := v.(int64)
+		if !ok {
+			return Hook{}, fmt.Errorf("invalid response, expected hook field to be an int64, but a %T was returned", v)
+		}
+
+		ints = append(ints, i)
+	}
+
+	typ, ok := fields[1].(string)
+	if !ok {
+		return Hook{}, fmt.Errorf("invalid response, expected hook type to be a string, but a %T was returned", fields[1])
+	}
+
+	args, ok := fields[2].([]interface{})
+	if !ok {
+		return Hook{}, fmt.Errorf("invalid response, expected hook arguments to be an array, but a %T was returned", fields[2])
+	}
+
+	hook := Hook{
+		ID:        ints[0],
+		Type:      typ,
+		Arguments: make([]string, 0, len(args)),
+		PID:       ints[1],
+		Started:   ints[2],
+		Finished:  ints[3],
+		ExitCode:  ints[4],
+	}
+
+	for _, arg := range args {
+		s, ok := arg.(string)
+		if !ok {
+			return Hook{}, fmt.Errorf("invalid response, expected hook argument to be a string, but a %T was returned", arg)
+		}
+
+		hook.Arguments = append(hook.Arguments, s)
+	}
+
+	switch {
+	case hook.Finished == 0:
+		hook.Status = HookRunning
+	case hook.ExitCode != 0:
+		hook.Status = HookFailed
+	default:
+		hook.Status = HookSucceeded
+	}
+
+	return hook, nil
+}
+
+// HookEventType is the kind of change reported by a HookMonitor.
+type HookEventType int
+
+const (
+	HookEventStarted HookEventType = iota
+	HookEventFinished
+	HookEventFailed
+)
+
+func (t HookEventType) String() string {
+	switch t {
+	case HookEventStarted:
+		return "started"
+	case HookEventFinished:
+		return "finished"
+	case HookEventFailed:
+		return "failed"
+	default:
+		return fmt.Sprintf("HookEventType(%d)", int(t))
+	}
+}
+
+// HookEvent is a change of a hook seen by a HookMonitor.
+type HookEvent struct {
+	Type HookEventType
+	Hook Hook
+}
+
+const DefaultHookPollInterval = time.Second
+
+// HookMonitorOptions configures a HookMonitor.
+type HookMonitorOptions struct {
+	// Interval is the time between two polls of the hooks list.
+	Interval time.Duration
+	// OnEvent is called for every hook which started, finished or failed since the last poll.
+	OnEvent func(HookEvent)
+	// OnError is called when polling fails, the monitor keeps polling.
+	OnError func(error)
+}
+
+// HookMonitor polls the hooks list of the server, and reports the hooks starting, finishing
+// and failing.
+type HookMonitor struct {
+	client *Client
+	opts   HookMonitorOptions
+
+	mu   sync.Mutex
+	seen map[int64]Hook
+}
+
+func NewHookMonitor(client *Client, opts HookMonitorOptions) *HookMonitor {
+	if opts.Interval <= 0 {
+		opts.Interval = DefaultHookPollInterval
+	}
+
+	return &HookMonitor{
+		client: client,
+		opts:   opts,
+		seen:   map[int64]Hook{},
+	}
+}
+
+// Run polls the hooks list until the context is canceled.
+func (m *HookMonitor) Run(ctx context.Context) error {
+	ticker := time.NewTicker(m.opts.Interval)
+	defer ticker.Stop()
+
+	for {
+		if _, err := m.Poll(ctx); err != nil && ctx.Err() == nil && m.opts.OnError != nil {
+			m.opts.OnError(err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// Poll reads the hooks list once, and returns the changes since the previous poll. Hooks
+// already in the list on the first poll are reported as well, a hook seen for the first
+// time after it ended is reported as started then finished or failed.
+func (m *HookMonitor) Poll(ctx context.Context) ([]HookEvent, error) {
+	hooks, err := m.client.ListHooks(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	m.mu.Lock()
+	events := []HookEvent{}
+	current := make(map[int64]Hook, len(hooks))
+	for _, hook := range hooks {
+		current[hook.ID] = hook
+
+		prev, ok := m.seen[hook.ID]
+		// ids may be reused once a hook left the list
+		if !ok || prev.Started != hook.Started {
+			events = append(events, HookEvent{Type: HookEventStarted, Hook: hook})
+		} else if prev.Status == hook.Status {
+			continue
+		}
+
+		switch hook.Status {
+		case HookSucceeded:
+			events = append(events, HookEvent{Type: HookEventFinished, Hook: hook})
+		case HookFailed:
+			events = append(events, HookEvent{Type: HookEventFailed, Hook: hook})
+		}
+	}
+	m.seen = current
+	m.mu.Unlock()
+
+	if m.opts.OnEvent != nil {
+		for _, e := range events {
+			m.opts.OnEvent(e)
+		}
+	}
+
+	return events, nil
+}
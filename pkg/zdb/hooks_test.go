@@ -0,0 +1,103 @@
+package zdb
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/mariobassem/tendermint-zdb/pkg/zdb/zdbtest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestListHooks(t *testing.T) {
+	client, server := newTestClient(t)
+	ctx := context.Background()
+
+	started := time.Unix(1700000000, 0)
+	server.SetHook(zdbtest.Hook{ID: 1, Type: "ready", Arguments: []string{"node-1"}, PID: 100, Started: started})
+	server.SetHook(zdbtest.Hook{ID: 2, Type: "namespace-closing", Arguments: []string{"node-1", "ns"}, PID: 101, Started: started, Finished: started.Add(time.Second), ExitCode: 2})
+
+	hooks, err := client.ListHooks(ctx)
+	require.NoError(t, err)
+	require.Len(t, hooks, 2)
+
+	assert.Equal(t, Hook{
+		ID:        1,
+		Type:      "ready",
+		Arguments: []string{"node-1"},
+		PID:       100,
+		Started:   started.Unix(),
+		Status:    HookRunning,
+	}, hooks[0])
+	assert.Equal(t, []string{"node-1", "ns"}, hooks[1].Arguments)
+	assert.Equal(t, int64(2), hooks[1].ExitCode)
+	assert.Equal(t, HookFailed, hooks[1].Status)
+
+	_, err = parseHooksResponse([]interface{}{[]interface{}{int64(1), "ready"}})
+	assert.Error(t, err)
+
+	_, err = parseHooksResponse([]interface{}{"ready"})
+	assert.Error(t, err)
+}
+
+func TestHookMonitor(t *testing.T) {
+	client, server := newTestClient(t)
+	ctx := context.Background()
+
+	started := time.Unix(1700000000, 0)
+	server.SetHook(zdbtest.Hook{ID: 1, Type: "ready", PID: 100, Started: started})
+	server.SetHook(zdbtest.Hook{ID: 2, Type: "jump", PID: 101, Started: started, Finished: started, ExitCode: 0})
+
+	received := []HookEvent{}
+	monitor := NewHookMonitor(client, HookMonitorOptions{OnEvent: func(e HookEvent) { received = append(received, e) }})
+
+	events, err := monitor.Poll(ctx)
+	require.NoError(t, err)
+	require.Len(t, events, 3)
+	assert.Equal(t, HookEventStarted, events[0].Type)
+	assert.Equal(t, HookEventStarted, events[1].Type)
+	assert.Equal(t, HookEventFinished, events[2].Type)
+	assert.Equal(t, int64(2), events[2].Hook.ID)
+	assert.Equal(t, events, received)
+
+	events, err = monitor.Poll(ctx)
+	require.NoError(t, err)
+	assert.Empty(t, events)
+
+	server.SetHook(zdbtest.Hook{ID: 1, Type: "ready", PID: 100, Started: started, Finished: started.Add(time.Second), ExitCode: 1})
+	events, err = monitor.Poll(ctx)
+	require.NoError(t, err)
+	require.Len(t, events, 1)
+	assert.Equal(t, HookEventFailed, events[0].Type)
+	assert.Equal(t, int64(1), events[0].Hook.ExitCode)
+
+	// a reused id with a new start time is a new hook
+	server.SetHook(zdbtest.Hook{ID: 1, Type: "ready", PID: 102, Started: started.Add(time.Minute)})
+	events, err = monitor.Poll(ctx)
+	require.NoError(t, err)
+	require.Len(t, events, 1)
+	assert.Equal(t, HookEventStarted, events[0].Type)
+	assert.Equal(t, int64(102), events[0].Hook.PID)
+}
+
+func FuzzParseHooksResponse(f *testing.F) {
+	f.Add(zdbtest.EncodeReply([]interface{}{
+		[]interface{}{int64(1), "ready", []interface{}{"/bin/hook", "ready"}, int64(42), int64(1700000000), int64(0), int64(0)},
+		[]interface{}{int64(2), "close", []interface{}{}, int64(43), int64(1700000000), int64(1700000001), int64(1)},
+	}))
+	f.Add(zdbtest.EncodeReply([]interface{}{"ready"}))
+	f.Add(zdbtest.EncodeReply([]interface{}{[]interface{}{int64(1), "ready", nil, int64(42), int64(0), int64(0), int64(0)}}))
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		res, ok := decodeReply(data)
+		if !ok {
+			return
+		}
+
+		hooks, err := parseHooksResponse(res)
+		if err == nil && len(hooks) != len(res) {
+			t.Fatalf("decoded %d hooks out of %d", len(hooks), len(res))
+		}
+	})
+}
@@ -0,0 +1,408 @@
+package zdb
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+const (
+	DefaultLeaseTTL          = 30 * time.Second
+	DefaultLockRetryInterval = 100 * time.Millisecond
+
+	// maxLeaseHistory is the number of entries of a lock key read to find its state, enough
+	// for the writes of many contenders racing for the lock.
+	maxLeaseHistory = 1000
+)
+
+var (
+	ErrLockHeld = errors.New("lock is held by another owner")
+	ErrLockLost = errors.New("lock is not held anymore")
+)
+
+// LockOptions configures a Locker.
+type LockOptions struct {
+	// Owner names the process taking the lock, it is reported by Holder.
+	Owner string
+	// TTL is the duration of a lease, it must be renewed before it expires.
+	TTL time.Duration
+	// RetryInterval is the time Lock waits between two attempts to take a held lock.
+	RetryInterval time.Duration
+}
+
+// LeaseInfo describes the lease holding a lock.
+type LeaseInfo struct {
+	Owner string
+	// Token is the fencing token of the lease, it increases with every acquisition of the
+	// lock. Resources protected by the lock should refuse requests with a token lower than
+	// the highest one they have seen, so a process whose lease expired while it was paused
+	// can't overwrite the work of the next holder.
+	Token   uint64
+	Expires time.Time
+}
+
+// Locker is a lease based lock, stored in a key of the selected namespace. Processes using
+// the same key, on their own connection, take the lock in turn.
+//
+// ZDB has no conditional writes, so every write of the lock key records the nonce of the
+// write it was based on. A write is valid if no other write came between that write and
+// itself, which is checked in the history of the key: the state of the lock is the last
+// valid write, and writes racing with it are ignored. Expiries use the time of the server.
+//
+// The lock key must only be written by lockers.
+type Locker struct {
+	client *Client
+	key    string
+	opts   LockOptions
+}
+
+// Lease is a lock held by a Locker, until it expires or is released.
+type Lease struct {
+	locker *Locker
+	record leaseRecord
+
+	sync.Mutex
+}
+
+// leaseRecord is the value of a write of the lock key.
+type leaseRecord struct {
+	Owner string `json:"owner,omitempty"`
+	// ID identifies the lease holding the lock, it is empty once released.
+	ID    string `json:"id,omitempty"`
+	Token uint64 `json:"token"`
+	// Expires is the unix time in microseconds the lease expires at, by the server clock.
+	Expires int64 `json:"expires,omitempty"`
+	// Base is the nonce of the write this one is based on, empty for the first write.
+	Base string `json:"base"`
+	// Nonce makes every write unique, to find it in the history of the key.
+	Nonce string `json:"nonce"`
+}
+
+// leaseState is the state of a lock key.
+type leaseState struct {
+	// head is the nonce of the last write of the key, empty if it was never written.
+	head string
+	// record is the last valid write, zero if there is none.
+	record leaseRecord
+}
+
+func NewLocker(client *Client, key string, opts LockOptions) *Locker {
+	if opts.TTL <= 0 {
+		opts.TTL = DefaultLeaseTTL
+	}
+
+	if opts.RetryInterval <= 0 {
+		opts.RetryInterval = DefaultLockRetryInterval
+	}
+
+	return &Locker{
+		client: client,
+		key:    key,
+		opts:   opts,
+	}
+}
+
+// TryLock takes the lock if it is free, released or expired, and fails with ErrLockHeld
+// otherwise.
+func (l *Locker) TryLock(ctx context.Context) (*Lease, error) {
+	id, err := randomID()
+	if err != nil {
+		return nil, err
+	}
+
+	for {
+		st, err := l.state(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		now, err := l.client.Now(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		if held(st.record, now) {
+			return nil, ErrLockHeld
+		}
+
+		rec := leaseRecord{
+			Owner:   l.opts.Owner,
+			ID:      id,
+			Token:   st.record.Token + 1,
+			Expires: now.Add(l.opts.TTL).UnixMicro(),
+		}
+
+		ok, err := l.write(ctx, st, rec)
+		if err != nil {
+			return nil, err
+		}
+
+		if ok {
+			return &Lease{locker: l, record: rec}, nil
+		}
+
+		// another write came first, it may have taken the lock
+	}
+}
+
+// Lock waits until the lock is taken, or the context is canceled.
+func (l *Locker) Lock(ctx context.Context) (*Lease, error) {
+	timer := time.NewTimer(l.opts.RetryInterval)
+	defer timer.Stop()
+
+	for {
+		lease, err := l.TryLock(ctx)
+		if !errors.Is(err, ErrLockHeld) {
+			return lease, err
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-timer.C:
+		}
+
+		timer.Reset(l.opts.RetryInterval)
+	}
+}
+
+// Holder returns the lease holding the lock, or false if the lock is free.
+func (l *Locker) Holder(ctx context.Context) (LeaseInfo, bool, error) {
+	st, err := l.state(ctx)
+	if err != nil {
+		return LeaseInfo{}, false, err
+	}
+
+	now, err := l.client.Now(ctx)
+	if err != nil {
+		return LeaseInfo{}, false, err
+	}
+
+	if !held(st.record, now) {
+		return LeaseInfo{}, false, nil
+	}
+
+	return st.record.info(), true, nil
+}
+
+// state reads the history of the lock key back from its last write, up to the last valid
+// write.
+func (l *Locker) state(ctx context.Context) (leaseState, error) {
+	entry, err := l.client.History(ctx, l.key)
+	if errors.Is(err, ErrKeyNotFound) {
+		return leaseState{}, nil
+	}
+	if err != nil {
+		return leaseState{}, err
+	}
+
+	rec, err := l.parse(entry)
+	if err != nil {
+		return leaseState{}, err
+	}
+
+	st := leaseState{head: rec.Nonce}
+	for i := 0; ; i++ {
+		if i == maxLeaseHistory {
+			return leaseState{}, fmt.Errorf("no valid write in the last %d entries of lock %s", maxLeaseHistory, l.key)
+		}
+
+		prev, prevRec, err := l.previous(ctx, entry)
+		if err != nil {
+			return leaseState{}, err
+		}
+
+		if rec.Base == prevRec.Nonce {
+			st.record = rec
+			return st, nil
+		}
+
+		if entry.Previous == "" {
+			return st, nil
+		}
+
+		entry, rec = prev, prevRec
+	}
+}
+
+// write appends a record based on the state of the lock key. It reports whether the write
+// is valid, that is no other write came between the last write of the state and itself.
+func (l *Locker) write(ctx context.Context, st leaseState, rec leaseRecord) (bool, error) {
+	nonce, err := randomID()
+	if err != nil {
+		return false, err
+	}
+
+	rec.Base = st.head
+	rec.Nonce = nonce
+
+	value, err := json.Marshal(rec)
+	if err != nil {
+		return false, err
+	}
+
+	if err := l.client.Set(ctx, l.key, string(value)); err != nil {
+		return false, err
+	}
+
+	// writes of other lockers may follow this one
+	entry, err := l.client.History(ctx, l.key)
+	if err != nil {
+		return false, err
+	}
+
+	for i := 0; i < maxLeaseHistory; i++ {
+		prev, prevRec, err := l.previous(ctx, entry)
+		if err != nil {
+			return false, err
+		}
+
+		if entry.Value == string(value) {
+			return prevRec.Nonce == st.head, nil
+		}
+
+		if entry.Previous == "" {
+			break
+		}
+
+		entry = prev
+	}
+
+	return false, fmt.Errorf("write of lock %s not found in its history", l.key)
+}
+
+// previous returns the entry written before the given one, and its record. The record is zero
+// if the entry is the first one of the key.
+func (l *Locker) previous(ctx context.Context, entry HistoryEntry) (HistoryEntry, leaseRecord, error) {
+	if entry.Previous == "" {
+		return HistoryEntry{}, leaseRecord{}, nil
+	}
+
+	prev, err := l.client.HistoryWithData(ctx, l.key, entry.Previous)
+	if err != nil {
+		return HistoryEntry{}, leaseRecord{}, err
+	}
+
+	rec, err := l.parse(prev)
+	if err != nil {
+		return HistoryEntry{}, leaseRecord{}, err
+	}
+
+	return prev, rec, nil
+}
+
+func (l *Locker) parse(entry HistoryEntry) (leaseRecord, error) {
+	var rec leaseRecord
+	if err := json.Unmarshal([]byte(entry.Value), &rec); err != nil {
+		return leaseRecord{}, fmt.Errorf("key %s does not hold a lock: %w", l.key, err)
+	}
+
+	return rec, nil
+}
+
+// Token returns the fencing token of the lease.
+func (l *Lease) Token() uint64 {
+	l.Lock()
+	defer l.Unlock()
+
+	return l.record.Token
+}
+
+// Expires returns the time the lease expires at, by the server clock.
+func (l *Lease) Expires() time.Time {
+	l.Lock()
+	defer l.Unlock()
+
+	return time.UnixMicro(l.record.Expires)
+}
+
+// Renew extends the lease by the TTL of the locker. It fails with ErrLockLost if the lease
+// expired, even if the lock was not taken since.
+func (l *Lease) Renew(ctx context.Context) error {
+	l.Lock()
+	defer l.Unlock()
+
+	for {
+		st, err := l.locker.state(ctx)
+		if err != nil {
+			return err
+		}
+
+		now, err := l.locker.client.Now(ctx)
+		if err != nil {
+			return err
+		}
+
+		if st.record.ID != l.record.ID || !held(st.record, now) {
+			return ErrLockLost
+		}
+
+		rec := st.record
+		rec.Expires = now.Add(l.locker.opts.TTL).UnixMicro()
+
+		ok, err := l.locker.write(ctx, st, rec)
+		if err != nil {
+			return err
+		}
+
+		if ok {
+			l.record = rec
+			return nil
+		}
+	}
+}
+
+// Release frees the lock. It fails with ErrLockLost if the lock was taken by another lease
+// since this one expired.
+func (l *Lease) Release(ctx context.Context) error {
+	l.Lock()
+	defer l.Unlock()
+
+	for {
+		st, err := l.locker.state(ctx)
+		if err != nil {
+			return err
+		}
+
+		if st.record.ID != l.record.ID {
+			return ErrLockLost
+		}
+
+		// the token is kept, so the next lease gets a higher one
+		ok, err := l.locker.write(ctx, st, leaseRecord{Token: st.record.Token})
+		if err != nil {
+			return err
+		}
+
+		if ok {
+			return nil
+		}
+	}
+}
+
+func (r leaseRecord) info() LeaseInfo {
+	return LeaseInfo{
+		Owner:   r.Owner,
+		Token:   r.Token,
+		Expires: time.UnixMicro(r.Expires),
+	}
+}
+
+// held reports whether the record is a lease which did not expire.
+func held(r leaseRecord, now time.Time) bool {
+	return r.ID != "" && now.Before(time.UnixMicro(r.Expires))
+}
+
+func randomID() (string, error) {
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(b[:]), nil
+}
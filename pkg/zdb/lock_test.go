@@ -0,0 +1,198 @@
+package zdb
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLocker(t *testing.T) {
+	client, server := newTestClient(t)
+	other := NewClient(server.Addr())
+	defer other.Close()
+
+	ctx := context.Background()
+	indexer := NewLocker(client, "lock", LockOptions{Owner: "indexer"})
+	pruner := NewLocker(&other, "lock", LockOptions{Owner: "pruner"})
+
+	_, held, err := pruner.Holder(ctx)
+	require.NoError(t, err)
+	assert.False(t, held)
+
+	lease, err := indexer.TryLock(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, uint64(1), lease.Token())
+
+	_, err = pruner.TryLock(ctx)
+	assert.ErrorIs(t, err, ErrLockHeld)
+
+	holder, held, err := pruner.Holder(ctx)
+	require.NoError(t, err)
+	assert.True(t, held)
+	assert.Equal(t, "indexer", holder.Owner)
+	assert.Equal(t, uint64(1), holder.Token)
+	assert.Equal(t, lease.Expires(), holder.Expires)
+
+	require.NoError(t, lease.Release(ctx))
+
+	lease, err = pruner.TryLock(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, uint64(2), lease.Token())
+
+	// the lock can't be taken twice, even by the same locker
+	_, err = pruner.TryLock(ctx)
+	assert.ErrorIs(t, err, ErrLockHeld)
+}
+
+type lockClock struct {
+	now atomic.Int64
+}
+
+func (c *lockClock) Now() time.Time {
+	return time.Unix(0, c.now.Load())
+}
+
+func TestLockerExpiry(t *testing.T) {
+	client, server := newTestClient(t)
+	other := NewClient(server.Addr())
+	defer other.Close()
+
+	c := &lockClock{}
+	c.now.Store(time.Unix(1700000000, 0).UnixNano())
+	server.Now = c.Now
+
+	ctx := context.Background()
+	opts := LockOptions{TTL: 10 * time.Second}
+	first, err := NewLocker(client, "lock", opts).TryLock(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, time.Unix(1700000010, 0), first.Expires())
+
+	c.now.Add(int64(5 * time.Second))
+	require.NoError(t, first.Renew(ctx))
+	assert.Equal(t, time.Unix(1700000015, 0), first.Expires())
+
+	locker := NewLocker(&other, "lock", opts)
+	_, err = locker.TryLock(ctx)
+	assert.ErrorIs(t, err, ErrLockHeld)
+
+	c.now.Add(int64(10 * time.Second))
+	second, err := locker.TryLock(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, uint64(2), second.Token())
+
+	// the expired lease can't renew nor release the lock of the next one
+	assert.ErrorIs(t, first.Renew(ctx), ErrLockLost)
+	assert.ErrorIs(t, first.Release(ctx), ErrLockLost)
+
+	holder, held, err := locker.Holder(ctx)
+	require.NoError(t, err)
+	assert.True(t, held)
+	assert.Equal(t, uint64(2), holder.Token)
+
+	// an expired lease is lost, even if the lock was not taken since
+	c.now.Add(int64(10 * time.Second))
+	assert.ErrorIs(t, second.Renew(ctx), ErrLockLost)
+}
+
+func TestLockerWaits(t *testing.T) {
+	client, server := newTestClient(t)
+	other := NewClient(server.Addr())
+	defer other.Close()
+
+	lease, err := NewLocker(client, "lock", LockOptions{}).TryLock(context.Background())
+	require.NoError(t, err)
+
+	locker := NewLocker(&other, "lock", LockOptions{RetryInterval: 10 * time.Millisecond})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	_, err = locker.Lock(ctx)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		lease.Release(context.Background())
+	}()
+
+	ctx, cancel = context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	next, err := locker.Lock(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, uint64(2), next.Token())
+}
+
+func TestLockerContention(t *testing.T) {
+	_, server := newTestClient(t)
+
+	const (
+		lockers      = 5
+		acquisitions = 10
+	)
+
+	var (
+		inside  atomic.Bool
+		overlap atomic.Bool
+
+		mu     sync.Mutex
+		tokens []uint64
+	)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	var wg sync.WaitGroup
+	errs := make(chan error, lockers)
+	for i := 0; i < lockers; i++ {
+		client := NewClient(server.Addr())
+		defer client.Close()
+
+		locker := NewLocker(&client, "lock", LockOptions{RetryInterval: time.Millisecond})
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < acquisitions; j++ {
+				lease, err := locker.Lock(ctx)
+				if err != nil {
+					errs <- err
+					return
+				}
+
+				if !inside.CompareAndSwap(false, true) {
+					overlap.Store(true)
+				}
+
+				mu.Lock()
+				tokens = append(tokens, lease.Token())
+				mu.Unlock()
+
+				time.Sleep(time.Millisecond)
+				inside.Store(false)
+
+				if err := lease.Release(ctx); err != nil {
+					errs <- err
+					return
+				}
+			}
+		}()
+	}
+
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		require.NoError(t, err)
+	}
+
+	assert.False(t, overlap.Load(), "two lockers held the lock at the same time")
+
+	// every acquisition got the next fencing token
+	require.Len(t, tokens, lockers*acquisitions)
+	for i, token := range tokens {
+		assert.Equal(t, uint64(i+1), token)
+	}
+}
@@ -0,0 +1,158 @@
+package zdb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/mariobassem/tendermint-zdb/pkg/internal/logkey"
+	"github.com/redis/go-redis/v9"
+)
+
+// keyCommands are the commands whose first argument is a key.
+var keyCommands = map[string]bool{
+	"set":     true,
+	"get":     true,
+	"del":     true,
+	"exists":  true,
+	"checks":  true,
+	"keycur":  true,
+	"keytime": true,
+	"length":  true,
+	"history": true,
+}
+
+// WithLogger logs the commands sent by the client at debug level, and the connection failures
+// at warn level. Keys are logged as a hash and values are never logged, unless WithKeyLogging
+// is given. Nothing is logged by default.
+func WithLogger(l *slog.Logger) Option {
+	return func(o *clientOptions) {
+		o.logger = l
+	}
+}
+
+// WithKeyLogging logs keys as hex instead of a hash, to debug a database without private keys.
+func WithKeyLogging() Option {
+	return func(o *clientOptions) {
+		o.logKeys = true
+	}
+}
+
+// logHook logs the commands of a client. It keeps track of the selected namespace, as the
+// client uses a single connection.
+type logHook struct {
+	logger    *slog.Logger
+	logKeys   bool
+	namespace atomic.Pointer[string]
+}
+
+func (h *logHook) DialHook(next redis.DialHook) redis.DialHook {
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		conn, err := next(ctx, network, addr)
+		if err != nil {
+			h.logger.LogAttrs(ctx, slog.LevelWarn, "zdb dial failed",
+				slog.String("address", addr),
+				slog.String("error", err.Error()),
+			)
+		}
+
+		return conn, err
+	}
+}
+
+func (h *logHook) ProcessHook(next redis.ProcessHook) redis.ProcessHook {
+	return func(ctx context.Context, cmd redis.Cmder) error {
+		start := time.Now()
+		err := next(ctx, cmd)
+		latency := time.Since(start)
+
+		args := cmd.Args()
+		if err == nil && cmd.Name() == "select" && len(args) > 1 {
+			ns := fmt.Sprint(args[1])
+			h.namespace.Store(&ns)
+		}
+
+		level := slog.LevelDebug
+		var redisErr redis.Error
+		if err != nil && !errors.As(err, &redisErr) {
+			level = slog.LevelWarn
+		}
+
+		if !h.logger.Enabled(ctx, level) {
+			return err
+		}
+
+		attrs := []slog.Attr{
+			slog.String("namespace", h.currentNamespace()),
+			slog.String("command", strings.ToUpper(cmd.Name())),
+			slog.Duration("latency", latency),
+		}
+
+		if keyCommands[cmd.Name()] && len(args) > 1 {
+			attrs = append(attrs, logkey.Attr(argBytes(args[1]), h.logKeys))
+		}
+
+		if err != nil {
+			attrs = append(attrs, slog.String("error", err.Error()))
+		}
+
+		h.logger.LogAttrs(ctx, level, "zdb command", attrs...)
+
+		return err
+	}
+}
+
+func (h *logHook) ProcessPipelineHook(next redis.ProcessPipelineHook) redis.ProcessPipelineHook {
+	return func(ctx context.Context, cmds []redis.Cmder) error {
+		start := time.Now()
+		err := next(ctx, cmds)
+
+		level := slog.LevelDebug
+		var redisErr redis.Error
+		if err != nil && !errors.As(err, &redisErr) {
+			level = slog.LevelWarn
+		}
+
+		if !h.logger.Enabled(ctx, level) {
+			return err
+		}
+
+		attrs := []slog.Attr{
+			slog.String("namespace", h.currentNamespace()),
+			slog.Int("commands", len(cmds)),
+			slog.Duration("latency", time.Since(start)),
+		}
+
+		if err != nil {
+			attrs = append(attrs, slog.String("error", err.Error()))
+		}
+
+		h.logger.LogAttrs(ctx, level, "zdb pipeline", attrs...)
+
+		return err
+	}
+}
+
+func (h *logHook) currentNamespace() string {
+	if ns := h.namespace.Load(); ns != nil {
+		return *ns
+	}
+
+	return "default"
+}
+
+func argBytes(arg interface{}) []byte {
+	switch v := arg.(type) {
+	case string:
+		return []byte(v)
+	case []byte:
+		return v
+	default:
+		return []byte(fmt.Sprint(v))
+	}
+}
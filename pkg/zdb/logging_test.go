@@ -0,0 +1,45 @@
+package zdb
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClientLogger(t *testing.T) {
+	_, server := newTestClient(t)
+	ctx := context.Background()
+
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewTextHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug}))
+	client := NewClient(server.Addr(), WithLogger(logger))
+	defer client.Close()
+
+	require.NoError(t, client.NewNamespace(ctx, "app"))
+	require.NoError(t, client.Select(ctx, "app"))
+	require.NoError(t, client.Set(ctx, "secret-key", "secret-value"))
+	_, err := client.Get(ctx, "missing")
+	assert.ErrorIs(t, err, ErrNil)
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	require.Len(t, lines, 4)
+	assert.Contains(t, lines[0], "command=NSNEW")
+	assert.Contains(t, lines[0], "namespace=default")
+	assert.Contains(t, lines[2], "command=SET")
+	assert.Contains(t, lines[2], "namespace=app")
+	assert.Contains(t, lines[2], "key_hash=")
+	assert.Contains(t, lines[3], "level=DEBUG")
+	assert.NotContains(t, buf.String(), "secret")
+
+	buf.Reset()
+	revealing := NewClient(server.Addr(), WithLogger(logger), WithKeyLogging())
+	defer revealing.Close()
+	require.NoError(t, revealing.Set(ctx, "key", "secret-value"))
+	assert.Contains(t, buf.String(), "key=6b6579")
+	assert.NotContains(t, buf.String(), "secret")
+}
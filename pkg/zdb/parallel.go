@@ -0,0 +1,289 @@
+package zdb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	DefaultPartitions = 4
+
+	// maxBoundaryProbes is the number of entries read from the start of a data file to find
+	// a key which was not overwritten or deleted since, to split the scan at.
+	maxBoundaryProbes = 64
+)
+
+// ErrBoundaryMoved is returned by ParallelScan when the last key of a partition was written
+// or deleted before the partition reached it. The key moved to the end of the namespace, so
+// the partition can't tell where it ends anymore, the scan can be retried.
+var ErrBoundaryMoved = errors.New("last key of a partition was written during the scan")
+
+// Partition is a range of a namespace scan: the keys after the Start cursor, up to and
+// including the Last key.
+type Partition struct {
+	// Start is the cursor the partition is scanned after, empty to start from the first key.
+	Start string
+	// Last is the last key of the partition, empty to scan to the end of the namespace.
+	Last string
+}
+
+// ScanItem is a key returned by ParallelScan.
+type ScanItem struct {
+	// Partition is the index of the partition the key belongs to.
+	Partition int
+	Key       KeyInfo
+	// Value fetches the value of the key on the connection of its partition. It can only
+	// be called until the callback returns.
+	Value LazyValue
+}
+
+// ParallelScanOptions configures ParallelScan.
+type ParallelScanOptions struct {
+	// Namespace is the scanned namespace, the default one if empty.
+	Namespace string
+	Password  string
+	// Partitions is the maximum number of partitions scanned concurrently.
+	Partitions int
+}
+
+// dial opens a client and selects the namespace, if any.
+func dial(ctx context.Context, opts redis.Options, namespace, password string) (*Client, error) {
+	client := &Client{cl: newRedisClient(&opts)}
+
+	var err error
+	switch {
+	case namespace != "" && password != "":
+		err = client.cl.Do(ctx, "SELECT", namespace, password).Err()
+	case namespace != "":
+		err = client.Select(ctx, namespace)
+	default:
+		err = client.Ping(ctx)
+	}
+
+	if err != nil {
+		client.Close()
+		return nil, err
+	}
+
+	return client, nil
+}
+
+// Partitions splits the scan of the selected namespace in at most n partitions of similar
+// sizes, at data file boundaries. A namespace with a single data file is not split.
+func (c *Client) Partitions(ctx context.Context, namespace string, n int) ([]Partition, error) {
+	if namespace == "" {
+		namespace = "default"
+	}
+
+	info, err := c.NamespaceStats(ctx, namespace)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get namespace info: %w", err)
+	}
+
+	current, err := strconv.ParseUint(info["data_current_id"], 10, 32)
+	if err != nil {
+		return nil, fmt.Errorf("invalid current data file id %q: %w", info["data_current_id"], err)
+	}
+
+	files := int(current) + 1
+	partitions := []Partition{{}}
+	prevFile := 0
+	for p := 1; p < n; p++ {
+		file := p * files / n
+		if file <= prevFile {
+			continue
+		}
+		prevFile = file
+
+		key, ok, err := c.boundaryKey(ctx, uint32(file))
+		if err != nil {
+			return nil, err
+		}
+
+		if !ok {
+			continue
+		}
+
+		cursor, err := c.KeyCursor(ctx, key)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get cursor of key %x: %w", key, err)
+		}
+
+		partitions[len(partitions)-1].Last = key
+		partitions = append(partitions, Partition{Start: cursor})
+	}
+
+	return partitions, nil
+}
+
+// boundaryKey returns a key whose current value is written in the data file, among the
+// first entries of the file.
+func (c *Client) boundaryKey(ctx context.Context, file uint32) (string, bool, error) {
+	offset := uint32(DataHeaderSize)
+	for i := 0; i < maxBoundaryProbes; i++ {
+		raw, err := c.DataRaw(ctx, file, offset)
+		if errors.Is(err, ErrNoDataEntry) {
+			return "", false, nil
+		}
+		if err != nil {
+			return "", false, fmt.Errorf("failed to read data file %d at offset %d: %w", file, offset, err)
+		}
+		offset += raw.Size()
+
+		if raw.Deleted() {
+			continue
+		}
+
+		live, err := c.isCurrent(ctx, raw)
+		if err != nil {
+			return "", false, err
+		}
+
+		if live {
+			return raw.Key, true, nil
+		}
+	}
+
+	return "", false, nil
+}
+
+// isCurrent reports whether the entry holds the current value of its key. A key set back to a
+// previous value within the same second can't be told apart, its partitions then overlap and
+// some keys are returned twice.
+func (c *Client) isCurrent(ctx context.Context, raw RawEntry) (bool, error) {
+	ts, err := c.KeyTime(ctx, raw.Key)
+	if errors.Is(err, ErrKeyNotFound) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	if ts != raw.Timestamp {
+		return false, nil
+	}
+
+	value, err := c.Get(ctx, raw.Key)
+	if errors.Is(err, ErrNil) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	return value == raw.Payload, nil
+}
+
+// ParallelScan scans a namespace in partitions, each one over its own connection, and calls
+// fn with every key. fn is called concurrently from the partitions, in scan order within a
+// partition. The scan stops at the first error, returned by fn or a partition.
+//
+// Like a sequential scan, keys written during the scan may be returned twice or not at all.
+// The scan fails with ErrBoundaryMoved if the last key of a partition is written or deleted
+// before the partition reaches it, instead of scanning the following partitions again.
+func ParallelScan(ctx context.Context, address string, opts ParallelScanOptions, fn func(ScanItem) error) error {
+	if opts.Partitions <= 0 {
+		opts.Partitions = DefaultPartitions
+	}
+
+	clientOpts := redis.Options{Addr: address, PoolSize: 1}
+
+	setup, err := dial(ctx, clientOpts, opts.Namespace, opts.Password)
+	if err != nil {
+		return err
+	}
+
+	partitions, err := setup.Partitions(ctx, opts.Namespace, opts.Partitions)
+	setup.Close()
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var (
+		wg       sync.WaitGroup
+		errOnce  sync.Once
+		firstErr error
+	)
+
+	for idx, partition := range partitions {
+		// the cursor of the last key of a partition is the start of the next one
+		end := ""
+		if idx+1 < len(partitions) {
+			end = partitions[idx+1].Start
+		}
+
+		wg.Add(1)
+		go func(idx int, partition Partition) {
+			defer wg.Done()
+
+			err := scanPartition(ctx, clientOpts, opts, idx, partition, end, fn)
+			if err != nil {
+				errOnce.Do(func() {
+					firstErr = err
+					cancel()
+				})
+			}
+		}(idx, partition)
+	}
+
+	wg.Wait()
+
+	return firstErr
+}
+
+// scanPartition scans a partition, whose last key had the end cursor when the partitions were
+// computed.
+func scanPartition(ctx context.Context, clientOpts redis.Options, opts ParallelScanOptions, idx int, partition Partition, end string, fn func(ScanItem) error) error {
+	client, err := dial(ctx, clientOpts, opts.Namespace, opts.Password)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	s := client.NewScanner(ctx, ScanOptions{Cursor: partition.Start})
+	for s.Next() {
+		// a page read while the last key did not move ends at the last key, or before it
+		if partition.Last != "" && s.idx == 0 {
+			if err := checkBoundary(ctx, client, partition.Last, end); err != nil {
+				return err
+			}
+		}
+
+		key := s.Key()
+		if err := fn(ScanItem{Partition: idx, Key: key, Value: s.lazyValue(key.Key)}); err != nil {
+			return err
+		}
+
+		if partition.Last != "" && key.Key == partition.Last {
+			return nil
+		}
+	}
+
+	return s.Err()
+}
+
+// checkBoundary fails with ErrBoundaryMoved if the last key of a partition does not have the
+// cursor it had when the partitions were computed.
+func checkBoundary(ctx context.Context, client *Client, last, end string) error {
+	cursor, err := client.KeyCursor(ctx, last)
+	if errors.Is(err, ErrKeyNotFound) {
+		return fmt.Errorf("%w: key %x was deleted", ErrBoundaryMoved, last)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to get cursor of key %x: %w", last, err)
+	}
+
+	if cursor != end {
+		return fmt.Errorf("%w: key %x was written", ErrBoundaryMoved, last)
+	}
+
+	return nil
+}
@@ -0,0 +1,129 @@
+package zdb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParallelScan(t *testing.T) {
+	client, server := newTestClient(t)
+	server.PageSize = 5
+	ctx := context.Background()
+
+	want := []string{}
+	for i := 0; i < 100; i++ {
+		key := fmt.Sprintf("key-%02d", i)
+		want = append(want, key)
+		require.NoError(t, client.Set(ctx, key, "value"))
+	}
+
+	// the first entries of the second data file are not current anymore
+	require.NoError(t, client.Set(ctx, "key-16", "other"))
+	require.NoError(t, client.Delete(ctx, "key-17"))
+	want = append(want[:17], want[18:]...)
+
+	partitions, err := client.Partitions(ctx, "", 4)
+	require.NoError(t, err)
+	require.Len(t, partitions, 4)
+	assert.Equal(t, "key-18", partitions[0].Last)
+	assert.Empty(t, partitions[3].Last)
+
+	var (
+		mu   sync.Mutex
+		got  []string
+		used = map[int]bool{}
+	)
+	err = ParallelScan(ctx, server.Addr(), ParallelScanOptions{Partitions: 4}, func(item ScanItem) error {
+		value, err := item.Value()
+		if err != nil {
+			return err
+		}
+
+		mu.Lock()
+		defer mu.Unlock()
+
+		got = append(got, item.Key.Key)
+		used[item.Partition] = true
+		if item.Key.Key == "key-16" && value != "other" {
+			return fmt.Errorf("unexpected value %q", value)
+		}
+
+		return nil
+	})
+	require.NoError(t, err)
+
+	sort.Strings(got)
+	assert.Equal(t, want, got)
+	assert.Len(t, used, 4)
+
+	failure := errors.New("failure")
+	err = ParallelScan(ctx, server.Addr(), ParallelScanOptions{}, func(item ScanItem) error {
+		return failure
+	})
+	assert.ErrorIs(t, err, failure)
+}
+
+func TestParallelScanSmallNamespace(t *testing.T) {
+	client, server := newTestClient(t)
+	ctx := context.Background()
+
+	require.NoError(t, client.Set(ctx, "key", "value"))
+
+	partitions, err := client.Partitions(ctx, "default", 8)
+	require.NoError(t, err)
+	assert.Equal(t, []Partition{{}}, partitions)
+
+	count := 0
+	err = ParallelScan(ctx, server.Addr(), ParallelScanOptions{Partitions: 8}, func(item ScanItem) error {
+		count++
+		return nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, 1, count)
+}
+
+func TestParallelScanBoundaryMoved(t *testing.T) {
+	client, server := newTestClient(t)
+	server.PageSize = 5
+	ctx := context.Background()
+
+	for i := 0; i < 100; i++ {
+		require.NoError(t, client.Set(ctx, fmt.Sprintf("key-%02d", i), "value"))
+	}
+
+	partitions, err := client.Partitions(ctx, "", 4)
+	require.NoError(t, err)
+	require.Len(t, partitions, 4)
+	boundary := partitions[0].Last
+
+	var (
+		mu   sync.Mutex
+		seen = map[string]int{}
+	)
+	err = ParallelScan(ctx, server.Addr(), ParallelScanOptions{Partitions: 4}, func(item ScanItem) error {
+		mu.Lock()
+		defer mu.Unlock()
+
+		seen[item.Key.Key]++
+
+		// the boundary moves to the end of the namespace while the first partition is scanned
+		if item.Partition == 0 && item.Key.Key == "key-00" {
+			return client.Set(ctx, boundary, "other")
+		}
+
+		return nil
+	})
+	assert.ErrorIs(t, err, ErrBoundaryMoved)
+
+	// the first partition stopped instead of scanning the next ones again
+	for key, count := range seen {
+		assert.Equal(t, 1, count, key)
+	}
+}
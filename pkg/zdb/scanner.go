@@ -0,0 +1,205 @@
+package zdb
+
+import (
+	"context"
+	"errors"
+)
+
+// ScanOptions configures a Scanner.
+type ScanOptions struct {
+	// Reverse scans from the last key to the first.
+	Reverse bool
+	// Cursor starts the scan after the key of a cursor, as returned by Scanner.Cursor or
+	// KeyCursor. The scan starts from the first key, or the last one in reverse, if empty.
+	Cursor string
+	// Limit is the maximum number of keys returned, zero means no limit.
+	Limit int
+}
+
+// LazyValue fetches the value of a scanned key when called. It returns ErrNil if the key
+// was deleted since it was scanned.
+type LazyValue func() (string, error)
+
+// Scanner walks the keys of the selected namespace page by page.
+//
+//	s := client.NewScanner(ctx, zdb.ScanOptions{})
+//	for s.Next() {
+//		info := s.Key()
+//	}
+//	if err := s.Err(); err != nil {
+//		...
+//	}
+type Scanner struct {
+	ctx    context.Context
+	client *Client
+	opts   ScanOptions
+
+	// page is the current scan page, and idx the position of the current key in it.
+	page ScanResponse
+	idx  int
+	// pageCursor is the cursor page was fetched after.
+	pageCursor string
+	fetched    bool
+	// cursor is the resolved cursor of the current key, if any.
+	cursor   string
+	resolved bool
+
+	returned int
+	done     bool
+	err      error
+}
+
+// NewScanner returns a scanner of the selected namespace. The context is used for every
+// command sent by the scanner.
+func (c *Client) NewScanner(ctx context.Context, opts ScanOptions) *Scanner {
+	return &Scanner{
+		ctx:        ctx,
+		client:     c,
+		opts:       opts,
+		idx:        -1,
+		pageCursor: opts.Cursor,
+		cursor:     opts.Cursor,
+		resolved:   true,
+	}
+}
+
+// Next moves the scanner to the next key, and returns false once the scan is over, because
+// every key was returned, the limit was reached, or an error occurred.
+func (s *Scanner) Next() bool {
+	if s.done {
+		return false
+	}
+
+	if s.opts.Limit > 0 && s.returned >= s.opts.Limit {
+		s.done = true
+		return false
+	}
+
+	if err := s.ctx.Err(); err != nil {
+		s.fail(err)
+		return false
+	}
+
+	for s.idx+1 >= len(s.page.Keys) {
+		if !s.fetch() {
+			return false
+		}
+	}
+
+	s.idx++
+	s.returned++
+	s.resolved = false
+	if s.idx == len(s.page.Keys)-1 {
+		s.cursor = s.page.Next
+		s.resolved = true
+	}
+
+	return true
+}
+
+// fetch reads the page after the current one.
+func (s *Scanner) fetch() bool {
+	cursor := s.opts.Cursor
+	if s.fetched {
+		cursor = s.page.Next
+	}
+
+	res, err := s.scan(cursor)
+	if errors.Is(err, ErrCursorNoMoreData) {
+		s.done = true
+		return false
+	}
+	if err != nil {
+		s.fail(err)
+		return false
+	}
+
+	// an empty page that doesn't move the cursor would be read again forever
+	if len(res.Keys) == 0 && (res.Next == "" || res.Next == cursor) {
+		s.done = true
+		return false
+	}
+
+	s.fetched = true
+	s.pageCursor = cursor
+	s.page = res
+	s.idx = -1
+
+	return true
+}
+
+func (s *Scanner) scan(cursor string) (ScanResponse, error) {
+	switch {
+	case !s.opts.Reverse && cursor == "":
+		return s.client.Scan(s.ctx)
+	case !s.opts.Reverse:
+		return s.client.ScanCursor(s.ctx, cursor)
+	case cursor == "":
+		return s.client.RScan(s.ctx)
+	default:
+		return s.client.RScanCursor(s.ctx, cursor)
+	}
+}
+
+func (s *Scanner) fail(err error) {
+	s.err = err
+	s.done = true
+}
+
+// Key returns the information of the current key.
+func (s *Scanner) Key() KeyInfo {
+	if s.idx < 0 || s.idx >= len(s.page.Keys) {
+		return KeyInfo{}
+	}
+
+	return s.page.Keys[s.idx]
+}
+
+// Value fetches the value of the current key.
+func (s *Scanner) Value() (string, error) {
+	return s.lazyValue(s.Key().Key)()
+}
+
+// lazyValue returns a LazyValue of the key, which stays valid once the scanner moved on.
+func (s *Scanner) lazyValue(key string) LazyValue {
+	var (
+		value   string
+		err     error
+		fetched bool
+	)
+
+	return func() (string, error) {
+		if !fetched {
+			value, err = s.client.Get(s.ctx, key)
+			fetched = true
+		}
+
+		return value, err
+	}
+}
+
+// Err returns the error which stopped the scan, if any. Reaching the end of the namespace
+// is not an error.
+func (s *Scanner) Err() error {
+	return s.err
+}
+
+// Cursor returns the cursor to resume the scan after the last key returned by Next, with
+// ScanOptions.Cursor. When the scan stopped in the middle of a page, the cursor of the key is
+// fetched with KeyCursor. If that fails, because the key was deleted meanwhile, the cursor
+// the page was read after is returned, so the keys before it in the page are returned again.
+func (s *Scanner) Cursor() string {
+	if s.resolved {
+		return s.cursor
+	}
+
+	cursor, err := s.client.KeyCursor(s.ctx, s.Key().Key)
+	if err != nil {
+		return s.pageCursor
+	}
+
+	s.cursor = cursor
+	s.resolved = true
+
+	return cursor
+}
@@ -0,0 +1,23 @@
+//go:build go1.23
+
+package zdb
+
+import "iter"
+
+// All returns an iterator over the remaining keys of the scanner, with a function fetching
+// the value of each key when called. Scanner.Err reports the error which stopped the
+// iteration, if any.
+//
+//	for info, value := range client.NewScanner(ctx, zdb.ScanOptions{}).All() {
+//		v, err := value()
+//	}
+func (s *Scanner) All() iter.Seq2[KeyInfo, LazyValue] {
+	return func(yield func(KeyInfo, LazyValue) bool) {
+		for s.Next() {
+			info := s.Key()
+			if !yield(info, s.lazyValue(info.Key)) {
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,51 @@
+//go:build go1.23
+
+package zdb
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestScannerAll(t *testing.T) {
+	client, server := newTestClient(t)
+	server.PageSize = 2
+	ctx := context.Background()
+
+	for _, key := range []string{"a", "b", "c", "d"} {
+		require.NoError(t, client.Set(ctx, key, "value-"+key))
+	}
+
+	values := []LazyValue{}
+	keys := []string{}
+	s := client.NewScanner(ctx, ScanOptions{})
+	for info, value := range s.All() {
+		keys = append(keys, info.Key)
+		values = append(values, value)
+
+		if info.Key == "c" {
+			break
+		}
+	}
+	require.NoError(t, s.Err())
+	assert.Equal(t, []string{"a", "b", "c"}, keys)
+
+	require.NoError(t, client.Delete(ctx, "b"))
+
+	// values are fetched when called, even after the scanner moved on
+	value, err := values[0]()
+	require.NoError(t, err)
+	assert.Equal(t, "value-a", value)
+
+	_, err = values[1]()
+	assert.ErrorIs(t, err, ErrNil)
+
+	rest := []string{}
+	for info := range client.NewScanner(ctx, ScanOptions{Cursor: s.Cursor()}).All() {
+		rest = append(rest, info.Key)
+	}
+	assert.Equal(t, []string{"d"}, rest)
+}
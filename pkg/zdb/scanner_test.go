@@ -0,0 +1,77 @@
+package zdb
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func scanAll(t *testing.T, s *Scanner) []string {
+	t.Helper()
+
+	keys := []string{}
+	for s.Next() {
+		keys = append(keys, s.Key().Key)
+	}
+	require.NoError(t, s.Err())
+
+	return keys
+}
+
+func TestScanner(t *testing.T) {
+	client, server := newTestClient(t)
+	server.PageSize = 3
+	ctx := context.Background()
+
+	want := []string{}
+	for i := 0; i < 10; i++ {
+		key := fmt.Sprintf("key-%d", i)
+		want = append(want, key)
+		require.NoError(t, client.Set(ctx, key, "value-"+key))
+	}
+
+	assert.Equal(t, want, scanAll(t, client.NewScanner(ctx, ScanOptions{})))
+
+	reversed := scanAll(t, client.NewScanner(ctx, ScanOptions{Reverse: true}))
+	require.Len(t, reversed, 10)
+	assert.Equal(t, want[9], reversed[0])
+	assert.Equal(t, want[0], reversed[9])
+
+	// a limited scan stopping in the middle of a page resumes after its last key
+	s := client.NewScanner(ctx, ScanOptions{Limit: 4})
+	assert.Equal(t, want[:4], scanAll(t, s))
+
+	s = client.NewScanner(ctx, ScanOptions{Cursor: s.Cursor(), Limit: 2})
+	assert.Equal(t, want[4:6], scanAll(t, s))
+
+	// a scan stopping at the end of a page resumes from the page cursor
+	s = client.NewScanner(ctx, ScanOptions{Cursor: s.Cursor()})
+	assert.Equal(t, want[6:], scanAll(t, s))
+
+	require.NoError(t, client.Set(ctx, "key-10", "value"))
+	s = client.NewScanner(ctx, ScanOptions{Cursor: s.Cursor()})
+	assert.Equal(t, []string{"key-10"}, scanAll(t, s))
+
+	s = client.NewScanner(ctx, ScanOptions{})
+	require.True(t, s.Next())
+	value, err := s.Value()
+	require.NoError(t, err)
+	assert.Equal(t, "value-key-0", value)
+}
+
+func TestScannerCanceled(t *testing.T) {
+	client, _ := newTestClient(t)
+	ctx, cancel := context.WithCancel(context.Background())
+
+	require.NoError(t, client.Set(ctx, "key", "value"))
+
+	s := client.NewScanner(ctx, ScanOptions{})
+	require.True(t, s.Next())
+
+	cancel()
+	assert.False(t, s.Next())
+	assert.ErrorIs(t, s.Err(), context.Canceled)
+}
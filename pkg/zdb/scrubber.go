@@ -0,0 +1,162 @@
+package zdb
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"time"
+)
+
+// ScrubberOptions configures a Scrubber.
+type ScrubberOptions struct {
+	// Rate is the maximum number of keys checked per second, zero means no limit.
+	Rate int
+	// Cursor resumes the scrub after the key of a previously saved cursor.
+	Cursor string
+	// OnCorrupt is called for every key failing the integrity check.
+	OnCorrupt func(key KeyInfo)
+	// OnCheckpoint is called with the cursor of the last checked key after every scanned page,
+	// so a scrub can be resumed with ScrubberOptions.Cursor.
+	OnCheckpoint func(cursor string)
+}
+
+// ScrubberStats holds the counters of a Scrubber.
+type ScrubberStats struct {
+	Checked   uint64
+	Corrupted uint64
+	Skipped   uint64
+	Passes    uint64
+	Cursor    string
+}
+
+// Scrubber walks the selected namespace and verifies the checksum of every key with CHECKS,
+// so corrupted data is found before it is served.
+type Scrubber struct {
+	client *Client
+	opts   ScrubberOptions
+
+	checked   atomic.Uint64
+	corrupted atomic.Uint64
+	skipped   atomic.Uint64
+	passes    atomic.Uint64
+	cursor    atomic.Value
+}
+
+func NewScrubber(client *Client, opts ScrubberOptions) *Scrubber {
+	s := &Scrubber{
+		client: client,
+		opts:   opts,
+	}
+	s.cursor.Store(opts.Cursor)
+
+	return s
+}
+
+// Stats returns the counters of the scrubber.
+func (s *Scrubber) Stats() ScrubberStats {
+	return ScrubberStats{
+		Checked:   s.checked.Load(),
+		Corrupted: s.corrupted.Load(),
+		Skipped:   s.skipped.Load(),
+		Passes:    s.passes.Load(),
+		Cursor:    s.cursor.Load().(string),
+	}
+}
+
+// Run checks every key from the current cursor to the end of the namespace. Once a pass is
+// complete, the cursor is reset so the next run starts from the first key.
+func (s *Scrubber) Run(ctx context.Context) error {
+	var tick <-chan time.Time
+	if s.opts.Rate > 0 {
+		ticker := time.NewTicker(time.Second / time.Duration(s.opts.Rate))
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+
+	for {
+		cursor := s.cursor.Load().(string)
+
+		res, err := s.scan(ctx, cursor)
+		if errors.Is(err, ErrCursorNoMoreData) {
+			s.passes.Add(1)
+			s.checkpoint("")
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		for _, key := range res.Keys {
+			if tick != nil {
+				select {
+				case <-ctx.Done():
+					return ctx.Err()
+				case <-tick:
+				}
+			}
+
+			if err := s.check(ctx, key); err != nil {
+				return err
+			}
+		}
+
+		s.checkpoint(res.Next)
+	}
+}
+
+// RunEvery runs a scrub pass every interval until the context is canceled.
+func (s *Scrubber) RunEvery(ctx context.Context, interval time.Duration) error {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if err := s.Run(ctx); err != nil {
+			return err
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+func (s *Scrubber) scan(ctx context.Context, cursor string) (ScanResponse, error) {
+	if cursor == "" {
+		return s.client.Scan(ctx)
+	}
+
+	return s.client.ScanCursor(ctx, cursor)
+}
+
+func (s *Scrubber) check(ctx context.Context, key KeyInfo) error {
+	ok, err := s.client.Check(ctx, key.Key)
+	if errors.Is(err, ErrKeyNotFound) {
+		// deleted since it was scanned
+		s.skipped.Add(1)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	s.checked.Add(1)
+	if ok {
+		return nil
+	}
+
+	s.corrupted.Add(1)
+	if s.opts.OnCorrupt != nil {
+		s.opts.OnCorrupt(key)
+	}
+
+	return nil
+}
+
+func (s *Scrubber) checkpoint(cursor string) {
+	s.cursor.Store(cursor)
+	if s.opts.OnCheckpoint != nil {
+		s.opts.OnCheckpoint(cursor)
+	}
+}
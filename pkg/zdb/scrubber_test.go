@@ -0,0 +1,77 @@
+package zdb
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/mariobassem/tendermint-zdb/pkg/zdb/zdbtest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestClient(t *testing.T) (*Client, *zdbtest.Server) {
+	t.Helper()
+
+	server, err := zdbtest.NewServer()
+	require.NoError(t, err)
+	t.Cleanup(func() { server.Close() })
+
+	client := NewClient(server.Addr())
+	t.Cleanup(func() { client.Close() })
+
+	return &client, server
+}
+
+func TestScrubber(t *testing.T) {
+	client, server := newTestClient(t)
+	ctx := context.Background()
+
+	for i := 0; i < 20; i++ {
+		require.NoError(t, client.Set(ctx, fmt.Sprintf("k%d", i), "v"))
+	}
+	require.NoError(t, server.Corrupt("default", "k3"))
+	require.NoError(t, server.Corrupt("default", "k17"))
+
+	corrupted := []string{}
+	checkpoints := 0
+	scrubber := NewScrubber(client, ScrubberOptions{
+		Rate:         1000,
+		OnCorrupt:    func(key KeyInfo) { corrupted = append(corrupted, key.Key) },
+		OnCheckpoint: func(cursor string) { checkpoints++ },
+	})
+
+	assert.NoError(t, scrubber.Run(ctx))
+	assert.Equal(t, []string{"k3", "k17"}, corrupted)
+	assert.Greater(t, checkpoints, 1)
+
+	stats := scrubber.Stats()
+	assert.Equal(t, uint64(20), stats.Checked)
+	assert.Equal(t, uint64(2), stats.Corrupted)
+	assert.Equal(t, uint64(1), stats.Passes)
+	assert.Equal(t, "", stats.Cursor)
+}
+
+func TestScrubberResume(t *testing.T) {
+	client, server := newTestClient(t)
+	ctx := context.Background()
+
+	for i := 0; i < 10; i++ {
+		require.NoError(t, client.Set(ctx, fmt.Sprintf("k%d", i), "v"))
+	}
+	require.NoError(t, server.Corrupt("default", "k2"))
+	require.NoError(t, server.Corrupt("default", "k8"))
+
+	cursor, err := client.KeyCursor(ctx, "k4")
+	require.NoError(t, err)
+
+	corrupted := []string{}
+	scrubber := NewScrubber(client, ScrubberOptions{
+		Cursor:    cursor,
+		OnCorrupt: func(key KeyInfo) { corrupted = append(corrupted, key.Key) },
+	})
+
+	assert.NoError(t, scrubber.Run(ctx))
+	assert.Equal(t, []string{"k8"}, corrupted)
+	assert.Equal(t, uint64(5), scrubber.Stats().Checked)
+}
@@ -0,0 +1,235 @@
+package zdb
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	// AllCommands makes a subscription report every command.
+	AllCommands = "*"
+
+	DefaultWaitTimeout      = 5 * time.Second
+	DefaultReconnectBackoff = 100 * time.Millisecond
+	DefaultMaxBackoff       = 10 * time.Second
+)
+
+// Event is a command run on the server, as reported by WAIT.
+type Event struct {
+	// Command is the name of the command, empty for Reconnected events.
+	Command   string
+	Namespace string
+	// Key is the key the command ran on, when the server reports it.
+	Key  string
+	Time time.Time
+	// Reconnected is set on the event sent after the connection was lost and established
+	// again. Commands run meanwhile were missed, so caches should be invalidated.
+	Reconnected bool
+}
+
+// SubscribeOptions configures a subscription.
+type SubscribeOptions struct {
+	// Namespace is the namespace the commands are watched on, the default one if empty.
+	Namespace string
+	Password  string
+	// Commands are the names of the watched commands, every command if empty.
+	Commands []string
+	// WaitTimeout is the timeout of every WAIT call, a new one is sent once it expires.
+	WaitTimeout time.Duration
+	// ReconnectBackoff is the time waited before the first reconnection attempt, it doubles
+	// with every failed attempt up to MaxBackoff.
+	ReconnectBackoff time.Duration
+	MaxBackoff       time.Duration
+	// Buffer is the capacity of the events channel.
+	Buffer int
+	// OnError is called with connection errors, before reconnecting.
+	OnError func(error)
+}
+
+// Subscribe watches commands run by other clients on a namespace, and sends them to the
+// returned channel until the context is canceled, then closes it. Every watched command uses a
+// dedicated connection, which is established again when lost.
+//
+// WAIT reports the commands run while it is blocked, so commands run between two calls, or
+// faster than the events are read, may be missed.
+func Subscribe(ctx context.Context, address string, opts SubscribeOptions) (<-chan Event, error) {
+	if opts.WaitTimeout <= 0 {
+		opts.WaitTimeout = DefaultWaitTimeout
+	}
+
+	if opts.ReconnectBackoff <= 0 {
+		opts.ReconnectBackoff = DefaultReconnectBackoff
+	}
+
+	if opts.MaxBackoff <= 0 {
+		opts.MaxBackoff = DefaultMaxBackoff
+	}
+
+	commands := opts.Commands
+	if len(commands) == 0 {
+		commands = []string{AllCommands}
+	}
+
+	subs := make([]*subscription, 0, len(commands))
+	for _, cmd := range commands {
+		sub := &subscription{address: address, command: strings.ToUpper(cmd), opts: opts}
+
+		// the first connection is made synchronously, so a bad address or password fails now
+		if err := sub.connect(ctx); err != nil {
+			for _, s := range subs {
+				s.client.Close()
+			}
+
+			return nil, err
+		}
+
+		subs = append(subs, sub)
+	}
+
+	events := make(chan Event, opts.Buffer)
+
+	var wg sync.WaitGroup
+	for _, sub := range subs {
+		wg.Add(1)
+		go func(sub *subscription) {
+			defer wg.Done()
+			sub.run(ctx, events)
+		}(sub)
+	}
+
+	go func() {
+		wg.Wait()
+		close(events)
+	}()
+
+	return events, nil
+}
+
+type subscription struct {
+	address string
+	command string
+	opts    SubscribeOptions
+	client  *redis.Client
+}
+
+// connect opens the dedicated connection of the subscription, and selects the namespace.
+func (s *subscription) connect(ctx context.Context) error {
+	client, err := dial(ctx, redis.Options{
+		Addr:     s.address,
+		PoolSize: 1,
+		// WAIT blocks for up to its timeout
+		ReadTimeout: s.opts.WaitTimeout + time.Second,
+		MaxRetries:  -1,
+	}, s.opts.Namespace, s.opts.Password)
+	if err != nil {
+		return err
+	}
+
+	s.client = client.cl
+
+	return nil
+}
+
+func (s *subscription) run(ctx context.Context, events chan<- Event) {
+	stop := s.closeOnCancel(ctx)
+	defer func() {
+		if stop() {
+			s.client.Close()
+		}
+	}()
+
+	for {
+		reply, err := s.client.Do(ctx, "WAIT", s.command, s.opts.WaitTimeout.Milliseconds()).Text()
+		if ctx.Err() != nil {
+			return
+		}
+
+		if errors.Is(err, ErrTimeout) {
+			continue
+		}
+
+		if err != nil {
+			if s.opts.OnError != nil {
+				s.opts.OnError(err)
+			}
+
+			if !s.reconnect(ctx) {
+				return
+			}
+
+			stop()
+			stop = s.closeOnCancel(ctx)
+
+			if !send(ctx, events, Event{Namespace: s.opts.Namespace, Time: time.Now(), Reconnected: true}) {
+				return
+			}
+
+			continue
+		}
+
+		command, key, _ := strings.Cut(reply, " ")
+		event := Event{
+			Command:   command,
+			Namespace: s.opts.Namespace,
+			Key:       key,
+			Time:      time.Now(),
+		}
+
+		if !send(ctx, events, event) {
+			return
+		}
+	}
+}
+
+// closeOnCancel closes the current client once the context is canceled, which unblocks a
+// pending WAIT. The client is captured, as reconnect replaces it while the context may be
+// canceled.
+func (s *subscription) closeOnCancel(ctx context.Context) (stop func() bool) {
+	client := s.client
+
+	return context.AfterFunc(ctx, func() { client.Close() })
+}
+
+// reconnect replaces the client with a new connection, and retries with a growing backoff
+// until it succeeds or the context is canceled.
+func (s *subscription) reconnect(ctx context.Context) bool {
+	s.client.Close()
+
+	backoff := s.opts.ReconnectBackoff
+	for {
+		select {
+		case <-ctx.Done():
+			return false
+		case <-time.After(backoff):
+		}
+
+		err := s.connect(ctx)
+		if err == nil {
+			return true
+		}
+
+		if ctx.Err() != nil {
+			return false
+		}
+
+		if s.opts.OnError != nil {
+			s.opts.OnError(err)
+		}
+
+		backoff = min(backoff*2, s.opts.MaxBackoff)
+	}
+}
+
+func send(ctx context.Context, events chan<- Event, e Event) bool {
+	select {
+	case events <- e:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
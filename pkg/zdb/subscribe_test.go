@@ -0,0 +1,104 @@
+package zdb
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func receive(t *testing.T, events <-chan Event) Event {
+	t.Helper()
+
+	select {
+	case e, ok := <-events:
+		require.True(t, ok, "events channel closed")
+		return e
+	case <-time.After(2 * time.Second):
+		require.FailNow(t, "no event received")
+		return Event{}
+	}
+}
+
+func TestSubscribe(t *testing.T) {
+	client, server := newTestClient(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	require.NoError(t, client.NewNamespace(ctx, "watched"))
+	require.NoError(t, client.Select(ctx, "watched"))
+
+	events, err := Subscribe(ctx, server.Addr(), SubscribeOptions{
+		Namespace:   "watched",
+		Commands:    []string{"set"},
+		WaitTimeout: 50 * time.Millisecond,
+	})
+	require.NoError(t, err)
+
+	// the subscription has to be blocked on WAIT before the write is made
+	go func() {
+		for ctx.Err() == nil {
+			_ = client.Set(ctx, "key", "value")
+			time.Sleep(20 * time.Millisecond)
+		}
+	}()
+
+	e := receive(t, events)
+	assert.Equal(t, "SET", e.Command)
+	assert.Equal(t, "watched", e.Namespace)
+	assert.False(t, e.Reconnected)
+
+	cancel()
+	for range events {
+	}
+}
+
+func TestSubscribeReconnect(t *testing.T) {
+	client, server := newTestClient(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	errs := make(chan error, 10)
+	events, err := Subscribe(ctx, server.Addr(), SubscribeOptions{
+		WaitTimeout:      50 * time.Millisecond,
+		ReconnectBackoff: 10 * time.Millisecond,
+		MaxBackoff:       50 * time.Millisecond,
+		OnError: func(err error) {
+			select {
+			case errs <- err:
+			default:
+			}
+		},
+	})
+	require.NoError(t, err)
+
+	require.NoError(t, server.Close())
+	require.NoError(t, server.Restart())
+
+	e := receive(t, events)
+	assert.True(t, e.Reconnected)
+	assert.NotEmpty(t, errs)
+
+	go func() {
+		for ctx.Err() == nil {
+			_ = client.Set(ctx, "key", "value")
+			time.Sleep(20 * time.Millisecond)
+		}
+	}()
+
+	e = receive(t, events)
+	assert.Equal(t, "SET", e.Command)
+
+	cancel()
+	for range events {
+	}
+}
+
+func TestSubscribeFailure(t *testing.T) {
+	_, server := newTestClient(t)
+
+	_, err := Subscribe(context.Background(), server.Addr(), SubscribeOptions{Namespace: "missing"})
+	assert.Error(t, err)
+}
@@ -5,13 +5,18 @@ import (
 	"crypto/sha1"
 	"errors"
 	"fmt"
+	"log/slog"
 	"strings"
+	"time"
 
+	"github.com/mariobassem/tendermint-zdb/pkg/internal/reply"
 	"github.com/redis/go-redis/v9"
 )
 
 type Client struct {
 	cl *redis.Client
+	// pooled is set when the client has more than one connection, it can't select a namespace.
+	pooled bool
 }
 
 type KeyInfo struct {
@@ -25,18 +30,65 @@ type ScanResponse struct {
 	Keys []KeyInfo
 }
 
+type HistoryEntry struct {
+	Timestamp int64
+	// Previous is the reference of the previous value of the key, to read it with
+	// HistoryWithData, or empty for its first value. It is not a key cursor.
+	Previous string
+	Value    string
+}
+
 var (
-	ErrCursorNoMoreData = errors.New("No more data")
-	ErrNil              = redis.Nil
+	ErrNoDataEntry  = errors.New("no data entry at this offset")
+	ErrNil          = redis.Nil
+	ErrPooledSelect = errors.New("namespaces can't be selected by a client with several connections")
 )
 
-func NewClient(address string) Client {
-	client := redis.NewClient(&redis.Options{
-		Addr: address,
-	})
+// Option configures a Client.
+type Option func(*clientOptions)
+
+type clientOptions struct {
+	redis   redis.Options
+	logger  *slog.Logger
+	logKeys bool
+	breaker *CircuitBreaker
+}
+
+// WithPoolSize sets the number of connections of the client, one by default, or the default
+// of go-redis if zero. Namespaces are selected per connection, so a client with more
+// connections stays on the default namespace, and Select and SelectSecure fail with
+// ErrPooledSelect.
+func WithPoolSize(n int) Option {
+	return func(o *clientOptions) {
+		o.redis.PoolSize = n
+	}
+}
+
+func NewClient(address string, opts ...Option) Client {
+	o := clientOptions{
+		redis: redis.Options{
+			Addr: address,
+			// namespaces are selected per connection, so all commands must use the same one
+			PoolSize: 1,
+		},
+	}
+
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	cl := newRedisClient(&o.redis)
+	if o.logger != nil {
+		cl.AddHook(&logHook{logger: o.logger, logKeys: o.logKeys})
+	}
+
+	if o.breaker != nil {
+		cl.AddHook(breakerHook{breaker: o.breaker})
+	}
 
 	return Client{
-		cl: client,
+		cl:     cl,
+		pooled: o.redis.PoolSize != 1,
 	}
 }
 
@@ -126,22 +178,7 @@ func (c *Client) Info(ctx context.Context) (map[string]string, error) {
 		return nil, err
 	}
 
-	return parseInfoResponse(res)
-}
-
-func parseInfoResponse(res string) (map[string]string, error) {
-	slice := strings.Split(res, "\n")
-	parsed := make(map[string]string, len(slice))
-	for _, s := range slice {
-		key, value, found := strings.Cut(s, ":")
-		if !found {
-			continue
-		}
-
-		parsed[key] = strings.Trim(value, " \r\n")
-	}
-
-	return parsed, nil
+	return reply.Info(res), nil
 }
 
 func (c *Client) NewNamespace(ctx context.Context, ns string) error {
@@ -163,22 +200,26 @@ func (c *Client) NamespaceInfo(ctx context.Context, ns string) (string, error) {
 		return "", err
 	}
 
-	return res.(string), nil
+	return reply.String(res, "namespace info")
 }
 
-func (c *Client) ListNamespaces(ctx context.Context) ([]string, error) {
-	res, err := c.cl.Do(ctx, "NSLIST").Result()
+// NamespaceStats returns the fields of the namespace information.
+func (c *Client) NamespaceStats(ctx context.Context, ns string) (map[string]string, error) {
+	res, err := c.NamespaceInfo(ctx, ns)
 	if err != nil {
 		return nil, err
 	}
 
-	namespaces := res.([]interface{})
-	ret := make([]string, 0, len(namespaces))
-	for _, ns := range namespaces {
-		ret = append(ret, ns.(string))
+	return reply.Info(res), nil
+}
+
+func (c *Client) ListNamespaces(ctx context.Context) ([]string, error) {
+	res, err := c.cl.Do(ctx, "NSLIST").Result()
+	if err != nil {
+		return nil, err
 	}
 
-	return ret, nil
+	return reply.Strings(res, "namespace")
 }
 
 func (c *Client) SetNamespace(ctx context.Context, ns string, property string, val string) error {
@@ -200,6 +241,10 @@ func (c *Client) JumpNamespace(ctx context.Context) error {
 }
 
 func (c *Client) Select(ctx context.Context, ns string) error {
+	if c.pooled {
+		return ErrPooledSelect
+	}
+
 	_, err := c.cl.Do(ctx, "SELECT", ns).Result()
 	if err != nil {
 		return err
@@ -209,6 +254,10 @@ func (c *Client) Select(ctx context.Context, ns string) error {
 }
 
 func (c *Client) SelectSecure(ctx context.Context, ns, password string) error {
+	if c.pooled {
+		return ErrPooledSelect
+	}
+
 	_, err := c.cl.Do(ctx, "SELECT", ns, "SECURE", password).Result()
 	if err != nil {
 		return err
@@ -223,7 +272,16 @@ func (c *Client) GetSize(ctx context.Context) (uint64, error) {
 		return 0, err
 	}
 
-	return res.(uint64), nil
+	size, err := reply.Int64(res, "size")
+	if err != nil {
+		return 0, err
+	}
+
+	if size < 0 {
+		return 0, fmt.Errorf("invalid response, negative size %d", size)
+	}
+
+	return uint64(size), nil
 }
 
 func (c *Client) Time(ctx context.Context) (int64, error) {
@@ -232,7 +290,17 @@ func (c *Client) Time(ctx context.Context) (int64, error) {
 		return 0, err
 	}
 
-	return res.(int64), nil
+	return reply.Time(res)
+}
+
+// Now returns the time of the server, with microseconds.
+func (c *Client) Now(ctx context.Context) (time.Time, error) {
+	res, err := c.cl.Do(ctx, "TIME").Result()
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	return reply.Timestamp(res)
 }
 
 func (c *Client) Auth(ctx context.Context, password string) error {
@@ -250,7 +318,11 @@ func (c *Client) AuthSecure(ctx context.Context, password string) error {
 		return err
 	}
 
-	challenge := res.(string)
+	challenge, err := reply.String(res, "challenge")
+	if err != nil {
+		return err
+	}
+
 	toHash := fmt.Sprintf("%s:%s", challenge, password)
 
 	hash := sha1.New()
@@ -268,9 +340,6 @@ func (c *Client) AuthSecure(ctx context.Context, password string) error {
 
 func (c *Client) Scan(ctx context.Context) (ScanResponse, error) {
 	res, err := c.cl.Do(ctx, "SCAN").Slice()
-	if err != nil && err.Error() == ErrCursorNoMoreData.Error() {
-		return ScanResponse{}, ErrCursorNoMoreData
-	}
 	if err != nil {
 		return ScanResponse{}, err
 	}
@@ -280,9 +349,6 @@ func (c *Client) Scan(ctx context.Context) (ScanResponse, error) {
 
 func (c *Client) ScanCursor(ctx context.Context, cursor string) (ScanResponse, error) {
 	res, err := c.cl.Do(ctx, "SCAN", cursor).Slice()
-	if err != nil && err.Error() == ErrCursorNoMoreData.Error() {
-		return ScanResponse{}, ErrCursorNoMoreData
-	}
 	if err != nil {
 		return ScanResponse{}, err
 	}
@@ -291,67 +357,28 @@ func (c *Client) ScanCursor(ctx context.Context, cursor string) (ScanResponse, e
 }
 
 func parseScanResponse(res []interface{}) (ScanResponse, error) {
-	if len(res) != 2 {
-		return ScanResponse{}, fmt.Errorf("invalid response, scan operations should return two elements, but %d were returned", len(res))
-	}
-
-	nextCursor, ok := res[0].(string)
-	if !ok {
-		return ScanResponse{}, fmt.Errorf("invalid response, expected next key to be string, but a %t was returned", res[0])
-	}
-
-	keys, ok := res[1].([]interface{})
-	if !ok {
-		return ScanResponse{}, fmt.Errorf("invalid response, expected keys to be a slice, but a %t was returned", res[1])
+	scan, err := reply.Scan(res)
+	if err != nil {
+		return ScanResponse{}, err
 	}
 
-	ret := make([]KeyInfo, 0, len(keys))
-
-	for _, k := range keys {
-		x, ok := k.([]interface{})
-		if !ok {
-			return ScanResponse{}, fmt.Errorf("invalid response, expected key information to be a slice, but a %t was returned", k)
-		}
-
-		if len(x) != 3 {
-			return ScanResponse{}, fmt.Errorf("invalid response, expected key information to be a slice with 3 elements, but %d elements were returned", len(x))
-		}
-
-		key, ok := x[0].(string)
-		if !ok {
-			return ScanResponse{}, fmt.Errorf("invalid response, expected key to be a string, but a %t was returned", x[0])
-		}
-
-		size, ok := x[1].(int64)
-		if !ok {
-			return ScanResponse{}, fmt.Errorf("invalid response, expected key size to be a int64, but a %t was returned", x[1])
-		}
-
-		ts, ok := x[2].(int64)
-		if !ok {
-			return ScanResponse{}, fmt.Errorf("invalid response, expected key creation timestamp to be an int64, but a %t was returned", x[2])
-		}
-
-		info := KeyInfo{
-			Key:       key,
-			Size:      uint64(size),
-			Timestamp: ts,
-		}
-
-		ret = append(ret, info)
+	keys := make([]KeyInfo, 0, len(scan.Keys))
+	for _, k := range scan.Keys {
+		keys = append(keys, KeyInfo{
+			Key:       string(k.Key),
+			Size:      k.Size,
+			Timestamp: k.Timestamp,
+		})
 	}
 
 	return ScanResponse{
-		Next: nextCursor,
-		Keys: ret,
+		Next: string(scan.Next),
+		Keys: keys,
 	}, nil
 }
 
 func (c *Client) RScan(ctx context.Context) (ScanResponse, error) {
 	res, err := c.cl.Do(ctx, "RSCAN").Slice()
-	if err != nil && err.Error() == ErrCursorNoMoreData.Error() {
-		return ScanResponse{}, ErrCursorNoMoreData
-	}
 	if err != nil {
 		return ScanResponse{}, err
 	}
@@ -361,9 +388,6 @@ func (c *Client) RScan(ctx context.Context) (ScanResponse, error) {
 
 func (c *Client) RScanCursor(ctx context.Context, cursor string) (ScanResponse, error) {
 	res, err := c.cl.Do(ctx, "RSCAN", cursor).Slice()
-	if err != nil && err.Error() == ErrCursorNoMoreData.Error() {
-		return ScanResponse{}, ErrCursorNoMoreData
-	}
 	if err != nil {
 		return ScanResponse{}, err
 	}
@@ -388,22 +412,52 @@ func (c *Client) WaitWithTimeout(ctx context.Context, command string, timeout ui
 	return nil
 }
 
-func (c *Client) History(ctx context.Context, key string, data string) (string, error) {
-	res, err := c.cl.Do(ctx, "HISTORY", key).Result()
+// History returns the current value of the key, and the reference of its previous value.
+func (c *Client) History(ctx context.Context, key string) (HistoryEntry, error) {
+	res, err := c.cl.Do(ctx, "HISTORY", key).Slice()
 	if err != nil {
-		return "", err
+		return HistoryEntry{}, err
 	}
 
-	return res.(string), nil
+	return parseHistoryResponse(res)
 }
 
-func (c *Client) HistoryWithData(ctx context.Context, key string, data string) (string, error) {
-	res, err := c.cl.Do(ctx, "HISTORY", key, data).Result()
+// HistoryWithData returns the value of the key at a reference returned by a previous History
+// call, cursors returned by KeyCursor or a scan are not valid references.
+func (c *Client) HistoryWithData(ctx context.Context, key string, data string) (HistoryEntry, error) {
+	res, err := c.cl.Do(ctx, "HISTORY", key, data).Slice()
 	if err != nil {
-		return "", err
+		return HistoryEntry{}, err
+	}
+
+	return parseHistoryResponse(res)
+}
+
+func parseHistoryResponse(res []interface{}) (HistoryEntry, error) {
+	if len(res) != 3 {
+		return HistoryEntry{}, fmt.Errorf("invalid response, history should return three elements, but %d were returned", len(res))
+	}
+
+	ts, ok := res[0].(int64)
+	if !ok {
+		return HistoryEntry{}, fmt.Errorf("invalid response, expected timestamp to be an int64, but a %T was returned", res[0])
 	}
 
-	return res.(string), nil
+	previous, ok := res[1].(string)
+	if !ok {
+		return HistoryEntry{}, fmt.Errorf("invalid response, expected previous cursor to be a string, but a %T was returned", res[1])
+	}
+
+	value, ok := res[2].(string)
+	if !ok {
+		return HistoryEntry{}, fmt.Errorf("invalid response, expected value to be a string, but a %T was returned", res[2])
+	}
+
+	return HistoryEntry{
+		Timestamp: ts,
+		Previous:  previous,
+		Value:     value,
+	}, nil
 }
 
 func (c *Client) Flush(ctx context.Context) error {
@@ -415,38 +469,45 @@ func (c *Client) Flush(ctx context.Context) error {
 	return nil
 }
 
+// Hooks returns the type of every hook in the hooks list of the server.
+//
+// Deprecated: use ListHooks, which returns the details of every hook.
 func (c *Client) Hooks(ctx context.Context) ([]string, error) {
-	res, err := c.cl.Do(ctx, "HOOKS").Result()
+	hooks, err := c.ListHooks(ctx)
 	if err != nil {
 		return nil, err
 	}
 
-	hooks := res.([]interface{})
 	ret := make([]string, 0, len(hooks))
 	for _, hook := range hooks {
-		ret = append(ret, hook.(string))
+		ret = append(ret, hook.Type)
 	}
 
 	return ret, nil
 }
 
-func (c *Client) IndexDirty(ctx context.Context) ([]string, error) {
-	res, err := c.cl.Do(ctx, "INDEX DIRTY").Result()
+// IndexDirty returns the ids of the index files modified since the last IndexDirtyReset.
+func (c *Client) IndexDirty(ctx context.Context) ([]uint32, error) {
+	res, err := c.cl.Do(ctx, "INDEX", "DIRTY").Slice()
 	if err != nil {
 		return nil, err
 	}
 
-	ids := res.([]interface{})
-	ret := make([]string, 0, len(ids))
-	for _, hook := range ids {
-		ret = append(ret, hook.(string))
+	ret := make([]uint32, 0, len(res))
+	for _, id := range res {
+		fileID, ok := id.(int64)
+		if !ok {
+			return nil, fmt.Errorf("invalid response, expected index id to be an int64, but a %T was returned", id)
+		}
+
+		ret = append(ret, uint32(fileID))
 	}
 
 	return ret, nil
 }
 
 func (c *Client) IndexDirtyReset(ctx context.Context) error {
-	_, err := c.cl.Do(ctx, "INDEX DIRTY RESET").Result()
+	_, err := c.cl.Do(ctx, "INDEX", "DIRTY", "RESET").Result()
 	if err != nil {
 		return err
 	}
@@ -454,37 +515,121 @@ func (c *Client) IndexDirtyReset(ctx context.Context) error {
 	return nil
 }
 
-func (c *Client) DataRaw(ctx context.Context, field, offset string) ([]string, error) {
-	res, err := c.cl.Do(ctx, "DATA RAW", field, offset).Result()
+// RawEntry is an entry read from a data file with DataRaw.
+type RawEntry struct {
+	Key       string
+	Previous  uint32
+	Integrity uint32
+	Flags     uint8
+	Timestamp int64
+	Payload   string
+}
+
+const (
+	// DataHeaderSize is the size of the header starting every data file, the first entry of
+	// a data file is at this offset.
+	DataHeaderSize = 26
+	// DataEntryHeaderSize is the size of the header preceding every entry of a data file.
+	DataEntryHeaderSize = 18
+
+	// DataEntryDeleted is set in the flags of entries recording a deletion.
+	DataEntryDeleted = 1
+)
+
+// Deleted reports whether the entry records the deletion of its key.
+func (e RawEntry) Deleted() bool {
+	return e.Flags&DataEntryDeleted != 0
+}
+
+// Size returns the size of the entry in the data file, the next entry starts at the offset of
+// this entry plus its size.
+func (e RawEntry) Size() uint32 {
+	return uint32(DataEntryHeaderSize + len(e.Key) + len(e.Payload))
+}
+
+// noDataEntryReplies are fragments of the error replies of DATA RAW for an offset past the
+// last entry of a data file.
+var noDataEntryReplies = []string{"could not read entry", "invalid offset"}
+
+// DataRaw reads the entry at an offset of a data file of the selected namespace. It fails with
+// ErrNoDataEntry past the last entry of the file.
+func (c *Client) DataRaw(ctx context.Context, fileID uint32, offset uint32) (RawEntry, error) {
+	res, err := c.cl.Do(ctx, "DATA", "RAW", fileID, offset).Slice()
+	if isNoDataEntry(err) {
+		return RawEntry{}, fmt.Errorf("%w: %w", ErrNoDataEntry, err)
+	}
 	if err != nil {
-		return nil, err
+		return RawEntry{}, err
 	}
 
-	info := res.([]interface{})
-	ret := make([]string, 0, len(info))
-	for _, hook := range info {
-		ret = append(ret, hook.(string))
+	return parseDataRawResponse(res)
+}
+
+func isNoDataEntry(err error) bool {
+	var serverErr *ServerError
+	if !errors.As(err, &serverErr) {
+		return false
 	}
 
-	return ret, nil
+	message := strings.ToLower(serverErr.Message)
+	for _, fragment := range noDataEntryReplies {
+		if strings.Contains(message, fragment) {
+			return true
+		}
+	}
+
+	return false
 }
 
-func (c *Client) Length(ctx context.Context, key string) (uint64, error) {
-	res, err := c.cl.Do(ctx, "LENGTH", key).Result()
-	if err != nil {
-		return 0, err
+func parseDataRawResponse(res []interface{}) (RawEntry, error) {
+	if len(res) != 6 {
+		return RawEntry{}, fmt.Errorf("invalid response, data raw should return six elements, but %d were returned", len(res))
+	}
+
+	key, ok := res[0].(string)
+	if !ok {
+		return RawEntry{}, fmt.Errorf("invalid response, expected key to be a string, but a %T was returned", res[0])
 	}
 
-	return res.(uint64), err
+	ints := make([]int64, 0, 4)
+	for _, v := range res[1:5] {
+		i, ok := v.(int64)
+		if !ok {
+			return RawEntry{}, fmt.Errorf("invalid response, expected entry header field to be an int64, but a %T was returned", v)
+		}
+
+		ints = append(ints, i)
+	}
+
+	payload, ok := res[5].(string)
+	if !ok {
+		return RawEntry{}, fmt.Errorf("invalid response, expected payload to be a string, but a %T was returned", res[5])
+	}
+
+	return RawEntry{
+		Key:       key,
+		Previous:  uint32(ints[0]),
+		Integrity: uint32(ints[1]),
+		Flags:     uint8(ints[2]),
+		Timestamp: ints[3],
+		Payload:   payload,
+	}, nil
 }
 
-func (c *Client) KeyTime(ctx context.Context, key string) (int64, error) {
-	res, err := c.cl.Do(ctx, "KEYTIME").Result()
+func (c *Client) Length(ctx context.Context, key string) (uint64, error) {
+	res, err := c.cl.Do(ctx, "LENGTH", key).Uint64()
+	if err != nil && errors.Is(err, redis.Nil) {
+		return 0, ErrNil
+	}
 	if err != nil {
 		return 0, err
 	}
 
-	return res.(int64), nil
+	return res, nil
+}
+
+func (c *Client) KeyTime(ctx context.Context, key string) (int64, error) {
+	return c.cl.Do(ctx, "KEYTIME", key).Int64()
 }
 
 func (c *Client) Close() error {
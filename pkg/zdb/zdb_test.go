@@ -1,10 +1,18 @@
 package zdb
 
 import (
+	"bufio"
+	"bytes"
 	"context"
+	"fmt"
+	"strconv"
+	"sync"
 	"testing"
+	"time"
 
+	"github.com/mariobassem/tendermint-zdb/pkg/zdb/zdbtest"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestZDBSet(t *testing.T) {
@@ -86,3 +94,136 @@ func TestCheck(t *testing.T) {
 	err = zdb.Delete(context.Background(), key)
 	assert.NoError(t, err)
 }
+
+func TestClientReplies(t *testing.T) {
+	client, server := newTestClient(t)
+	server.Now = func() time.Time { return time.Unix(1700000000, 500) }
+	ctx := context.Background()
+
+	require.NoError(t, client.Set(ctx, "key", "value"))
+	require.NoError(t, client.NewNamespace(ctx, "other"))
+
+	size, err := client.GetSize(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, uint64(5), size)
+
+	now, err := client.Time(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1700000000), now)
+
+	namespaces, err := client.ListNamespaces(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"default", "other"}, namespaces)
+
+	info, err := client.NamespaceStats(ctx, "default")
+	require.NoError(t, err)
+	assert.Equal(t, "default", info["name"])
+
+	server.SetHook(zdbtest.Hook{ID: 1, Type: "ready", Started: time.Unix(1700000000, 0)})
+	hooks, err := client.Hooks(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"ready"}, hooks)
+}
+
+func TestPooledClient(t *testing.T) {
+	_, server := newTestClient(t)
+	ctx := context.Background()
+
+	client := NewClient(server.Addr(), WithPoolSize(4))
+	defer client.Close()
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 4)
+	for i := 0; i < 4; i++ {
+		key := fmt.Sprintf("key-%d", i)
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 20; j++ {
+				if err := client.Set(ctx, key, strconv.Itoa(j)); err != nil {
+					errs <- err
+					return
+				}
+
+				if _, err := client.Get(ctx, key); err != nil {
+					errs <- err
+					return
+				}
+			}
+		}()
+	}
+
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		require.NoError(t, err)
+	}
+
+	// the connections of the pool can't share a namespace
+	assert.ErrorIs(t, client.Select(ctx, "default"), ErrPooledSelect)
+	assert.ErrorIs(t, client.SelectSecure(ctx, "default", "password"), ErrPooledSelect)
+}
+
+// decodeReply reads a RESP encoded array reply, like go-redis decodes it.
+func decodeReply(data []byte) ([]interface{}, bool) {
+	v, err := zdbtest.ReadReply(bufio.NewReader(bytes.NewReader(data)))
+	if err != nil {
+		return nil, false
+	}
+
+	res, ok := v.([]interface{})
+
+	return res, ok
+}
+
+func FuzzParseScanResponse(f *testing.F) {
+	f.Add(zdbtest.EncodeReply([]interface{}{
+		"\x01\x00\x00\x00",
+		[]interface{}{[]interface{}{"key", int64(5), int64(1700000000)}},
+	}))
+	f.Add(zdbtest.EncodeReply([]interface{}{"cursor", []interface{}{[]interface{}{"key", "5"}}}))
+	f.Add([]byte("*2\r\n+cursor\r\n*-1\r\n"))
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		res, ok := decodeReply(data)
+		if !ok {
+			return
+		}
+
+		_, _ = parseScanResponse(res)
+	})
+}
+
+func FuzzParseHistoryResponse(f *testing.F) {
+	f.Add(zdbtest.EncodeReply([]interface{}{int64(1700000000), "\x01\x00", "value"}))
+	f.Add(zdbtest.EncodeReply([]interface{}{int64(1700000000), "", nil}))
+	f.Add([]byte("*3\r\n$1\r\n1\r\n:2\r\n:3\r\n"))
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		res, ok := decodeReply(data)
+		if !ok {
+			return
+		}
+
+		_, _ = parseHistoryResponse(res)
+	})
+}
+
+func FuzzParseDataRawResponse(f *testing.F) {
+	f.Add(zdbtest.EncodeReply([]interface{}{"key", int64(0), int64(123), int64(0), int64(1700000000), "value"}))
+	f.Add(zdbtest.EncodeReply([]interface{}{"key", int64(0), "123", int64(1), int64(1700000000), "value"}))
+	f.Add([]byte("*6\r\n$-1\r\n:0\r\n:0\r\n:0\r\n:0\r\n+\r\n"))
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		res, ok := decodeReply(data)
+		if !ok {
+			return
+		}
+
+		entry, err := parseDataRawResponse(res)
+		if err == nil && entry.Size() < DataEntryHeaderSize {
+			t.Fatalf("entry size %d is smaller than its header", entry.Size())
+		}
+	})
+}
@@ -0,0 +1,182 @@
+package zdbtest
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// simpleString is written as a RESP simple string instead of a bulk string.
+type simpleString string
+
+func readCommand(r *bufio.Reader) ([]string, error) {
+	line, err := readLine(r)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(line) == 0 {
+		return nil, nil
+	}
+
+	// inline commands, as sent by telnet or redis-cli in some modes
+	if line[0] != '*' {
+		return strings.Fields(line), nil
+	}
+
+	n, err := strconv.Atoi(line[1:])
+	if err != nil {
+		return nil, fmt.Errorf("invalid multibulk length: %w", err)
+	}
+
+	args := make([]string, 0, n)
+	for i := 0; i < n; i++ {
+		line, err := readLine(r)
+		if err != nil {
+			return nil, err
+		}
+
+		if len(line) == 0 || line[0] != '$' {
+			return nil, errors.New("expected bulk string")
+		}
+
+		size, err := strconv.Atoi(line[1:])
+		if err != nil {
+			return nil, fmt.Errorf("invalid bulk length: %w", err)
+		}
+
+		buf := make([]byte, size+2)
+		if _, err := io.ReadFull(r, buf); err != nil {
+			return nil, err
+		}
+
+		args = append(args, string(buf[:size]))
+	}
+
+	return args, nil
+}
+
+func readLine(r *bufio.Reader) (string, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return "", err
+	}
+
+	return strings.TrimRight(line, "\r\n"), nil
+}
+
+func writeReply(w *bufio.Writer, reply interface{}) {
+	switch v := reply.(type) {
+	case nil:
+		w.WriteString("$-1\r\n")
+	case simpleString:
+		fmt.Fprintf(w, "+%s\r\n", v)
+	case error:
+		fmt.Fprintf(w, "-%s\r\n", v.Error())
+	case int64:
+		fmt.Fprintf(w, ":%d\r\n", v)
+	case string:
+		fmt.Fprintf(w, "$%d\r\n%s\r\n", len(v), v)
+	case []interface{}:
+		fmt.Fprintf(w, "*%d\r\n", len(v))
+		for _, elem := range v {
+			writeReply(w, elem)
+		}
+	default:
+		panic(fmt.Sprintf("zdbtest: unsupported reply type %T", reply))
+	}
+}
+
+// maxReplyLength bounds the lengths read by ReadReply, so malformed input can't make it
+// allocate more.
+const maxReplyLength = 1 << 20
+
+// replyError is an error reply.
+type replyError string
+
+func (e replyError) Error() string {
+	return string(e)
+}
+
+// EncodeReply encodes a reply as the server writes it. Replies are strings, int64s, errors,
+// nil and arrays of replies.
+func EncodeReply(reply interface{}) []byte {
+	var buf bytes.Buffer
+	w := bufio.NewWriter(&buf)
+	writeReply(w, reply)
+	w.Flush()
+
+	return buf.Bytes()
+}
+
+// ReadReply reads a reply, decoded like go-redis does: strings for bulk and simple strings,
+// int64s for integers, nil for null bulk strings and arrays, []interface{} for arrays and
+// errors for error replies. It lets tests feed reply decoders with RESP input.
+func ReadReply(r *bufio.Reader) (interface{}, error) {
+	line, err := readLine(r)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(line) == 0 {
+		return nil, errors.New("empty reply line")
+	}
+
+	switch line[0] {
+	case '+':
+		return line[1:], nil
+	case '-':
+		return replyError(line[1:]), nil
+	case ':':
+		return strconv.ParseInt(line[1:], 10, 64)
+	case '$':
+		size, err := replyLength(line)
+		if err != nil || size < 0 {
+			return nil, err
+		}
+
+		buf := make([]byte, size+2)
+		if _, err := io.ReadFull(r, buf); err != nil {
+			return nil, err
+		}
+
+		return string(buf[:size]), nil
+	case '*':
+		n, err := replyLength(line)
+		if err != nil || n < 0 {
+			return nil, err
+		}
+
+		elems := make([]interface{}, 0, min(n, 64))
+		for i := 0; i < n; i++ {
+			elem, err := ReadReply(r)
+			if err != nil {
+				return nil, err
+			}
+
+			elems = append(elems, elem)
+		}
+
+		return elems, nil
+	default:
+		return nil, fmt.Errorf("invalid reply type %q", line[0])
+	}
+}
+
+// replyLength parses the length of a bulk string or array, -1 for null ones.
+func replyLength(line string) (int, error) {
+	n, err := strconv.Atoi(line[1:])
+	if err != nil {
+		return 0, fmt.Errorf("invalid length: %w", err)
+	}
+
+	if n < -1 || n > maxReplyLength {
+		return 0, fmt.Errorf("invalid length %d", n)
+	}
+
+	return n, nil
+}
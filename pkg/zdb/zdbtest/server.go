@@ -0,0 +1,920 @@
+// Package zdbtest provides an in-process 0-db stand-in server for tests.
+//
+// The server speaks RESP over TCP and implements the subset of 0-db's user mode
+// command set used by this module: keys are stored in an append-only log per
+// namespace, overwrites and deletions append new entries, and SCAN/RSCAN walk the
+// log through opaque binary cursors, just like the real daemon.
+package zdbtest
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	defaultNamespace = "default"
+	defaultPageSize  = 8
+	maxKeySize       = 255
+
+	// entriesPerDataFile is the number of entries written to a data file before a new one
+	// is opened. The real daemon rotates data files by size instead.
+	entriesPerDataFile = 16
+	// dataHeaderSize and entryHeaderSize are the sizes of the data file header and of the
+	// header preceding every entry in 0-db data files, offsets are computed from them.
+	dataHeaderSize  = 26
+	entryHeaderSize = 18
+
+	// flagDeleted is set on data entries recording a deletion.
+	flagDeleted = 1
+)
+
+var errQuit = errors.New("quit")
+
+// Server is a local 0-db stand-in listening on a random loopback port.
+type Server struct {
+	// PageSize is the maximum number of keys returned by one SCAN or RSCAN call.
+	PageSize int
+	// Now returns the server time, it is used for key timestamps.
+	Now func() time.Time
+
+	listener net.Listener
+	addr     string
+	wg       sync.WaitGroup
+
+	mu         sync.Mutex
+	namespaces map[string]*namespace
+	conns      map[net.Conn]struct{}
+	waiters    map[*waiter]struct{}
+	hooks      []Hook
+	stop       chan struct{}
+	closed     bool
+}
+
+// Hook is a hook process reported by HOOKS. A zero Finished time means the hook is running.
+type Hook struct {
+	ID        int64
+	Type      string
+	Arguments []string
+	PID       int64
+	Started   time.Time
+	Finished  time.Time
+	ExitCode  int64
+}
+
+// waiter is a connection blocked on WAIT until a command runs on its namespace.
+type waiter struct {
+	ns      string
+	command string
+	ch      chan string
+}
+
+type entry struct {
+	key       string
+	value     string
+	timestamp int64
+	deleted   bool
+	corrupted bool
+	file      uint32
+	offset    uint32
+}
+
+type namespace struct {
+	name     string
+	password string
+	public   bool
+	worm     bool
+	maxSize  uint64
+	log      []entry
+	index    map[string]int
+	dirty    map[uint32]struct{}
+}
+
+type session struct {
+	ns string
+	// readOnly is set when a protected namespace was selected without its password, which is
+	// allowed for public namespaces.
+	readOnly bool
+}
+
+// writeCommands are the commands refused to read-only sessions.
+var writeCommands = map[string]bool{
+	"SET":   true,
+	"DEL":   true,
+	"FLUSH": true,
+}
+
+// NewServer starts a stand-in server with an empty default namespace.
+func NewServer() (*Server, error) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, err
+	}
+
+	s := &Server{
+		PageSize:   defaultPageSize,
+		Now:        time.Now,
+		listener:   l,
+		addr:       l.Addr().String(),
+		namespaces: map[string]*namespace{},
+		conns:      map[net.Conn]struct{}{},
+		waiters:    map[*waiter]struct{}{},
+		stop:       make(chan struct{}),
+	}
+	s.namespaces[defaultNamespace] = newNamespace(defaultNamespace)
+	s.namespaces[defaultNamespace].public = true
+
+	s.wg.Add(1)
+	go s.serve(l)
+
+	return s, nil
+}
+
+func newNamespace(name string) *namespace {
+	return &namespace{
+		name:   name,
+		public: true,
+		index:  map[string]int{},
+		dirty:  map[uint32]struct{}{},
+	}
+}
+
+// Addr returns the address the server listens on.
+func (s *Server) Addr() string {
+	return s.addr
+}
+
+// Close stops the server and closes all client connections.
+func (s *Server) Close() error {
+	s.mu.Lock()
+	if !s.closed {
+		close(s.stop)
+	}
+	s.closed = true
+	for c := range s.conns {
+		c.Close()
+	}
+	l := s.listener
+	s.mu.Unlock()
+
+	err := l.Close()
+	s.wg.Wait()
+
+	return err
+}
+
+// Restart listens again on the address of a closed server, with the data it held.
+func (s *Server) Restart() error {
+	l, err := net.Listen("tcp", s.addr)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	s.closed = false
+	s.listener = l
+	s.stop = make(chan struct{})
+	s.mu.Unlock()
+
+	s.wg.Add(1)
+	go s.serve(l)
+
+	return nil
+}
+
+// Corrupt marks the current entry of the key in the namespace as corrupted, so CHECKS
+// reports a checksum mismatch for it.
+func (s *Server) Corrupt(ns, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	n, ok := s.namespaces[ns]
+	if !ok {
+		return errors.New("namespace not found")
+	}
+
+	idx, ok := n.index[key]
+	if !ok {
+		return errors.New("key not found")
+	}
+
+	n.log[idx].corrupted = true
+
+	return nil
+}
+
+// SetHook adds the hook to the list reported by HOOKS, or replaces the hook with the same ID.
+func (s *Server) SetHook(h Hook) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i := range s.hooks {
+		if s.hooks[i].ID == h.ID {
+			s.hooks[i] = h
+			return
+		}
+	}
+
+	s.hooks = append(s.hooks, h)
+}
+
+func (s *Server) serve(l net.Listener) {
+	defer s.wg.Done()
+
+	for {
+		c, err := l.Accept()
+		if err != nil {
+			return
+		}
+
+		s.mu.Lock()
+		if s.closed {
+			s.mu.Unlock()
+			c.Close()
+			return
+		}
+		s.conns[c] = struct{}{}
+		s.mu.Unlock()
+
+		s.wg.Add(1)
+		go s.handle(c)
+	}
+}
+
+func (s *Server) handle(c net.Conn) {
+	defer s.wg.Done()
+	defer func() {
+		s.mu.Lock()
+		delete(s.conns, c)
+		s.mu.Unlock()
+		c.Close()
+	}()
+
+	r := bufio.NewReader(c)
+	w := bufio.NewWriter(c)
+	sess := &session{ns: defaultNamespace}
+
+	for {
+		args, err := readCommand(r)
+		if err != nil {
+			return
+		}
+
+		if len(args) == 0 {
+			continue
+		}
+
+		var reply interface{}
+		if strings.ToUpper(args[0]) == "WAIT" {
+			reply = s.wait(sess, args[1:])
+		} else {
+			reply = s.dispatch(sess, args)
+		}
+
+		if reply == errQuit {
+			return
+		}
+
+		writeReply(w, reply)
+		if err := w.Flush(); err != nil {
+			return
+		}
+	}
+}
+
+// wait blocks until another connection runs the command, or any command for "*", on the
+// session namespace, and replies with the name of the command. It fails with a timeout
+// error after the timeout in milliseconds, 5 seconds by default.
+func (s *Server) wait(sess *session, args []string) interface{} {
+	if len(args) < 1 || len(args) > 2 {
+		return wrongArgs("WAIT")
+	}
+
+	timeout := 5 * time.Second
+	if len(args) == 2 {
+		ms, err := strconv.ParseUint(args[1], 10, 32)
+		if err != nil {
+			return errors.New("Invalid timeout")
+		}
+		timeout = time.Duration(ms) * time.Millisecond
+	}
+
+	w := &waiter{ns: sess.ns, command: strings.ToUpper(args[0]), ch: make(chan string, 1)}
+
+	s.mu.Lock()
+	s.waiters[w] = struct{}{}
+	stop := s.stop
+	s.mu.Unlock()
+
+	defer func() {
+		s.mu.Lock()
+		delete(s.waiters, w)
+		s.mu.Unlock()
+	}()
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	select {
+	case cmd := <-w.ch:
+		return simpleString(cmd)
+	case <-timer.C:
+		return errors.New("Timeout")
+	case <-stop:
+		return errQuit
+	}
+}
+
+// notify wakes up the connections waiting for the command on the namespace. The caller must
+// hold s.mu.
+func (s *Server) notify(ns, cmd string) {
+	for w := range s.waiters {
+		if w.ns != ns || (w.command != "*" && w.command != cmd) {
+			continue
+		}
+
+		select {
+		case w.ch <- cmd:
+		default:
+		}
+	}
+}
+
+// dispatch runs one command and returns its reply: nil for a nil bulk string,
+// string for a bulk string, simpleString, int64, error, or []interface{}.
+func (s *Server) dispatch(sess *session, args []string) interface{} {
+	cmd := strings.ToUpper(args[0])
+	args = args[1:]
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	reply := s.run(sess, cmd, args)
+	if _, failed := reply.(error); !failed {
+		s.notify(sess.ns, cmd)
+	}
+
+	return reply
+}
+
+func (s *Server) run(sess *session, cmd string, args []string) interface{} {
+	ns, ok := s.namespaces[sess.ns]
+	if !ok {
+		return errors.New("Namespace not found")
+	}
+
+	if sess.readOnly && writeCommands[cmd] {
+		return errors.New("Namespace is in read-only mode")
+	}
+
+	// raw data files hold every namespace, they are only readable by the admin
+	if sess.readOnly && cmd == "DATA" {
+		return errors.New("Permission denied")
+	}
+
+	switch cmd {
+	case "PING":
+		return simpleString("PONG")
+	case "QUIT":
+		return errQuit
+	case "SET":
+		if len(args) != 2 {
+			return wrongArgs(cmd)
+		}
+		return s.set(ns, args[0], args[1])
+	case "GET":
+		if len(args) != 1 {
+			return wrongArgs(cmd)
+		}
+		e, ok := ns.lookup(args[0])
+		if !ok {
+			return nil
+		}
+		return e.value
+	case "MGET":
+		ret := make([]interface{}, 0, len(args))
+		for _, k := range args {
+			e, ok := ns.lookup(k)
+			if !ok {
+				ret = append(ret, nil)
+				continue
+			}
+			ret = append(ret, e.value)
+		}
+		return ret
+	case "DEL":
+		if len(args) != 1 {
+			return wrongArgs(cmd)
+		}
+		if ns.worm {
+			return errors.New("Namespace is in WORM mode")
+		}
+		if _, ok := ns.lookup(args[0]); !ok {
+			return errors.New("Key not found")
+		}
+		ns.append(entry{key: args[0], timestamp: s.Now().Unix(), deleted: true})
+		return simpleString("OK")
+	case "EXISTS":
+		if len(args) != 1 {
+			return wrongArgs(cmd)
+		}
+		if _, ok := ns.lookup(args[0]); ok {
+			return int64(1)
+		}
+		return int64(0)
+	case "CHECKS":
+		if len(args) != 1 {
+			return wrongArgs(cmd)
+		}
+		e, ok := ns.lookup(args[0])
+		if !ok {
+			return errors.New("Key not found")
+		}
+		if e.corrupted {
+			return int64(0)
+		}
+		return int64(1)
+	case "LENGTH":
+		if len(args) != 1 {
+			return wrongArgs(cmd)
+		}
+		e, ok := ns.lookup(args[0])
+		if !ok {
+			return nil
+		}
+		return int64(len(e.value))
+	case "KEYTIME":
+		if len(args) != 1 {
+			return wrongArgs(cmd)
+		}
+		e, ok := ns.lookup(args[0])
+		if !ok {
+			return errors.New("Key not found")
+		}
+		return e.timestamp
+	case "KEYCUR":
+		if len(args) != 1 {
+			return wrongArgs(cmd)
+		}
+		idx, ok := ns.index[args[0]]
+		if !ok {
+			return errors.New("Key not found")
+		}
+		return encodeCursor(idx)
+	case "INDEX":
+		return s.index(ns, args)
+	case "DATA":
+		return s.data(ns, args)
+	case "HISTORY":
+		return s.history(ns, args)
+	case "SCAN":
+		return s.scan(ns, args, true)
+	case "RSCAN":
+		return s.scan(ns, args, false)
+	case "DBSIZE":
+		return int64(ns.size())
+	case "TIME":
+		now := s.Now()
+		return []interface{}{strconv.FormatInt(now.Unix(), 10), strconv.FormatInt(int64(now.Nanosecond()/1000), 10)}
+	case "INFO":
+		return s.info()
+	case "SELECT":
+		if len(args) != 1 && len(args) != 3 {
+			return wrongArgs(cmd)
+		}
+		target, ok := s.namespaces[args[0]]
+		if !ok {
+			return errors.New("Namespace not found")
+		}
+		if len(args) == 3 && target.password != args[2] {
+			return errors.New("Access denied")
+		}
+		if len(args) == 1 && !target.public && target.password != "" {
+			return errors.New("Namespace protected and private")
+		}
+		sess.ns = target.name
+		sess.readOnly = len(args) == 1 && target.password != ""
+		return simpleString("OK")
+	case "NSNEW":
+		if len(args) != 1 {
+			return wrongArgs(cmd)
+		}
+		if _, ok := s.namespaces[args[0]]; ok {
+			return errors.New("This namespace is not available")
+		}
+		s.namespaces[args[0]] = newNamespace(args[0])
+		return simpleString("OK")
+	case "NSDEL":
+		if len(args) != 1 {
+			return wrongArgs(cmd)
+		}
+		if args[0] == defaultNamespace {
+			return errors.New("Cannot remove default namespace")
+		}
+		if _, ok := s.namespaces[args[0]]; !ok {
+			return errors.New("Namespace not found")
+		}
+		if sess.ns == args[0] {
+			return errors.New("Cannot remove namespace you're currently using")
+		}
+		delete(s.namespaces, args[0])
+		return simpleString("OK")
+	case "NSLIST":
+		names := make([]string, 0, len(s.namespaces))
+		for name := range s.namespaces {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		ret := make([]interface{}, 0, len(names))
+		for _, name := range names {
+			ret = append(ret, name)
+		}
+		return ret
+	case "NSINFO":
+		if len(args) != 1 {
+			return wrongArgs(cmd)
+		}
+		target, ok := s.namespaces[args[0]]
+		if !ok {
+			return errors.New("Namespace not found")
+		}
+		return target.info()
+	case "NSSET":
+		if len(args) != 3 {
+			return wrongArgs(cmd)
+		}
+		return s.nsset(args[0], args[1], args[2])
+	case "HOOKS":
+		return s.listHooks()
+	case "FLUSH":
+		if ns.worm {
+			return errors.New("Namespace is in WORM mode")
+		}
+		*ns = *newNamespace(ns.name)
+		return simpleString("OK")
+	default:
+		return fmt.Errorf("Command not supported")
+	}
+}
+
+func (s *Server) set(ns *namespace, key, value string) interface{} {
+	if len(key) > maxKeySize {
+		return errors.New("Key too large")
+	}
+
+	if len(key) == 0 {
+		return errors.New("Invalid key")
+	}
+
+	if ns.worm {
+		if _, ok := ns.lookup(key); ok {
+			return errors.New("Namespace is in WORM mode")
+		}
+	}
+
+	if ns.maxSize > 0 && ns.size()+uint64(len(value)) > ns.maxSize {
+		return errors.New("No space left on this namespace")
+	}
+
+	if e, ok := ns.lookup(key); ok && e.value == value {
+		return nil
+	}
+
+	ns.append(entry{key: key, value: value, timestamp: s.Now().Unix()})
+
+	return key
+}
+
+func (s *Server) scan(ns *namespace, args []string, forward bool) interface{} {
+	if len(args) > 1 {
+		return wrongArgs("SCAN")
+	}
+
+	pos := -1
+	if !forward {
+		pos = len(ns.log)
+	}
+
+	if len(args) == 1 {
+		idx, err := decodeCursor(args[0])
+		if err != nil || idx >= len(ns.log) {
+			return errors.New("Invalid cursor")
+		}
+		pos = idx
+	}
+
+	keys := make([]interface{}, 0, s.PageSize)
+	next := ""
+	for {
+		if forward {
+			pos++
+		} else {
+			pos--
+		}
+
+		if pos < 0 || pos >= len(ns.log) || len(keys) == s.PageSize {
+			break
+		}
+
+		if !ns.live(pos) {
+			continue
+		}
+
+		e := ns.log[pos]
+		keys = append(keys, []interface{}{e.key, int64(len(e.value)), e.timestamp})
+		next = encodeCursor(pos)
+	}
+
+	if len(keys) == 0 {
+		return errors.New("No more data")
+	}
+
+	return []interface{}{next, keys}
+}
+
+func (s *Server) index(ns *namespace, args []string) interface{} {
+	switch {
+	case len(args) == 1 && strings.ToUpper(args[0]) == "DIRTY":
+		files := make([]int, 0, len(ns.dirty))
+		for f := range ns.dirty {
+			files = append(files, int(f))
+		}
+		sort.Ints(files)
+
+		ret := make([]interface{}, 0, len(files))
+		for _, f := range files {
+			ret = append(ret, int64(f))
+		}
+		return ret
+	case len(args) == 2 && strings.ToUpper(args[0]) == "DIRTY" && strings.ToUpper(args[1]) == "RESET":
+		ns.dirty = map[uint32]struct{}{}
+		return simpleString("OK")
+	default:
+		return errors.New("Unknown INDEX subcommand")
+	}
+}
+
+func (s *Server) data(ns *namespace, args []string) interface{} {
+	if len(args) != 3 || strings.ToUpper(args[0]) != "RAW" {
+		return errors.New("Unknown DATA subcommand")
+	}
+
+	file, err := strconv.ParseUint(args[1], 10, 32)
+	if err != nil {
+		return errors.New("Invalid file id")
+	}
+
+	offset, err := strconv.ParseUint(args[2], 10, 32)
+	if err != nil {
+		return errors.New("Invalid offset")
+	}
+
+	if uint32(file) > ns.currentDataFile() {
+		return errors.New("Could not open requested file")
+	}
+
+	pos, ok := ns.dataEntry(uint32(file), uint32(offset))
+	if !ok {
+		return errors.New("Could not read entry at this offset")
+	}
+
+	e := ns.log[pos]
+	integrity := int64(crc32.ChecksumIEEE([]byte(e.value)))
+	if e.corrupted {
+		integrity ^= 1
+	}
+
+	return []interface{}{e.key, int64(0), integrity, e.flags(), e.timestamp, e.value}
+}
+
+func (s *Server) history(ns *namespace, args []string) interface{} {
+	if len(args) != 1 && len(args) != 2 {
+		return wrongArgs("HISTORY")
+	}
+
+	pos, ok := ns.index[args[0]]
+	if !ok {
+		return errors.New("Key not found")
+	}
+
+	if len(args) == 2 {
+		idx, err := decodeDataRef(args[1])
+		if err != nil || idx >= len(ns.log) || ns.log[idx].key != args[0] || ns.log[idx].deleted {
+			return errors.New("Invalid cursor")
+		}
+		pos = idx
+	}
+
+	previous := ""
+	for idx := pos - 1; idx >= 0; idx-- {
+		if ns.log[idx].key == args[0] && !ns.log[idx].deleted {
+			previous = encodeDataRef(idx)
+			break
+		}
+	}
+
+	e := ns.log[pos]
+	return []interface{}{e.timestamp, previous, e.value}
+}
+
+func (s *Server) nsset(name, property, value string) interface{} {
+	ns, ok := s.namespaces[name]
+	if !ok {
+		return errors.New("Namespace not found")
+	}
+
+	switch property {
+	case "password":
+		if value == "*" {
+			value = ""
+		}
+		ns.password = value
+	case "public":
+		ns.public = value == "1"
+	case "worm":
+		ns.worm = value == "1"
+	case "maxsize":
+		size, err := strconv.ParseUint(value, 10, 64)
+		if err != nil {
+			return errors.New("Invalid value")
+		}
+		ns.maxSize = size
+	default:
+		return errors.New("Invalid property")
+	}
+
+	return simpleString("OK")
+}
+
+// listHooks replies with one array per hook: id, type, arguments, pid, started and finished
+// timestamps, and exit code.
+func (s *Server) listHooks() interface{} {
+	ret := make([]interface{}, 0, len(s.hooks))
+	for _, h := range s.hooks {
+		args := make([]interface{}, 0, len(h.Arguments))
+		for _, arg := range h.Arguments {
+			args = append(args, arg)
+		}
+
+		var finished int64
+		if !h.Finished.IsZero() {
+			finished = h.Finished.Unix()
+		}
+
+		ret = append(ret, []interface{}{h.ID, h.Type, args, h.PID, h.Started.Unix(), finished, h.ExitCode})
+	}
+
+	return ret
+}
+
+func (s *Server) info() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "# server\r\n")
+	fmt.Fprintf(&b, "server_name: 0-db stand-in\r\n")
+	fmt.Fprintf(&b, "mode: userkey\r\n")
+	fmt.Fprintf(&b, "namespaces: %d\r\n", len(s.namespaces))
+
+	return b.String()
+}
+
+func (ns *namespace) info() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "# namespace\n")
+	fmt.Fprintf(&b, "name: %s\n", ns.name)
+	fmt.Fprintf(&b, "entries: %d\n", len(ns.index))
+	fmt.Fprintf(&b, "public: %s\n", yesNo(ns.public))
+	fmt.Fprintf(&b, "password: %s\n", yesNo(ns.password != ""))
+	fmt.Fprintf(&b, "data_size_bytes: %d\n", ns.size())
+	fmt.Fprintf(&b, "data_limits_bytes: %d\n", ns.maxSize)
+	fmt.Fprintf(&b, "worm: %s\n", yesNo(ns.worm))
+	fmt.Fprintf(&b, "data_current_id: %d\n", ns.currentDataFile())
+
+	return b.String()
+}
+
+func (ns *namespace) lookup(key string) (entry, bool) {
+	idx, ok := ns.index[key]
+	if !ok {
+		return entry{}, false
+	}
+
+	return ns.log[idx], true
+}
+
+func (ns *namespace) live(pos int) bool {
+	e := ns.log[pos]
+	if e.deleted {
+		return false
+	}
+
+	idx, ok := ns.index[e.key]
+	return ok && idx == pos
+}
+
+func (ns *namespace) append(e entry) {
+	e.file = uint32(len(ns.log) / entriesPerDataFile)
+	e.offset = dataHeaderSize
+	if len(ns.log)%entriesPerDataFile != 0 {
+		prev := ns.log[len(ns.log)-1]
+		e.offset = prev.offset + prev.entrySize()
+	}
+
+	ns.dirty[e.file] = struct{}{}
+	ns.log = append(ns.log, e)
+	if e.deleted {
+		delete(ns.index, e.key)
+		return
+	}
+
+	ns.index[e.key] = len(ns.log) - 1
+}
+
+// dataEntry returns the position in the log of the entry at the offset of a data file.
+func (ns *namespace) dataEntry(file, offset uint32) (int, bool) {
+	start := int(file) * entriesPerDataFile
+	for pos := start; pos < len(ns.log) && pos < start+entriesPerDataFile; pos++ {
+		if ns.log[pos].offset == offset {
+			return pos, true
+		}
+	}
+
+	return 0, false
+}
+
+func (ns *namespace) currentDataFile() uint32 {
+	if len(ns.log) == 0 {
+		return 0
+	}
+
+	return ns.log[len(ns.log)-1].file
+}
+
+func (e entry) entrySize() uint32 {
+	return uint32(entryHeaderSize + len(e.key) + len(e.value))
+}
+
+func (e entry) flags() int64 {
+	if e.deleted {
+		return flagDeleted
+	}
+
+	return 0
+}
+
+func (ns *namespace) size() uint64 {
+	var size uint64
+	for _, idx := range ns.index {
+		size += uint64(len(ns.log[idx].value))
+	}
+
+	return size
+}
+
+func encodeCursor(idx int) string {
+	var buf [4]byte
+	binary.BigEndian.PutUint32(buf[:], uint32(idx))
+
+	return string(buf[:])
+}
+
+func decodeCursor(cursor string) (int, error) {
+	if len(cursor) != 4 {
+		return 0, errors.New("invalid cursor")
+	}
+
+	return int(binary.BigEndian.Uint32([]byte(cursor))), nil
+}
+
+// encodeDataRef encodes the reference to an entry returned by HISTORY. Like in 0-db, it is
+// not a key cursor: a cursor returned by KEYCUR or SCAN is not a valid HISTORY reference.
+func encodeDataRef(idx int) string {
+	return "d" + encodeCursor(idx)
+}
+
+func decodeDataRef(ref string) (int, error) {
+	if len(ref) != 5 || ref[0] != 'd' {
+		return 0, errors.New("invalid data reference")
+	}
+
+	return decodeCursor(ref[1:])
+}
+
+func wrongArgs(cmd string) error {
+	return fmt.Errorf("Wrong number of arguments for %s", cmd)
+}
+
+func yesNo(b bool) string {
+	if b {
+		return "yes"
+	}
+
+	return "no"
+}